@@ -9,8 +9,10 @@ import (
 	"fyne.io/fyne/v2/widget"
 	"image/color"
 	"lab_1/rs232"
+	"lab_1/terminal"
 	"log"
 	"strings"
+	"sync"
 )
 
 type LogWriter struct {
@@ -59,14 +61,19 @@ type UserInterface struct {
 	DebugEntry       *widget.Entry
 	SelectInputPort  *widget.Select
 	SelectOutputPort *widget.Select
+	Terminal         *Terminal
+	HexView          *widget.TextGrid
+	HexDump          terminal.HexDump
+	Translation      terminal.Translation
 	Grid             *fyne.Container
+	received         sync.Mutex
 }
 
 func (u *UserInterface) InitSelects(ports []string) {
 	u.SelectInputPort = widget.NewSelect(
 		ports,
 		func(s string) {
-			if u.InputPort.SerialPort != nil {
+			if u.InputPort.IsOpen() {
 				err := u.InputPort.ClosePort()
 				if err != nil {
 					ErrorWindow(err, u.App)
@@ -86,7 +93,7 @@ func (u *UserInterface) InitSelects(ports []string) {
 	u.SelectOutputPort = widget.NewSelect(
 		ports,
 		func(s string) {
-			if u.OutputPort.SerialPort != nil {
+			if u.OutputPort.IsOpen() {
 				err := u.OutputPort.ClosePort()
 				if err != nil {
 					ErrorWindow(err, u.App)
@@ -129,6 +136,9 @@ func (u *UserInterface) InitEntries() {
 	u.OutputEntry = InitReadOnlyEntry()
 	u.StatusEntry = InitReadOnlyEntry()
 	u.DebugEntry = InitReadOnlyEntry()
+	u.Terminal = NewTerminal()
+	u.Terminal.OnTyped = u.TransmitTyped
+	u.HexView = widget.NewTextGrid()
 	log.SetFlags(log.Ltime)
 	log.SetOutput(&LogWriter{entry: u.DebugEntry})
 }
@@ -162,9 +172,14 @@ func (u *UserInterface) MakeGrid() {
 		u.InputEntry)
 	column3 := container.NewBorder(
 		container.NewVBox(u.SelectOutputPort,
-			container.NewCenter(widget.NewLabel("Received data"))),
+			container.NewCenter(widget.NewLabel("Received data")),
+			u.makeTerminalBar()),
 		nil, nil, nil,
-		u.OutputEntry)
+		container.NewAppTabs(
+			container.NewTabItem("Text", u.OutputEntry),
+			container.NewTabItem("Terminal", u.Terminal),
+			container.NewTabItem("Hex", container.NewScroll(u.HexView)),
+		))
 	u.Grid = container.New(
 		layout.NewGridLayoutWithColumns(3),
 		column1,
@@ -172,6 +187,84 @@ func (u *UserInterface) MakeGrid() {
 		column3)
 }
 
+func (u *UserInterface) makeTerminalBar() fyne.CanvasObject {
+	echo := widget.NewCheck("Local echo", func(on bool) {
+		u.Terminal.LocalEcho = on
+	})
+	enter := widget.NewSelect(terminal.NewlineNames, func(s string) {
+		u.Terminal.Newline = terminal.Newline(indexOf(terminal.NewlineNames, s))
+	})
+	enter.SetSelectedIndex(int(u.Terminal.Newline))
+	incoming := widget.NewSelect(terminal.TranslationNames, func(s string) {
+		u.Translation = terminal.Translation(indexOf(terminal.TranslationNames, s))
+	})
+	incoming.SetSelectedIndex(int(u.Translation))
+	sendBreak := widget.NewButton("Break", func() {
+		err := u.InputPort.SendBreak(rs232.BreakDuration)
+		if err != nil {
+			ErrorWindow(err, u.App)
+		}
+	})
+	clear := widget.NewButton("Clear", u.ClearReceived)
+	return container.NewVBox(
+		container.NewHBox(echo, layout.NewSpacer(), sendBreak, clear),
+		container.New(layout.NewFormLayout(),
+			widget.NewLabel("Enter sends"), enter,
+			widget.NewLabel("Incoming"), incoming),
+	)
+}
+
+func indexOf(options []string, s string) int {
+	for i, option := range options {
+		if option == s {
+			return i
+		}
+	}
+	return 0
+}
+
+// TransmitTyped sends keys typed on the terminal to the transmitter port.
+func (u *UserInterface) TransmitTyped(data []byte) {
+	if !u.InputPort.IsOpen() {
+		log.Printf("Transmitter port is not open\n")
+		return
+	}
+	err := u.InputPort.WriteBytes(data)
+	if err != nil {
+		ErrorWindow(err, u.App)
+		return
+	}
+	u.TransmittedBytes += len(data)
+	u.UpdateStatus()
+}
+
+// ShowReceived adds data from the receiver port to every view.
+func (u *UserInterface) ShowReceived(data []byte) {
+	u.received.Lock()
+	defer u.received.Unlock()
+	u.OutputEntry.SetText(u.OutputEntry.Text + string(data))
+	_, _ = u.HexDump.Write(data)
+	u.HexView.SetText(u.HexDump.String())
+	u.Terminal.Write(u.Translation.Apply(data))
+}
+
+// ShowReply puts what a device answers on the transmitter port on the
+// terminal, so a single port is enough to talk to it.
+func (u *UserInterface) ShowReply(data []byte) {
+	u.received.Lock()
+	defer u.received.Unlock()
+	u.Terminal.Write(u.Translation.Apply(data))
+}
+
+func (u *UserInterface) ClearReceived() {
+	u.received.Lock()
+	defer u.received.Unlock()
+	u.OutputEntry.SetText("")
+	u.HexDump.Reset()
+	u.HexView.SetText("")
+	u.Terminal.Clear()
+}
+
 func (u *UserInterface) UpdateStatus() {
 	mode := rs232.DefaultConfig()
 	status := fmt.Sprintf("Ports parameters:\n"+
@@ -0,0 +1,226 @@
+package gui
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"image/color"
+	"lab_1/terminal"
+	"strings"
+	"sync"
+)
+
+var palette = []color.Color{
+	color.NRGBA{R: 0x00, G: 0x00, B: 0x00, A: 0xff},
+	color.NRGBA{R: 0xcd, G: 0x00, B: 0x00, A: 0xff},
+	color.NRGBA{R: 0x00, G: 0xcd, B: 0x00, A: 0xff},
+	color.NRGBA{R: 0xcd, G: 0xcd, B: 0x00, A: 0xff},
+	color.NRGBA{R: 0x00, G: 0x00, B: 0xee, A: 0xff},
+	color.NRGBA{R: 0xcd, G: 0x00, B: 0xcd, A: 0xff},
+	color.NRGBA{R: 0x00, G: 0xcd, B: 0xcd, A: 0xff},
+	color.NRGBA{R: 0xe5, G: 0xe5, B: 0xe5, A: 0xff},
+	color.NRGBA{R: 0x7f, G: 0x7f, B: 0x7f, A: 0xff},
+	color.NRGBA{R: 0xff, G: 0x00, B: 0x00, A: 0xff},
+	color.NRGBA{R: 0x00, G: 0xff, B: 0x00, A: 0xff},
+	color.NRGBA{R: 0xff, G: 0xff, B: 0x00, A: 0xff},
+	color.NRGBA{R: 0x5c, G: 0x5c, B: 0xff, A: 0xff},
+	color.NRGBA{R: 0xff, G: 0x00, B: 0xff, A: 0xff},
+	color.NRGBA{R: 0x00, G: 0xff, B: 0xff, A: 0xff},
+	color.NRGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff},
+}
+
+var (
+	defaultForeground color.Color = color.White
+	defaultBackground color.Color = color.Black
+)
+
+var keySequences = map[fyne.KeyName]string{
+	fyne.KeyBackspace: "\x7f",
+	fyne.KeyTab:       "\t",
+	fyne.KeyEscape:    "\x1b",
+	fyne.KeyUp:        "\x1b[A",
+	fyne.KeyDown:      "\x1b[B",
+	fyne.KeyRight:     "\x1b[C",
+	fyne.KeyLeft:      "\x1b[D",
+	fyne.KeyHome:      "\x1b[H",
+	fyne.KeyEnd:       "\x1b[F",
+	fyne.KeyInsert:    "\x1b[2~",
+	fyne.KeyDelete:    "\x1b[3~",
+	fyne.KeyPageUp:    "\x1b[5~",
+	fyne.KeyPageDown:  "\x1b[6~",
+	fyne.KeyF1:        "\x1bOP",
+	fyne.KeyF2:        "\x1bOQ",
+	fyne.KeyF3:        "\x1bOR",
+	fyne.KeyF4:        "\x1bOS",
+}
+
+// Terminal shows a terminal screen and sends the keys typed on it, arrows
+// and Ctrl combinations included. Tap it to give it the keyboard.
+type Terminal struct {
+	widget.BaseWidget
+	OnTyped   func(data []byte)
+	Newline   terminal.Newline
+	LocalEcho bool
+	screen    *terminal.Screen
+	grid      *widget.TextGrid
+	scroll    *container.Scroll
+	styles    map[terminal.Attributes]widget.TextGridStyle
+	mutex     sync.Mutex
+}
+
+func NewTerminal() *Terminal {
+	t := &Terminal{
+		screen: terminal.NewScreen(terminal.DefaultRows, terminal.DefaultCols),
+		grid:   widget.NewTextGrid(),
+		styles: make(map[terminal.Attributes]widget.TextGridStyle),
+	}
+	t.screen.Reply = func(data []byte) {
+		if t.OnTyped != nil {
+			t.OnTyped(data)
+		}
+	}
+	t.scroll = container.NewScroll(t.grid)
+	t.ExtendBaseWidget(t)
+	t.redraw()
+	return t
+}
+
+func (t *Terminal) CreateRenderer() fyne.WidgetRenderer {
+	return widget.NewSimpleRenderer(t.scroll)
+}
+
+// Write shows received data.
+func (t *Terminal) Write(data []byte) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	_, _ = t.screen.Write(data)
+	t.redraw()
+}
+
+func (t *Terminal) Clear() {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	t.screen.Clear()
+	t.redraw()
+}
+
+// Text returns the screen as plain text.
+func (t *Terminal) Text() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.screen.Text()
+}
+
+func (t *Terminal) redraw() {
+	history := t.screen.History()
+	rows := make([]widget.TextGridRow, 0, len(history)+t.screen.Rows)
+	for _, line := range history {
+		rows = append(rows, t.row(line))
+	}
+	for i := 0; i < t.screen.Rows; i++ {
+		rows = append(rows, t.row(t.screen.Line(i)))
+	}
+	if t.screen.CursorVisible {
+		row, col := t.screen.Cursor()
+		cell := &rows[len(history)+row].Cells[col]
+		attributes := t.screen.Line(row)[col].Attributes
+		attributes.Reverse = !attributes.Reverse
+		cell.Style = t.style(attributes)
+	}
+	t.grid.Rows = rows
+	t.grid.Refresh()
+	t.scroll.ScrollToBottom()
+}
+
+func (t *Terminal) row(line []terminal.Cell) widget.TextGridRow {
+	cells := make([]widget.TextGridCell, len(line))
+	for i, cell := range line {
+		cells[i] = widget.TextGridCell{Rune: cell.Rune, Style: t.style(cell.Attributes)}
+	}
+	return widget.TextGridRow{Cells: cells}
+}
+
+func (t *Terminal) style(attributes terminal.Attributes) widget.TextGridStyle {
+	style, ok := t.styles[attributes]
+	if ok {
+		return style
+	}
+	foreground, background := defaultForeground, defaultBackground
+	if attributes.Foreground != terminal.DefaultColor {
+		foreground = palette[attributes.Foreground]
+	}
+	if attributes.Background != terminal.DefaultColor {
+		background = palette[attributes.Background]
+	}
+	if attributes.Bold && attributes.Foreground >= 0 && attributes.Foreground < 8 {
+		foreground = palette[attributes.Foreground+8]
+	}
+	if attributes.Reverse {
+		foreground, background = background, foreground
+	}
+	style = &widget.CustomTextGridStyle{
+		TextStyle: fyne.TextStyle{Monospace: true, Bold: attributes.Bold},
+		FGColor:   foreground,
+		BGColor:   background,
+	}
+	t.styles[attributes] = style
+	return style
+}
+
+func (t *Terminal) send(data []byte, enter bool) {
+	if t.LocalEcho {
+		if enter {
+			t.Write([]byte("\r\n"))
+		} else {
+			t.Write(data)
+		}
+	}
+	if t.OnTyped != nil {
+		t.OnTyped(data)
+	}
+}
+
+func (t *Terminal) Tapped(*fyne.PointEvent) {
+	canvas := fyne.CurrentApp().Driver().CanvasForObject(t)
+	if canvas != nil {
+		canvas.Focus(t)
+	}
+}
+
+func (t *Terminal) FocusGained() {}
+
+func (t *Terminal) FocusLost() {}
+
+func (t *Terminal) TypedRune(r rune) {
+	t.send([]byte(string(r)), false)
+}
+
+func (t *Terminal) TypedKey(event *fyne.KeyEvent) {
+	if event.Name == fyne.KeyReturn || event.Name == fyne.KeyEnter {
+		t.send(t.Newline.Bytes(), true)
+		return
+	}
+	sequence, ok := keySequences[event.Name]
+	if ok {
+		t.send([]byte(sequence), false)
+	}
+}
+
+// TypedShortcut sends Ctrl combinations as control characters and pastes
+// the clipboard as if it was typed.
+func (t *Terminal) TypedShortcut(shortcut fyne.Shortcut) {
+	if paste, ok := shortcut.(*fyne.ShortcutPaste); ok {
+		text := strings.ReplaceAll(paste.Clipboard.Content(), "\r\n", "\n")
+		text = strings.ReplaceAll(text, "\n", string(t.Newline.Bytes()))
+		t.send([]byte(text), false)
+		return
+	}
+	keyboard, ok := shortcut.(fyne.KeyboardShortcut)
+	if !ok || len(keyboard.Key()) != 1 {
+		return
+	}
+	key := keyboard.Key()[0]
+	if keyboard.Mod()&fyne.KeyModifierControl != 0 && key >= '@' && key <= '_' {
+		t.send([]byte{key & 0x1f}, false)
+	}
+}
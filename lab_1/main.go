@@ -16,7 +16,7 @@ import (
 func TransmitData(u *gui.UserInterface) {
 	prevText := ""
 	for {
-		if u.InputEntry != nil && u.InputPort.SerialPort != nil {
+		if u.InputEntry != nil && u.InputPort.IsOpen() {
 			currentText := u.InputEntry.Text
 			if len(currentText) > len(prevText) {
 				newChars := []rune(currentText[len(prevText):])
@@ -46,15 +46,15 @@ func TransmitData(u *gui.UserInterface) {
 func ReceiveData(u *gui.UserInterface, mutex *sync.Mutex) {
 	for {
 		mutex.Lock()
-		if u.OutputEntry != nil && u.OutputPort.SerialPort != nil {
+		if u.OutputEntry != nil && u.OutputPort.IsOpen() {
 			data, err := u.OutputPort.ReadBytes()
 			mutex.Unlock()
-			if err != nil && err.Error() != "Port has been closed" {
+			if err != nil && !errors.Is(err, rs232.ErrClosed) && !errors.Is(err, rs232.ErrNotOpen) {
 				gui.ErrorWindow(err, u.App)
 				continue
 			}
 			if len(data) > 0 {
-				u.OutputEntry.SetText(u.OutputEntry.Text + string(data))
+				u.ShowReceived(data)
 			}
 		} else {
 			mutex.Unlock()
@@ -62,6 +62,26 @@ func ReceiveData(u *gui.UserInterface, mutex *sync.Mutex) {
 	}
 }
 
+func ReceiveReplies(u *gui.UserInterface) {
+	for {
+		data, err := u.InputPort.ReadBytes()
+		if errors.Is(err, rs232.ErrNotOpen) {
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		if err != nil {
+			if !errors.Is(err, rs232.ErrClosed) {
+				gui.ErrorWindow(err, u.App)
+				time.Sleep(time.Second)
+			}
+			continue
+		}
+		if len(data) > 0 {
+			u.ShowReply(data)
+		}
+	}
+}
+
 func main() {
 	u := new(gui.UserInterface)
 	u.App = app.New()
@@ -85,7 +105,7 @@ func main() {
 	w.Resize(fyne.NewSize(675, 475))
 	go func() {
 		for {
-			if u.InputPort.SerialPort == nil || u.OutputPort.SerialPort == nil {
+			if !u.InputPort.IsOpen() || !u.OutputPort.IsOpen() {
 				err := gui.UpdatePorts(u.SelectInputPort, u.SelectOutputPort)
 				if err != nil {
 					gui.ErrorWindow(err, u.App)
@@ -99,5 +119,6 @@ func main() {
 	mutex := new(sync.Mutex)
 	go TransmitData(u)
 	go ReceiveData(u, mutex)
+	go ReceiveReplies(u)
 	w.ShowAndRun()
 }
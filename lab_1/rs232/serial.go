@@ -10,11 +10,33 @@ import (
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+const BreakDuration = 250 * time.Millisecond
+
+var (
+	ErrNotOpen = errors.New("Serial port is not open")
+	ErrClosed  = errors.New("Serial port has been closed")
+)
+
+// Port is shared by the GUI, which opens and closes it, and the goroutines
+// reading and writing it, so SerialPort is only touched under mutex.
 type Port struct {
 	Name       string
 	SerialPort serial.Port
+	mutex      sync.Mutex
+}
+
+func (p *Port) IsOpen() bool {
+	return p.port() != nil
+}
+
+func (p *Port) port() serial.Port {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.SerialPort
 }
 
 func DefaultConfig() *serial.Mode {
@@ -32,53 +54,63 @@ func (p *Port) OpenPort(name string) (serial.Port, error) {
 		log.Printf("Port %s open failed\n", name)
 		return nil, err
 	}
+	p.mutex.Lock()
 	p.Name = name
 	p.SerialPort = port
+	p.mutex.Unlock()
 	log.Printf("Port %s opened successful\n", name)
 	return port, nil
 }
 
 func (p *Port) ClosePort() error {
-	if p.SerialPort != nil {
-		_ = p.SerialPort.ResetOutputBuffer()
-		_ = p.SerialPort.ResetInputBuffer()
-		err := p.SerialPort.Close()
+	p.mutex.Lock()
+	port := p.SerialPort
+	p.SerialPort = nil
+	p.mutex.Unlock()
+	if port != nil {
+		// Closing wakes up a read in progress, which returns ErrClosed.
+		_ = port.ResetOutputBuffer()
+		_ = port.ResetInputBuffer()
+		err := port.Close()
 		if err != nil {
 			log.Printf("Port %s close failed\n", p.Name)
 			return err
 		}
 		log.Printf("Port %s closed successfull\n", p.Name)
-		p.SerialPort = nil
 	}
 	return nil
 }
 
 func (p *Port) WriteBytes(data []byte) error {
-	if p.SerialPort == nil {
-		return errors.New("Serial port is not open")
+	port := p.port()
+	if port == nil {
+		return ErrNotOpen
 	}
-	n, err := p.SerialPort.Write(data)
+	n, err := port.Write(data)
 	if err != nil {
 		return err
 	}
 	log.Printf("Written %d bytes to port %s\n", n, p.Name)
-	err = p.SerialPort.ResetOutputBuffer()
+	err = port.ResetOutputBuffer()
 	if err != nil {
 		return err
 	}
 	return nil
 }
 
+// ReadBytes returns ErrNotOpen before the port is opened and ErrClosed
+// when it is closed during the read.
 func (p *Port) ReadBytes() ([]byte, error) {
-	if p.SerialPort == nil {
-		return nil, errors.New("Serial port is not open")
+	port := p.port()
+	if port == nil {
+		return nil, ErrNotOpen
 	}
 	buff := make([]byte, 256)
-	n, err := p.SerialPort.Read(buff)
-	if err != nil {
-		return nil, err
+	n, err := port.Read(buff)
+	var portErr *serial.PortError
+	if errors.As(err, &portErr) && portErr.Code() == serial.PortClosed {
+		return nil, ErrClosed
 	}
-	err = p.SerialPort.ResetInputBuffer()
 	if err != nil {
 		return nil, err
 	}
@@ -86,6 +118,22 @@ func (p *Port) ReadBytes() ([]byte, error) {
 	return buff[:n], nil
 }
 
+// SendBreak holds the line in the spacing state for duration, which most
+// devices take as an attention or reset request.
+func (p *Port) SendBreak(duration time.Duration) error {
+	port := p.port()
+	if port == nil {
+		return ErrNotOpen
+	}
+	err := port.Break(duration)
+	if err != nil {
+		log.Printf("Break on port %s failed\n", p.Name)
+		return err
+	}
+	log.Printf("Break sent to port %s\n", p.Name)
+	return nil
+}
+
 func PortIsOpen(name string) bool {
 	cmd := exec.Command("fuser", name)
 	output, err := cmd.Output()
@@ -0,0 +1,67 @@
+package terminal
+
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	bytesPerLine = 16
+	dumpLines    = 2000
+)
+
+// HexDump shows a byte stream as offset, hex and printable columns and
+// keeps the last lines of it.
+type HexDump struct {
+	offset int
+	line   []byte
+	lines  []string
+}
+
+func (h *HexDump) Write(data []byte) (int, error) {
+	for _, b := range data {
+		h.line = append(h.line, b)
+		if len(h.line) == bytesPerLine {
+			if len(h.lines) == dumpLines {
+				h.lines = h.lines[1:]
+			}
+			h.lines = append(h.lines, dumpLine(h.offset, h.line))
+			h.offset += bytesPerLine
+			h.line = h.line[:0]
+		}
+	}
+	return len(data), nil
+}
+
+// String includes the line still being filled.
+func (h *HexDump) String() string {
+	lines := h.lines
+	if len(h.line) > 0 {
+		lines = append(lines[:len(lines):len(lines)], dumpLine(h.offset, h.line))
+	}
+	return strings.Join(lines, "\n")
+}
+
+func (h *HexDump) Reset() {
+	*h = HexDump{}
+}
+
+func dumpLine(offset int, data []byte) string {
+	var hex, text strings.Builder
+	for i := 0; i < bytesPerLine; i++ {
+		if i == bytesPerLine/2 {
+			hex.WriteByte(' ')
+		}
+		if i >= len(data) {
+			hex.WriteString("   ")
+			continue
+		}
+		fmt.Fprintf(&hex, "%02x ", data[i])
+		if data[i] >= 0x20 && data[i] < 0x7f {
+			text.WriteByte(data[i])
+		} else {
+			text.WriteByte('.')
+		}
+	}
+	return fmt.Sprintf("%08x  %s |%s|", offset, hex.String(), text.String())
+}
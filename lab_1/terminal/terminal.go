@@ -0,0 +1,574 @@
+// Package terminal emulates the part of VT100 and ANSI that serial
+// consoles use: cursor movement, erasing, scroll regions and colours.
+// Received bytes are written to a Screen, which keeps the lines scrolled
+// off the top as history.
+package terminal
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type Color int
+
+const DefaultColor Color = -1
+
+type Attributes struct {
+	Foreground Color
+	Background Color
+	Bold       bool
+	Underline  bool
+	Reverse    bool
+}
+
+var defaultAttributes = Attributes{Foreground: DefaultColor, Background: DefaultColor}
+
+type Cell struct {
+	Rune rune
+	Attributes
+}
+
+const (
+	DefaultRows = 24
+	DefaultCols = 80
+	historySize = 1000
+)
+
+type parserState int
+
+const (
+	ground parserState = iota
+	escape
+	csi
+	osc
+	oscEscape
+	charset
+)
+
+type cursor struct {
+	row, col   int
+	attributes Attributes
+}
+
+type Screen struct {
+	Rows          int
+	Cols          int
+	CursorVisible bool
+	// Reply sends answers to status requests back to the other side.
+	Reply   func(data []byte)
+	lines   [][]Cell
+	history [][]Cell
+	cursor
+	saved       cursor
+	top, bottom int
+	wrapPending bool
+	autowrap    bool
+	tabs        []bool
+	state       parserState
+	params      []int
+	private     byte
+	pending     []byte
+}
+
+func NewScreen(rows, cols int) *Screen {
+	s := &Screen{Rows: rows, Cols: cols}
+	s.Reset()
+	return s
+}
+
+// Reset clears the screen and the modes but keeps the history.
+func (s *Screen) Reset() {
+	s.lines = make([][]Cell, s.Rows)
+	for i := range s.lines {
+		s.lines[i] = blankLine(s.Cols, defaultAttributes)
+	}
+	s.cursor = cursor{attributes: defaultAttributes}
+	s.saved = s.cursor
+	s.top, s.bottom = 0, s.Rows-1
+	s.wrapPending = false
+	s.autowrap = true
+	s.CursorVisible = true
+	s.tabs = make([]bool, s.Cols)
+	for col := 8; col < s.Cols; col += 8 {
+		s.tabs[col] = true
+	}
+	s.state = ground
+}
+
+// Clear forgets the history too.
+func (s *Screen) Clear() {
+	s.history = nil
+	s.Reset()
+}
+
+func blankLine(cols int, attributes Attributes) []Cell {
+	line := make([]Cell, cols)
+	for i := range line {
+		line[i] = Cell{Rune: ' ', Attributes: attributes}
+	}
+	return line
+}
+
+func (s *Screen) Cursor() (int, int) {
+	return s.row, s.col
+}
+
+// Line returns a row of the screen.
+func (s *Screen) Line(row int) []Cell {
+	return s.lines[row]
+}
+
+func (s *Screen) History() [][]Cell {
+	return s.history
+}
+
+// Text is the screen without trailing blanks, for tests and copying.
+func (s *Screen) Text() string {
+	text := make([]string, len(s.lines))
+	for i, line := range s.lines {
+		text[i] = strings.TrimRight(lineText(line), " ")
+	}
+	return strings.TrimRight(strings.Join(text, "\n"), "\n")
+}
+
+func lineText(line []Cell) string {
+	var text strings.Builder
+	for _, cell := range line {
+		text.WriteRune(cell.Rune)
+	}
+	return text.String()
+}
+
+func (s *Screen) Write(data []byte) (int, error) {
+	for _, b := range data {
+		s.feed(b)
+	}
+	return len(data), nil
+}
+
+func (s *Screen) feed(b byte) {
+	switch s.state {
+	case ground:
+		switch {
+		case b == 0x1b:
+			s.pending = s.pending[:0]
+			s.state = escape
+		case b < 0x20:
+			s.control(b)
+		case b == 0x7f:
+		default:
+			s.text(b)
+		}
+	case escape:
+		s.escape(b)
+	case csi:
+		s.csi(b)
+	case osc:
+		switch b {
+		case 0x07:
+			s.state = ground
+		case 0x1b:
+			s.state = oscEscape
+		}
+	case oscEscape:
+		s.state = ground
+		if b != '\\' {
+			s.feed(b)
+		}
+	case charset:
+		s.state = ground
+	}
+}
+
+// text collects UTF-8 sequences and puts whole runes on the screen.
+func (s *Screen) text(b byte) {
+	s.pending = append(s.pending, b)
+	if !utf8.FullRune(s.pending) {
+		return
+	}
+	r, size := utf8.DecodeRune(s.pending)
+	s.put(r)
+	rest := append([]byte(nil), s.pending[size:]...)
+	s.pending = s.pending[:0]
+	for _, b := range rest {
+		s.text(b)
+	}
+}
+
+func (s *Screen) control(b byte) {
+	s.pending = s.pending[:0]
+	switch b {
+	case '\b':
+		s.wrapPending = false
+		if s.col > 0 {
+			s.col--
+		}
+	case '\t':
+		s.wrapPending = false
+		for s.col < s.Cols-1 {
+			s.col++
+			if s.tabs[s.col] {
+				break
+			}
+		}
+	case '\n', '\v', '\f':
+		s.wrapPending = false
+		s.lineFeed()
+	case '\r':
+		s.wrapPending = false
+		s.col = 0
+	case 0x18, 0x1a:
+		s.state = ground
+	}
+}
+
+func (s *Screen) put(r rune) {
+	if s.wrapPending {
+		s.wrapPending = false
+		s.col = 0
+		s.lineFeed()
+	}
+	s.lines[s.row][s.col] = Cell{Rune: r, Attributes: s.attributes}
+	if s.col < s.Cols-1 {
+		s.col++
+	} else if s.autowrap {
+		s.wrapPending = true
+	}
+}
+
+func (s *Screen) lineFeed() {
+	if s.row == s.bottom {
+		s.scrollUp(1)
+	} else if s.row < s.Rows-1 {
+		s.row++
+	}
+}
+
+func (s *Screen) reverseIndex() {
+	if s.row == s.top {
+		s.scrollDown(1)
+	} else if s.row > 0 {
+		s.row--
+	}
+}
+
+// scrollUp moves the scroll region up; lines leaving the top of the
+// screen go to the history.
+func (s *Screen) scrollUp(n int) {
+	n = min(n, s.bottom-s.top+1)
+	for i := 0; i < n; i++ {
+		if s.top == 0 {
+			if len(s.history) == historySize {
+				s.history = s.history[1:]
+			}
+			s.history = append(s.history, s.lines[0])
+		}
+		copy(s.lines[s.top:s.bottom], s.lines[s.top+1:s.bottom+1])
+		s.lines[s.bottom] = blankLine(s.Cols, s.blank())
+	}
+}
+
+func (s *Screen) scrollDown(n int) {
+	n = min(n, s.bottom-s.top+1)
+	for i := 0; i < n; i++ {
+		copy(s.lines[s.top+1:s.bottom+1], s.lines[s.top:s.bottom])
+		s.lines[s.top] = blankLine(s.Cols, s.blank())
+	}
+}
+
+// blank is what erased cells look like: the current background only.
+func (s *Screen) blank() Attributes {
+	attributes := defaultAttributes
+	attributes.Background = s.attributes.Background
+	return attributes
+}
+
+func (s *Screen) escape(b byte) {
+	s.state = ground
+	switch b {
+	case '[':
+		s.params = s.params[:0]
+		s.private = 0
+		s.state = csi
+	case ']':
+		s.state = osc
+	case '(', ')', '*', '+':
+		s.state = charset
+	case '7':
+		s.saved = s.cursor
+	case '8':
+		s.cursor = s.saved
+		s.wrapPending = false
+	case 'D':
+		s.lineFeed()
+	case 'E':
+		s.col = 0
+		s.lineFeed()
+	case 'M':
+		s.reverseIndex()
+	case 'H':
+		s.tabs[s.col] = true
+	case 'c':
+		s.Reset()
+	case 0x1b:
+		s.state = escape
+	}
+}
+
+func (s *Screen) csi(b byte) {
+	switch {
+	case b >= '0' && b <= '9':
+		if len(s.params) == 0 {
+			s.params = append(s.params, 0)
+		}
+		last := len(s.params) - 1
+		s.params[last] = min(s.params[last]*10+int(b-'0'), 9999)
+	case b == ';':
+		if len(s.params) == 0 {
+			s.params = append(s.params, 0)
+		}
+		s.params = append(s.params, 0)
+	case b == '?' || b == '>' || b == '=' || b == '<':
+		s.private = b
+	case b >= 0x20 && b <= 0x2f:
+	case b >= 0x40 && b <= 0x7e:
+		s.state = ground
+		s.dispatch(b)
+	case b == 0x1b:
+		s.state = escape
+	case b < 0x20:
+		s.control(b)
+	}
+}
+
+// param returns parameter i, or def when it is missing or 0.
+func (s *Screen) param(i, def int) int {
+	if i >= len(s.params) || s.params[i] == 0 {
+		return def
+	}
+	return s.params[i]
+}
+
+func (s *Screen) dispatch(final byte) {
+	if s.private != 0 {
+		s.mode(final)
+		return
+	}
+	n := s.param(0, 1)
+	s.wrapPending = false
+	switch final {
+	case 'A':
+		s.row = max(s.row-n, 0)
+	case 'B', 'e':
+		s.row = min(s.row+n, s.Rows-1)
+	case 'C', 'a':
+		s.col = min(s.col+n, s.Cols-1)
+	case 'D':
+		s.col = max(s.col-n, 0)
+	case 'E':
+		s.row, s.col = min(s.row+n, s.Rows-1), 0
+	case 'F':
+		s.row, s.col = max(s.row-n, 0), 0
+	case 'G', '`':
+		s.col = min(n, s.Cols) - 1
+	case 'd':
+		s.row = min(n, s.Rows) - 1
+	case 'H', 'f':
+		s.row = min(s.param(0, 1), s.Rows) - 1
+		s.col = min(s.param(1, 1), s.Cols) - 1
+	case 'J':
+		s.eraseDisplay(s.param(0, 0))
+	case 'K':
+		s.eraseLine(s.param(0, 0))
+	case 'L':
+		if s.row >= s.top && s.row <= s.bottom {
+			top := s.top
+			s.top = s.row
+			s.scrollDown(n)
+			s.top = top
+		}
+	case 'M':
+		if s.row >= s.top && s.row <= s.bottom {
+			top := s.top
+			s.top = s.row
+			s.scrollUpInPlace(n)
+			s.top = top
+		}
+	case 'P':
+		line := s.lines[s.row]
+		n = min(n, s.Cols-s.col)
+		copy(line[s.col:], line[s.col+n:])
+		s.erase(s.row, s.Cols-n, s.Cols)
+	case '@':
+		line := s.lines[s.row]
+		n = min(n, s.Cols-s.col)
+		copy(line[s.col+n:], line[s.col:])
+		s.erase(s.row, s.col, s.col+n)
+	case 'X':
+		s.erase(s.row, s.col, min(s.col+n, s.Cols))
+	case 'S':
+		s.scrollUpInPlace(n)
+	case 'T':
+		s.scrollDown(n)
+	case 'g':
+		switch s.param(0, 0) {
+		case 0:
+			s.tabs[s.col] = false
+		case 3:
+			s.tabs = make([]bool, s.Cols)
+		}
+	case 'm':
+		s.graphics()
+	case 'r':
+		top, bottom := s.param(0, 1)-1, min(s.param(1, s.Rows), s.Rows)-1
+		if top < bottom {
+			s.top, s.bottom = top, bottom
+			s.row, s.col = 0, 0
+		}
+	case 's':
+		s.saved = s.cursor
+	case 'u':
+		s.cursor = s.saved
+	case 'n':
+		switch s.param(0, 0) {
+		case 5:
+			s.reply("\x1b[0n")
+		case 6:
+			s.reply("\x1b[" + strconv.Itoa(s.row+1) + ";" + strconv.Itoa(s.col+1) + "R")
+		}
+	case 'c':
+		s.reply("\x1b[?1;0c")
+	}
+}
+
+// scrollUpInPlace scrolls the region without feeding the history, as
+// deleting lines does.
+func (s *Screen) scrollUpInPlace(n int) {
+	top := s.top
+	if top == 0 {
+		history := s.history
+		s.scrollUp(n)
+		s.history = history
+		return
+	}
+	s.scrollUp(n)
+}
+
+func (s *Screen) mode(final byte) {
+	if s.private != '?' || final != 'h' && final != 'l' {
+		return
+	}
+	set := final == 'h'
+	for _, mode := range s.params {
+		switch mode {
+		case 7:
+			s.autowrap = set
+		case 25:
+			s.CursorVisible = set
+		}
+	}
+}
+
+func (s *Screen) reply(answer string) {
+	if s.Reply != nil {
+		s.Reply([]byte(answer))
+	}
+}
+
+func (s *Screen) erase(row, from, to int) {
+	for col := from; col < to; col++ {
+		s.lines[row][col] = Cell{Rune: ' ', Attributes: s.blank()}
+	}
+}
+
+func (s *Screen) eraseDisplay(mode int) {
+	switch mode {
+	case 0:
+		s.erase(s.row, s.col, s.Cols)
+		for row := s.row + 1; row < s.Rows; row++ {
+			s.erase(row, 0, s.Cols)
+		}
+	case 1:
+		for row := 0; row < s.row; row++ {
+			s.erase(row, 0, s.Cols)
+		}
+		s.erase(s.row, 0, s.col+1)
+	case 2, 3:
+		for row := 0; row < s.Rows; row++ {
+			s.erase(row, 0, s.Cols)
+		}
+	}
+}
+
+func (s *Screen) eraseLine(mode int) {
+	switch mode {
+	case 0:
+		s.erase(s.row, s.col, s.Cols)
+	case 1:
+		s.erase(s.row, 0, s.col+1)
+	case 2:
+		s.erase(s.row, 0, s.Cols)
+	}
+}
+
+// graphics applies SGR parameters. Of the 256 colours only the first 16
+// are kept; the others and true colour fall back to the default.
+func (s *Screen) graphics() {
+	if len(s.params) == 0 {
+		s.attributes = defaultAttributes
+		return
+	}
+	for i := 0; i < len(s.params); i++ {
+		p := s.params[i]
+		switch {
+		case p == 0:
+			s.attributes = defaultAttributes
+		case p == 1:
+			s.attributes.Bold = true
+		case p == 22:
+			s.attributes.Bold = false
+		case p == 4:
+			s.attributes.Underline = true
+		case p == 24:
+			s.attributes.Underline = false
+		case p == 7:
+			s.attributes.Reverse = true
+		case p == 27:
+			s.attributes.Reverse = false
+		case p >= 30 && p <= 37:
+			s.attributes.Foreground = Color(p - 30)
+		case p == 39:
+			s.attributes.Foreground = DefaultColor
+		case p >= 40 && p <= 47:
+			s.attributes.Background = Color(p - 40)
+		case p == 49:
+			s.attributes.Background = DefaultColor
+		case p >= 90 && p <= 97:
+			s.attributes.Foreground = Color(p - 90 + 8)
+		case p >= 100 && p <= 107:
+			s.attributes.Background = Color(p - 100 + 8)
+		case p == 38 || p == 48:
+			color, used := extendedColor(s.params[i+1:])
+			i += used
+			if p == 38 {
+				s.attributes.Foreground = color
+			} else {
+				s.attributes.Background = color
+			}
+		}
+	}
+}
+
+func extendedColor(params []int) (Color, int) {
+	if len(params) >= 2 && params[0] == 5 {
+		if params[1] < 16 {
+			return Color(params[1]), 2
+		}
+		return DefaultColor, 2
+	}
+	if len(params) >= 4 && params[0] == 2 {
+		return DefaultColor, 4
+	}
+	return DefaultColor, len(params)
+}
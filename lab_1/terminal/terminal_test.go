@@ -0,0 +1,129 @@
+package terminal
+
+import (
+	"strings"
+	"testing"
+)
+
+func screenOf(rows, cols int, input string) *Screen {
+	s := NewScreen(rows, cols)
+	_, _ = s.Write([]byte(input))
+	return s
+}
+
+func TestScreenText(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"plain", "hello\r\nworld", "hello\nworld"},
+		{"bare line feed", "ab\ncd", "ab\n  cd"},
+		{"backspace", "abc\b\bX", "aXc"},
+		{"tab", "a\tb", "a       b"},
+		{"cursor position", "\x1b[2;3Hx\x1b[1;1Hy", "y\n  x"},
+		{"cursor moves", "abc\x1b[2D\x1b[Bx\x1b[Ay", "aby\n x"},
+		{"erase line", "abcdef\x1b[3G\x1b[K", "ab"},
+		{"erase display", "one\r\ntwo\x1b[2J", ""},
+		{"delete chars", "abcdef\x1b[1;2H\x1b[2P", "adef"},
+		{"insert chars", "abcd\x1b[1;2H\x1b[2@", "a  bcd"},
+		{"autowrap", "0123456789ab", "0123456789\nab"},
+		{"utf-8", "привет", "привет"},
+		{"osc title", "\x1b]0;title\x07ok", "ok"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := screenOf(4, 10, test.input).Text(); got != test.want {
+				t.Errorf("Text() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestScreenSplitWrites(t *testing.T) {
+	s := NewScreen(4, 10)
+	input := []byte("\x1b[31mзв\x1b[0m")
+	for i := range input {
+		_, _ = s.Write(input[i : i+1])
+	}
+	if got := s.Text(); got != "зв" {
+		t.Fatalf("Text() = %q, want %q", got, "зв")
+	}
+	if color := s.Line(0)[0].Foreground; color != 1 {
+		t.Errorf("foreground = %d, want 1", color)
+	}
+}
+
+func TestScreenHistory(t *testing.T) {
+	s := screenOf(2, 10, "one\r\ntwo\r\nthree\r\nfour")
+	if got := s.Text(); got != "three\nfour" {
+		t.Errorf("Text() = %q", got)
+	}
+	history := s.History()
+	if len(history) != 2 || strings.TrimSpace(lineText(history[0])) != "one" {
+		t.Errorf("history has %d lines", len(history))
+	}
+	s.Clear()
+	if len(s.History()) != 0 || s.Text() != "" {
+		t.Error("Clear() kept the history")
+	}
+}
+
+func TestScreenScrollRegion(t *testing.T) {
+	s := screenOf(4, 10, "top\x1b[2;3r\x1b[2;1Ha\r\nb\r\nc\x1b[4;1Hbottom")
+	if got := s.Text(); got != "top\nb\nc\nbottom" {
+		t.Errorf("Text() = %q", got)
+	}
+	if len(s.History()) != 0 {
+		t.Error("scroll region fed the history")
+	}
+}
+
+func TestScreenGraphics(t *testing.T) {
+	s := screenOf(2, 10, "\x1b[1;32;44ma\x1b[7mb\x1b[38;5;9mc\x1b[0md")
+	line := s.Line(0)
+	want := []Attributes{
+		{Foreground: 2, Background: 4, Bold: true},
+		{Foreground: 2, Background: 4, Bold: true, Reverse: true},
+		{Foreground: 9, Background: 4, Bold: true, Reverse: true},
+		defaultAttributes,
+	}
+	for i, attributes := range want {
+		if line[i].Attributes != attributes {
+			t.Errorf("cell %d = %+v, want %+v", i, line[i].Attributes, attributes)
+		}
+	}
+}
+
+func TestScreenReplies(t *testing.T) {
+	var replies []string
+	s := NewScreen(4, 10)
+	s.Reply = func(data []byte) { replies = append(replies, string(data)) }
+	_, _ = s.Write([]byte("\x1b[3;5H\x1b[6n\x1b[5n"))
+	if strings.Join(replies, "|") != "\x1b[3;5R|\x1b[0n" {
+		t.Errorf("replies = %q", replies)
+	}
+}
+
+func TestTranslation(t *testing.T) {
+	data := []byte("a\rb\nc")
+	if got := string(TranslateLF.Apply(data)); got != "a\rb\r\nc" {
+		t.Errorf("TranslateLF = %q", got)
+	}
+	if got := string(TranslateCR.Apply(data)); got != "a\r\nb\nc" {
+		t.Errorf("TranslateCR = %q", got)
+	}
+	if got := string(NewlineCRLF.Bytes()); got != "\r\n" {
+		t.Errorf("NewlineCRLF = %q", got)
+	}
+}
+
+func TestHexDump(t *testing.T) {
+	var dump HexDump
+	_, _ = dump.Write([]byte("0123456789abcdef\x00\x1b"))
+	want := "00000000  30 31 32 33 34 35 36 37  38 39 61 62 63 64 65 66  |0123456789abcdef|\n" +
+		"00000010  00 1b                                             |..|"
+	if got := dump.String(); got != want {
+		t.Errorf("String() =\n%s\nwant\n%s", got, want)
+	}
+}
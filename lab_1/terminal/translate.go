@@ -0,0 +1,48 @@
+package terminal
+
+import "bytes"
+
+// Newline is what the Enter key sends.
+type Newline int
+
+const (
+	NewlineCR Newline = iota
+	NewlineLF
+	NewlineCRLF
+)
+
+var NewlineNames = []string{"CR", "LF", "CR+LF"}
+
+func (n Newline) Bytes() []byte {
+	switch n {
+	case NewlineLF:
+		return []byte{'\n'}
+	case NewlineCRLF:
+		return []byte{'\r', '\n'}
+	default:
+		return []byte{'\r'}
+	}
+}
+
+// Translation adds the half of a line ending that the other side leaves
+// out to received data.
+type Translation int
+
+const (
+	TranslateNone Translation = iota
+	TranslateLF
+	TranslateCR
+)
+
+var TranslationNames = []string{"As received", "LF as CR+LF", "CR as CR+LF"}
+
+func (t Translation) Apply(data []byte) []byte {
+	switch t {
+	case TranslateLF:
+		return bytes.ReplaceAll(data, []byte{'\n'}, []byte{'\r', '\n'})
+	case TranslateCR:
+		return bytes.ReplaceAll(data, []byte{'\r'}, []byte{'\r', '\n'})
+	default:
+		return data
+	}
+}
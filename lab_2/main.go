@@ -22,12 +22,12 @@ func TransmitData(u *gui.UserInterface) {
 				dataChunk := currentText[len(prevText) : len(prevText)+7]
 				rawPacket, formattedPacket, err := packet.SerializePacket(dataChunk, u.InputPort.Number)
 				if err != nil {
-					gui.ErrorWindow(err, u.App)
+					u.Notifier.Notify(gui.SeverityError, err.Error())
 					return
 				}
 				err = u.InputPort.WriteBytes(rawPacket)
 				if err != nil {
-					gui.ErrorWindow(err, u.App)
+					u.Notifier.Notify(gui.SeverityError, err.Error())
 					return
 				}
 				u.TransmittedBytes += len(rawPacket)
@@ -45,12 +45,12 @@ func ReceiveData(u *gui.UserInterface, mutex *sync.Mutex) {
 			rawData, err := u.OutputPort.ReadBytes()
 			mutex.Unlock()
 			if err != nil && err.Error() != "Port has been closed" {
-				gui.ErrorWindow(err, u.App)
+				u.Notifier.Notify(gui.SeverityError, err.Error())
 				continue
 			}
 			data, errPacket := packet.ParseRawData(rawData)
 			if errPacket != nil {
-				gui.ErrorWindow(errPacket, u.App)
+				u.Notifier.Notify(gui.SeverityError, errPacket.Error())
 			}
 			u.OutputEntry.SetText(u.OutputEntry.Text + data)
 		} else {
@@ -84,7 +84,7 @@ func main() {
 			if u.InputPort.SerialPort == nil || u.OutputPort.SerialPort == nil {
 				err := gui.UpdatePorts(u.SelectInputPort, u.SelectOutputPort)
 				if err != nil {
-					gui.ErrorWindow(err, u.App)
+					u.Notifier.Notify(gui.SeverityError, err.Error())
 				}
 			} else {
 				break
@@ -57,6 +57,7 @@ type UserInterface struct {
 	OutputEntry      *widget.Entry
 	StatusEntry      *widget.Entry
 	DebugEntry       *widget.Entry
+	Notifier         *Notifier
 	SelectInputPort  *widget.Select
 	SelectOutputPort *widget.Select
 	Grid             *fyne.Container
@@ -69,16 +70,16 @@ func (u *UserInterface) InitSelects(ports []string) {
 			if u.InputPort.SerialPort != nil {
 				err := u.InputPort.ClosePort()
 				if err != nil {
-					ErrorWindow(err, u.App)
+					u.Notifier.Notify(SeverityError, err.Error())
 				}
 			}
 			_, err := u.InputPort.OpenPort(s)
 			if err != nil {
-				ErrorWindow(err, u.App)
+				u.Notifier.Notify(SeverityError, err.Error())
 			}
 			err = UpdatePorts(u.SelectInputPort, u.SelectOutputPort)
 			if err != nil {
-				ErrorWindow(err, u.App)
+				u.Notifier.Notify(SeverityError, err.Error())
 			}
 		},
 	)
@@ -89,16 +90,16 @@ func (u *UserInterface) InitSelects(ports []string) {
 			if u.OutputPort.SerialPort != nil {
 				err := u.OutputPort.ClosePort()
 				if err != nil {
-					ErrorWindow(err, u.App)
+					u.Notifier.Notify(SeverityError, err.Error())
 				}
 			}
 			_, err := u.OutputPort.OpenPort(s)
 			if err != nil {
-				ErrorWindow(err, u.App)
+				u.Notifier.Notify(SeverityError, err.Error())
 			}
 			err = UpdatePorts(u.SelectInputPort, u.SelectOutputPort)
 			if err != nil {
-				ErrorWindow(err, u.App)
+				u.Notifier.Notify(SeverityError, err.Error())
 			}
 		},
 	)
@@ -129,6 +130,7 @@ func (u *UserInterface) InitEntries() {
 	u.OutputEntry = InitReadOnlyEntry()
 	u.StatusEntry = InitReadOnlyEntry()
 	u.DebugEntry = InitReadOnlyEntry()
+	u.Notifier = NewNotifier(u.App, 100)
 	log.SetFlags(log.Ltime)
 	log.SetOutput(&LogWriter{entry: u.DebugEntry})
 }
@@ -165,11 +167,12 @@ func (u *UserInterface) MakeGrid() {
 			container.NewCenter(widget.NewLabel("Received data"))),
 		nil, nil, nil,
 		u.OutputEntry)
-	u.Grid = container.New(
+	columns := container.New(
 		layout.NewGridLayoutWithColumns(3),
 		column1,
 		column2,
 		column3)
+	u.Grid = container.NewBorder(nil, u.Notifier.Content(), nil, nil, columns)
 }
 
 func (u *UserInterface) UpdateStatus(formattedPacket string) {
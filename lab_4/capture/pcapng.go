@@ -0,0 +1,209 @@
+// Package capture writes link events to pcapng files that Wireshark can
+// open with the dissector in serial_frames.lua.
+//
+// Every packet uses link type LINKTYPE_USER0 (147) and starts with a
+// 12-byte header, multi-byte fields in big endian:
+//
+//	offset size field
+//	0      1    version, currently 2
+//	1      1    event: 1 frame, 2 jam, 3 collision, 4 abort, 5 idle
+//	2      1    direction: 0 transmitted, 1 received
+//	3      1    framing, the index of its name in Framings
+//	4      2    port number (the N of /dev/ttySN), 0 when unknown
+//	6      2    attempt number for collisions and jams, otherwise 0
+//	8      1    line code, the index of its name in LineCodes
+//	9      3    reserved, 0
+//
+// Framing and line code are 255 when unknown. A frame event is followed by
+// the frame as the framing made it, before line coding: one bit per byte
+// for the lab bits ('\n' data bits are kept as 0x0a), the delimited and
+// escaped bytes for PPP, SLIP and COBS.
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	LinkTypeUser0 = 147
+	HeaderVersion = 2
+	HeaderSize    = 12
+	unknownName   = 255
+)
+
+var (
+	Framings  = []string{"bits", "ppp", "slip", "cobs"}
+	LineCodes = []string{"none", "nrz", "nrzi", "manchester", "diff-manchester", "4b5b", "8b10b"}
+)
+
+type EventType byte
+
+const (
+	EventFrame     EventType = 1
+	EventJam       EventType = 2
+	EventCollision EventType = 3
+	EventAbort     EventType = 4
+	EventIdle      EventType = 5
+)
+
+type Direction byte
+
+const (
+	Transmitted Direction = 0
+	Received    Direction = 1
+)
+
+type Event struct {
+	Time      time.Time
+	Type      EventType
+	Direction Direction
+	Port      int
+	Attempt   int
+	Framing   string
+	LineCode  string
+	Data      []byte
+}
+
+func (e Event) header() []byte {
+	header := make([]byte, HeaderSize)
+	header[0] = HeaderVersion
+	header[1] = byte(e.Type)
+	header[2] = byte(e.Direction)
+	header[3] = nameIndex(Framings, e.Framing)
+	binary.BigEndian.PutUint16(header[4:6], uint16(e.Port))
+	binary.BigEndian.PutUint16(header[6:8], uint16(e.Attempt))
+	header[8] = nameIndex(LineCodes, e.LineCode)
+	return header
+}
+
+func nameIndex(names []string, name string) byte {
+	for i, known := range names {
+		if known == name {
+			return byte(i)
+		}
+	}
+	return unknownName
+}
+
+const (
+	blockSectionHeader  = 0x0A0D0D0A
+	blockInterface      = 0x00000001
+	blockEnhancedPacket = 0x00000006
+	byteOrderMagic      = 0x1A2B3C4D
+	optionEnd           = 0
+	optionComment       = 1
+	optionEPBFlags      = 2
+)
+
+type Writer struct {
+	mutex  sync.Mutex
+	output io.Writer
+	closer io.Closer
+}
+
+func NewWriter(output io.Writer) (*Writer, error) {
+	w := &Writer{output: output}
+	section := make([]byte, 16)
+	binary.LittleEndian.PutUint32(section[0:4], byteOrderMagic)
+	binary.LittleEndian.PutUint16(section[4:6], 1)
+	binary.LittleEndian.PutUint16(section[6:8], 0)
+	binary.LittleEndian.PutUint64(section[8:16], 0xFFFFFFFFFFFFFFFF)
+	err := w.block(blockSectionHeader, section,
+		option(optionComment, []byte("Serial link capture, see serial_frames.lua")))
+	if err != nil {
+		return nil, err
+	}
+	iface := make([]byte, 8)
+	binary.LittleEndian.PutUint16(iface[0:2], LinkTypeUser0)
+	binary.LittleEndian.PutUint32(iface[4:8], 0)
+	err = w.block(blockInterface, iface)
+	if err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+func Create(path string) (*Writer, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w, err := NewWriter(file)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	w.closer = file
+	return w, nil
+}
+
+func (w *Writer) Write(event Event) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	data := append(event.header(), event.Data...)
+	micros := uint64(event.Time.UnixMicro())
+	packet := make([]byte, 20)
+	binary.LittleEndian.PutUint32(packet[0:4], 0)
+	binary.LittleEndian.PutUint32(packet[4:8], uint32(micros>>32))
+	binary.LittleEndian.PutUint32(packet[8:12], uint32(micros))
+	binary.LittleEndian.PutUint32(packet[12:16], uint32(len(data)))
+	binary.LittleEndian.PutUint32(packet[16:20], uint32(len(data)))
+	packet = append(packet, pad(data)...)
+	flags := make([]byte, 4)
+	if event.Direction == Received {
+		binary.LittleEndian.PutUint32(flags, 1)
+	} else {
+		binary.LittleEndian.PutUint32(flags, 2)
+	}
+	return w.block(blockEnhancedPacket, packet, option(optionEPBFlags, flags))
+}
+
+func (w *Writer) Close() error {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	if w.closer == nil {
+		return nil
+	}
+	return w.closer.Close()
+}
+
+func (w *Writer) block(blockType uint32, body []byte, options ...[]byte) error {
+	var block bytes.Buffer
+	block.Write(body)
+	if len(options) > 0 {
+		for _, opt := range options {
+			block.Write(opt)
+		}
+		block.Write(option(optionEnd, nil))
+	}
+	length := uint32(block.Len() + 12)
+	raw := make([]byte, 0, length)
+	raw = binary.LittleEndian.AppendUint32(raw, blockType)
+	raw = binary.LittleEndian.AppendUint32(raw, length)
+	raw = append(raw, block.Bytes()...)
+	raw = binary.LittleEndian.AppendUint32(raw, length)
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	_, err := w.output.Write(raw)
+	return err
+}
+
+func option(code uint16, value []byte) []byte {
+	raw := binary.LittleEndian.AppendUint16(nil, code)
+	raw = binary.LittleEndian.AppendUint16(raw, uint16(len(value)))
+	return append(raw, pad(value)...)
+}
+
+func pad(data []byte) []byte {
+	padded := append([]byte(nil), data...)
+	for len(padded)%4 != 0 {
+		padded = append(padded, 0)
+	}
+	return padded
+}
@@ -0,0 +1,141 @@
+package capture
+
+import (
+	"bytes"
+	"encoding/binary"
+	"lab_4/framing"
+	"lab_4/linecode"
+	"slices"
+	"testing"
+	"time"
+)
+
+type block struct {
+	blockType uint32
+	body      []byte
+}
+
+// readBlocks splits a pcapng file into blocks, checking that the leading
+// and trailing lengths of each one agree.
+func readBlocks(t *testing.T, raw []byte) []block {
+	t.Helper()
+	var blocks []block
+	for len(raw) > 0 {
+		if len(raw) < 12 {
+			t.Fatalf("%d bytes left after the last block", len(raw))
+		}
+		blockType := binary.LittleEndian.Uint32(raw[0:4])
+		length := int(binary.LittleEndian.Uint32(raw[4:8]))
+		if length%4 != 0 || length < 12 || length > len(raw) {
+			t.Fatalf("block 0x%08x has length %d of %d bytes", blockType, length, len(raw))
+		}
+		if trailing := int(binary.LittleEndian.Uint32(raw[length-4 : length])); trailing != length {
+			t.Fatalf("block 0x%08x ends with length %d, want %d", blockType, trailing, length)
+		}
+		blocks = append(blocks, block{blockType: blockType, body: raw[8 : length-4]})
+		raw = raw[length:]
+	}
+	return blocks
+}
+
+func TestWriterLayout(t *testing.T) {
+	var output bytes.Buffer
+	w, err := NewWriter(&output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	at := time.UnixMicro(1_700_000_000_123_456)
+	events := []Event{
+		{Time: at, Type: EventFrame, Direction: Transmitted, Port: 1, Framing: "bits", LineCode: "none",
+			Data: []byte{1, 0, 0, 0, 0, 1, 1, 1, '\n'}},
+		{Time: at, Type: EventCollision, Direction: Received, Port: 2, Attempt: 3, Framing: "cobs",
+			LineCode: "manchester"},
+		{Time: at, Type: EventFrame, Direction: Received, Port: 3, Framing: "ppp", LineCode: "8b10b",
+			Data: []byte{0x7E, 0x01, 0x7D, 0x5E, 0x00, 0x00, 0x06, 0x7E}},
+		{Time: at, Type: EventIdle, Port: 4},
+	}
+	headers := [][]byte{
+		{HeaderVersion, 1, 0, 0, 0, 1, 0, 0, 0, 0, 0, 0},
+		{HeaderVersion, 3, 1, 3, 0, 2, 0, 3, 3, 0, 0, 0},
+		{HeaderVersion, 1, 1, 1, 0, 3, 0, 0, 6, 0, 0, 0},
+		{HeaderVersion, 5, 0, 255, 0, 4, 0, 0, 255, 0, 0, 0},
+	}
+	for _, event := range events {
+		if err := w.Write(event); err != nil {
+			t.Fatal(err)
+		}
+	}
+	blocks := readBlocks(t, output.Bytes())
+	if len(blocks) != 2+len(events) {
+		t.Fatalf("wrote %d blocks, want %d", len(blocks), 2+len(events))
+	}
+
+	section := blocks[0]
+	if section.blockType != blockSectionHeader {
+		t.Errorf("first block type 0x%08x, want a section header", section.blockType)
+	}
+	if magic := binary.LittleEndian.Uint32(section.body[0:4]); magic != byteOrderMagic {
+		t.Errorf("byte order magic 0x%08x", magic)
+	}
+	major := binary.LittleEndian.Uint16(section.body[4:6])
+	minor := binary.LittleEndian.Uint16(section.body[6:8])
+	if major != 1 || minor != 0 {
+		t.Errorf("section version %d.%d, want 1.0", major, minor)
+	}
+
+	iface := blocks[1]
+	if iface.blockType != blockInterface {
+		t.Errorf("second block type 0x%08x, want an interface description", iface.blockType)
+	}
+	if linkType := binary.LittleEndian.Uint16(iface.body[0:2]); linkType != LinkTypeUser0 {
+		t.Errorf("link type %d, want LINKTYPE_USER0", linkType)
+	}
+
+	for i, event := range events {
+		packet := blocks[2+i]
+		if packet.blockType != blockEnhancedPacket {
+			t.Fatalf("block %d type 0x%08x, want an enhanced packet", 2+i, packet.blockType)
+		}
+		body := packet.body
+		if id := binary.LittleEndian.Uint32(body[0:4]); id != 0 {
+			t.Errorf("event %d on interface %d", i, id)
+		}
+		micros := uint64(binary.LittleEndian.Uint32(body[4:8]))<<32 | uint64(binary.LittleEndian.Uint32(body[8:12]))
+		if micros != uint64(at.UnixMicro()) {
+			t.Errorf("event %d timestamp %d, want %d", i, micros, at.UnixMicro())
+		}
+		captured := int(binary.LittleEndian.Uint32(body[12:16]))
+		original := int(binary.LittleEndian.Uint32(body[16:20]))
+		if captured != HeaderSize+len(event.Data) || original != captured {
+			t.Fatalf("event %d lengths %d and %d, want %d", i, captured, original, HeaderSize+len(event.Data))
+		}
+		data := body[20 : 20+captured]
+		if !bytes.Equal(data[:HeaderSize], headers[i]) {
+			t.Errorf("event %d header % x, want % x", i, data[:HeaderSize], headers[i])
+		}
+		if !bytes.Equal(data[HeaderSize:], event.Data) {
+			t.Errorf("event %d data % x, want % x", i, data[HeaderSize:], event.Data)
+		}
+		options := body[20+len(pad(data)):]
+		flags := uint32(1)
+		if event.Direction == Transmitted {
+			flags = 2
+		}
+		wantOptions := append(option(optionEPBFlags, binary.LittleEndian.AppendUint32(nil, flags)),
+			option(optionEnd, nil)...)
+		if !bytes.Equal(options, wantOptions) {
+			t.Errorf("event %d options % x, want % x", i, options, wantOptions)
+		}
+	}
+}
+
+// The header numbers must follow the framings and line codes a link offers,
+// in their order, so the dissector can name them.
+func TestHeaderNames(t *testing.T) {
+	if !slices.Equal(Framings, framing.Names()) {
+		t.Errorf("Framings = %q, want %q", Framings, framing.Names())
+	}
+	if !slices.Equal(LineCodes, linecode.Names()) {
+		t.Errorf("LineCodes = %q, want %q", LineCodes, linecode.Names())
+	}
+}
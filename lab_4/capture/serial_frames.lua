@@ -0,0 +1,273 @@
+-- Wireshark dissector for captures written by lab_4/capture.
+--
+-- Copy to the Wireshark personal plugins folder (Help > About > Folders)
+-- and open the .pcapng file. Packets use LINKTYPE_USER0 (147); the 12-byte
+-- header is described in capture/pcapng.go. Frames are decoded with the
+-- framing the header names; the line code is only shown.
+
+local proto = Proto("serialframe", "Serial link frame")
+
+local events = {
+    [1] = "Frame",
+    [2] = "Jam",
+    [3] = "Collision",
+    [4] = "Abort",
+    [5] = "Idle",
+}
+local directions = { [0] = "Transmitted", [1] = "Received" }
+local framings = { [0] = "Lab bits", [1] = "PPP", [2] = "SLIP", [3] = "COBS" }
+local line_codes = {
+    [0] = "None",
+    [1] = "NRZ",
+    [2] = "NRZI",
+    [3] = "Manchester",
+    [4] = "Differential Manchester",
+    [5] = "4B/5B",
+    [6] = "8B/10B",
+}
+local header_size = 12
+
+local f = proto.fields
+f.version = ProtoField.uint8("serialframe.version", "Version")
+f.event = ProtoField.uint8("serialframe.event", "Event", base.DEC, events)
+f.direction = ProtoField.uint8("serialframe.direction", "Direction", base.DEC, directions)
+f.framing = ProtoField.uint8("serialframe.framing", "Framing", base.DEC, framings)
+f.line_code = ProtoField.uint8("serialframe.line_code", "Line code", base.DEC, line_codes)
+f.port = ProtoField.uint16("serialframe.port", "Port")
+f.attempt = ProtoField.uint16("serialframe.attempt", "Attempt")
+f.flag = ProtoField.string("serialframe.flag", "Flag")
+f.destination = ProtoField.string("serialframe.destination", "Destination")
+f.source = ProtoField.string("serialframe.source", "Source")
+f.data = ProtoField.string("serialframe.data", "Data")
+f.fcs = ProtoField.string("serialframe.fcs", "FCS")
+f.stuffed = ProtoField.uint8("serialframe.stuffed", "Stuffed bits")
+f.inserted = ProtoField.uint8("serialframe.inserted", "Inserted bytes")
+
+local function bit_string(bits, first, last)
+    local text = {}
+    for i = first, last do
+        local bit = bits[i]
+        if bit == 10 then
+            text[#text + 1] = "\\n"
+        elseif bit ~= nil then
+            text[#text + 1] = tostring(bit)
+        end
+    end
+    return table.concat(text)
+end
+
+-- Mirrors stuffing.Decoder with the lab rule: the window starts with the
+-- tail of the flag and a 0 follows every 1000011 on the line.
+local function destuff(bits)
+    local pattern = { 1, 0, 0, 0, 0, 1, 1 }
+    local window = { 0, 0, 0, 0, 1, 1, 1 }
+    local result = {}
+    for i = 1, math.min(8, #bits) do
+        result[i] = bits[i]
+    end
+    local stuffed = 0
+    local pending = false
+    for i = 9, #bits do
+        local bit = bits[i]
+        table.remove(window, 1)
+        window[#window + 1] = bit
+        if pending then
+            pending = false
+            if bit ~= 0 then
+                break
+            end
+            stuffed = stuffed + 1
+        else
+            result[#result + 1] = bit
+            pending = true
+            for j = 1, 7 do
+                if window[j] ~= pattern[j] then
+                    pending = false
+                    break
+                end
+            end
+        end
+    end
+    return result, stuffed
+end
+
+-- The payload between the first two delimiters of a frame of the byte
+-- framings, as framing.delimited finds it.
+local function delimited(raw, delimiter)
+    local start = nil
+    for i = 1, #raw do
+        if raw[i] == delimiter then
+            if start ~= nil and i > start + 1 then
+                local body = {}
+                for j = start + 1, i - 1 do
+                    body[#body + 1] = raw[j]
+                end
+                return body
+            end
+            start = i
+        end
+    end
+    return nil
+end
+
+local escapes = {
+    [1] = { delimiter = 0x7E, escape = 0x7D, original = { [0x5E] = 0x7E, [0x5D] = 0x7D } },
+    [2] = { delimiter = 0xC0, escape = 0xDB, original = { [0xDC] = 0xC0, [0xDD] = 0xDB } },
+}
+
+-- Mirrors the PPP and SLIP framers: every escape byte and the one after it
+-- stand for one payload byte.
+local function unescape(raw, rule)
+    local body = delimited(raw, rule.delimiter)
+    if body == nil then
+        return nil, 0
+    end
+    local payload = {}
+    local inserted = 0
+    local i = 1
+    while i <= #body do
+        local byte = body[i]
+        if byte == rule.escape then
+            i = i + 1
+            byte = rule.original[body[i]]
+            if byte == nil then
+                return nil, inserted
+            end
+            inserted = inserted + 1
+        end
+        payload[#payload + 1] = byte
+        i = i + 1
+    end
+    return payload, inserted
+end
+
+-- Mirrors the COBS framer: every code byte but the leading one and those
+-- after a full block stands for a zero.
+local function cobs_decode(raw)
+    local body = delimited(raw, 0)
+    if body == nil then
+        return nil, 0
+    end
+    local payload = {}
+    local inserted = 0
+    local previous = 0xFF
+    local i = 1
+    while i <= #body do
+        local code = body[i]
+        if i + code - 1 > #body then
+            return nil, inserted
+        end
+        if previous == 0xFF then
+            inserted = inserted + 1
+        end
+        for j = i + 1, i + code - 1 do
+            payload[#payload + 1] = body[j]
+        end
+        i = i + code
+        if code < 0xFF and i <= #body then
+            payload[#payload + 1] = 0
+        end
+        previous = code
+    end
+    return payload, inserted
+end
+
+-- The bits of value, highest first, with '\n' where newlines has a 1.
+local function packed_bits(value, count, newlines)
+    local text = {}
+    for i = count - 1, 0, -1 do
+        local weight = 2 ^ i
+        if newlines ~= nil and math.floor(newlines / weight) % 2 == 1 then
+            text[#text + 1] = "\\n"
+        elseif math.floor(value / weight) % 2 == 1 then
+            text[#text + 1] = "1"
+        else
+            text[#text + 1] = "0"
+        end
+    end
+    return table.concat(text)
+end
+
+-- The fields of a lab frame, one bit per byte after de-stuffing.
+local function bit_fields(raw)
+    local bits, stuffed = destuff(raw)
+    return {
+        flag = bit_string(bits, 1, 8),
+        destination = bit_string(bits, 9, 12),
+        source = bit_string(bits, 13, 16),
+        data = bit_string(bits, 17, 23),
+        fcs = bit_string(bits, 24, 27),
+    }, stuffed
+end
+
+-- The fields of a frame of the byte framings, packed as Packet.Payload
+-- does: address, data, newline mask of the data and FCS.
+local function byte_fields(raw, framing)
+    local payload, inserted
+    if framing == 3 then
+        payload, inserted = cobs_decode(raw)
+    else
+        payload, inserted = unescape(raw, escapes[framing])
+    end
+    if payload == nil or #payload ~= 4 then
+        return nil, inserted
+    end
+    return {
+        destination = packed_bits(math.floor(payload[1] / 16), 4),
+        source = packed_bits(payload[1] % 16, 4),
+        data = packed_bits(payload[2], 7, payload[3]),
+        fcs = packed_bits(payload[4], 4),
+    }, inserted
+end
+
+function proto.dissector(buffer, pinfo, tree)
+    if buffer:len() < header_size then
+        return 0
+    end
+    pinfo.cols.protocol = "SERIAL"
+    local subtree = tree:add(proto, buffer(), "Serial link event")
+    local event = buffer(1, 1):uint()
+    local direction = buffer(2, 1):uint()
+    local framing = buffer(3, 1):uint()
+    subtree:add(f.version, buffer(0, 1))
+    subtree:add(f.event, buffer(1, 1))
+    subtree:add(f.direction, buffer(2, 1))
+    subtree:add(f.framing, buffer(3, 1))
+    subtree:add(f.port, buffer(4, 2))
+    subtree:add(f.attempt, buffer(6, 2))
+    subtree:add(f.line_code, buffer(8, 1))
+    local info = (directions[direction] or "?") .. " " .. (events[event] or "Unknown")
+    if event == 1 and buffer:len() > header_size then
+        local raw = {}
+        for i = header_size, buffer:len() - 1 do
+            raw[#raw + 1] = buffer(i, 1):uint()
+        end
+        local payload = buffer(header_size)
+        local frame = subtree:add(payload, "Frame")
+        local fields
+        if framing == 0 then
+            local stuffed
+            fields, stuffed = bit_fields(raw)
+            frame:add(f.flag, payload, fields.flag)
+            frame:add(f.stuffed, stuffed)
+        elseif framings[framing] ~= nil then
+            local inserted
+            fields, inserted = byte_fields(raw, framing)
+            frame:add(f.inserted, inserted)
+        end
+        if fields == nil then
+            frame:append_text(" (not decoded)")
+            info = info .. " undecoded"
+        else
+            frame:add(f.destination, payload, fields.destination)
+            frame:add(f.source, payload, fields.source)
+            frame:add(f.data, payload, fields.data)
+            frame:add(f.fcs, payload, fields.fcs)
+            info = info .. " data=" .. fields.data
+        end
+    end
+    pinfo.cols.info = info
+    return buffer:len()
+end
+
+DissectorTable.get("wtap_encap"):add(wtap.USER0, proto)
@@ -0,0 +1,290 @@
+// Package config keeps named profiles of link settings in a TOML file:
+// port speed, the chances the channel and distortion simulations use, the
+// collision limits, framing, line code and FCS mode. Profiles missing from the file
+// come from the built-in ones, and keys missing from a profile keep the
+// values of DefaultProfile.
+package config
+
+import (
+	"errors"
+	"fmt"
+	"github.com/BurntSushi/toml"
+	"lab_4/framing"
+	"lab_4/linecode"
+	"lab_4/settings"
+	"lab_4/stack"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+var (
+	ErrUnknownProfile = errors.New("Unknown profile")
+	ErrNoName         = errors.New("Profile needs a name")
+)
+
+const DefaultProfile = "lab4-csmacd"
+
+type Profile struct {
+	BaudRate         int           `toml:"baud_rate"`
+	DataBits         int           `toml:"data_bits"`
+	BusyChance       int           `toml:"busy_chance"`
+	CollisionChance  int           `toml:"collision_chance"`
+	DistortionChance int           `toml:"distortion_chance"`
+	MaxAttempts      int           `toml:"max_attempts"`
+	BackoffLimit     int           `toml:"backoff_limit"`
+	SlotTime         time.Duration `toml:"slot_time"`
+	Framing          string        `toml:"framing"`
+	LineCode         string        `toml:"line_code"`
+	FCS              string        `toml:"fcs"`
+}
+
+var Builtin = map[string]Profile{
+	DefaultProfile: {
+		BaudRate:         115200,
+		DataBits:         7,
+		BusyChance:       70,
+		CollisionChance:  30,
+		DistortionChance: 30,
+		MaxAttempts:      16,
+		BackoffLimit:     10,
+		SlotTime:         time.Millisecond,
+		Framing:          framing.Lab.Name(),
+		LineCode:         linecode.None.Name(),
+		FCS:              settings.FCSCorrect.String(),
+	},
+	"lab4-csmacd-noisy": {
+		BaudRate:         115200,
+		DataBits:         7,
+		BusyChance:       85,
+		CollisionChance:  60,
+		DistortionChance: 80,
+		MaxAttempts:      16,
+		BackoffLimit:     10,
+		SlotTime:         time.Millisecond,
+		Framing:          framing.Lab.Name(),
+		LineCode:         linecode.None.Name(),
+		FCS:              settings.FCSCorrect.String(),
+	},
+	"lab3-hamming": {
+		BaudRate:         115200,
+		DataBits:         7,
+		BusyChance:       0,
+		CollisionChance:  0,
+		DistortionChance: 30,
+		MaxAttempts:      16,
+		BackoffLimit:     10,
+		SlotTime:         time.Millisecond,
+		Framing:          framing.Lab.Name(),
+		LineCode:         linecode.None.Name(),
+		FCS:              settings.FCSCorrect.String(),
+	},
+}
+
+// FieldError is a value of a profile that cannot be used.
+type FieldError struct {
+	Profile string
+	Field   string
+	Err     error
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s.%s: %v", e.Profile, e.Field, e.Err)
+}
+
+func (e *FieldError) Unwrap() error {
+	return e.Err
+}
+
+func checkRange(field string, value int, limits settings.Range) *FieldError {
+	if value < limits.Min || value > limits.Max {
+		return &FieldError{Field: field, Err: fmt.Errorf("Must be from %d to %d", limits.Min, limits.Max)}
+	}
+	return nil
+}
+
+// Validate returns an error for every field of p that cannot be used,
+// keyed as in the file.
+func (p Profile) Validate() []*FieldError {
+	var errs []*FieldError
+	add := func(err *FieldError) {
+		if err != nil {
+			errs = append(errs, err)
+		}
+	}
+	add(checkRange("baud_rate", p.BaudRate, settings.Range{Min: 50, Max: 4000000}))
+	if p.DataBits != 7 {
+		add(&FieldError{Field: "data_bits", Err: errors.New("Packets and the Hamming code carry 7 data bits")})
+	}
+	add(checkRange("busy_chance", p.BusyChance, settings.BusyChanceRange))
+	add(checkRange("collision_chance", p.CollisionChance, settings.CollisionChanceRange))
+	add(checkRange("distortion_chance", p.DistortionChance, settings.DistortionChanceRange))
+	add(checkRange("max_attempts", p.MaxAttempts, settings.MaxAttemptsRange))
+	add(checkRange("backoff_limit", p.BackoffLimit, settings.BackoffLimitRange))
+	if p.SlotTime <= 0 || p.SlotTime > time.Second {
+		add(&FieldError{Field: "slot_time", Err: errors.New("Must be from 1ns to 1s")})
+	}
+	if _, err := framing.ByName(p.Framing); err != nil {
+		add(&FieldError{Field: "framing", Err: err})
+	}
+	if _, err := linecode.ByName(p.LineCode); err != nil {
+		add(&FieldError{Field: "line_code", Err: err})
+	}
+	if _, err := settings.ParseFCSMode(p.FCS); err != nil {
+		add(&FieldError{Field: "fcs", Err: err})
+	}
+	return errs
+}
+
+// Link gives the channel and error control settings of a validated
+// profile.
+func (p Profile) Link() settings.Link {
+	fcs, _ := settings.ParseFCSMode(p.FCS)
+	return settings.Link{
+		BusyChance:       p.BusyChance,
+		CollisionChance:  p.CollisionChance,
+		DistortionChance: p.DistortionChance,
+		MaxAttempts:      p.MaxAttempts,
+		SlotTime:         p.SlotTime,
+		BackoffLimit:     p.BackoffLimit,
+		FCS:              fcs,
+	}
+}
+
+// Stack opens a protocol stack for a link with the profile.
+func (p Profile) Stack() (*stack.Stack, error) {
+	framer, err := framing.ByName(p.Framing)
+	if err != nil {
+		return nil, err
+	}
+	code, err := linecode.ByName(p.LineCode)
+	if err != nil {
+		return nil, err
+	}
+	return stack.New(framer, code, p.BaudRate, p.Link()), nil
+}
+
+// File is the configuration file: the profile used at startup and every
+// profile by name.
+type File struct {
+	Profile  string             `toml:"profile"`
+	Profiles map[string]Profile `toml:"profiles"`
+}
+
+func Default() *File {
+	f := &File{Profile: DefaultProfile, Profiles: make(map[string]Profile)}
+	for name, profile := range Builtin {
+		f.Profiles[name] = profile
+	}
+	return f
+}
+
+// DefaultPath is config.toml in the user configuration directory.
+func DefaultPath() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "lab_4", "config.toml")
+}
+
+// Load reads the file at path; a missing file gives the built-in
+// profiles. Unknown keys and invalid values are errors.
+func Load(path string) (*File, error) {
+	f := Default()
+	if path == "" {
+		return f, nil
+	}
+	var raw struct {
+		Profile  string                    `toml:"profile"`
+		Profiles map[string]toml.Primitive `toml:"profiles"`
+	}
+	meta, err := toml.DecodeFile(path, &raw)
+	if errors.Is(err, os.ErrNotExist) {
+		return f, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	if raw.Profile != "" {
+		f.Profile = raw.Profile
+	}
+	var errs []error
+	for name, primitive := range raw.Profiles {
+		profile, ok := Builtin[name]
+		if !ok {
+			profile = Builtin[DefaultProfile]
+		}
+		err := meta.PrimitiveDecode(primitive, &profile)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("profiles.%s: %w", name, err))
+			continue
+		}
+		f.Profiles[name] = profile
+	}
+	for _, key := range meta.Undecoded() {
+		errs = append(errs, fmt.Errorf("Unknown key %s", key))
+	}
+	for _, name := range f.Names() {
+		for _, err := range f.Profiles[name].Validate() {
+			err.Profile = name
+			errs = append(errs, err)
+		}
+	}
+	if _, ok := f.Profiles[f.Profile]; !ok {
+		errs = append(errs, fmt.Errorf("profile %q: %w", f.Profile, ErrUnknownProfile))
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("%s: %w", path, errors.Join(errs...))
+	}
+	return f, nil
+}
+
+func (f *File) Save(path string) error {
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return err
+	}
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(file, "# Link session profiles, see -profile")
+	if err == nil {
+		err = toml.NewEncoder(file).Encode(f)
+	}
+	return errors.Join(err, file.Close())
+}
+
+func (f *File) Names() []string {
+	names := make([]string, 0, len(f.Profiles))
+	for name := range f.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (f *File) Get(name string) (Profile, error) {
+	profile, ok := f.Profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("%q: %w", name, ErrUnknownProfile)
+	}
+	return profile, nil
+}
+
+// Set stores a valid profile under name.
+func (f *File) Set(name string, profile Profile) []*FieldError {
+	if name == "" {
+		return []*FieldError{{Field: "name", Err: ErrNoName}}
+	}
+	errs := profile.Validate()
+	for _, err := range errs {
+		err.Profile = name
+	}
+	if len(errs) == 0 {
+		f.Profiles[name] = profile
+	}
+	return errs
+}
@@ -0,0 +1,138 @@
+package config
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, text string) string {
+	path := filepath.Join(t.TempDir(), "config.toml")
+	if err := os.WriteFile(path, []byte(text), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestBuiltinProfilesAreValid(t *testing.T) {
+	for name, profile := range Builtin {
+		if errs := profile.Validate(); len(errs) != 0 {
+			t.Errorf("%s: %v", name, errs)
+		}
+	}
+}
+
+func TestProfileStack(t *testing.T) {
+	profile := Builtin["lab3-hamming"]
+	profile.Framing = "cobs"
+	profile.LineCode = "manchester"
+	s, err := profile.Stack()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Framer.Name() != "cobs" || s.Code.Name() != "manchester" || s.BaudRate != profile.BaudRate {
+		t.Errorf("Stack() = %s, %s at %d baud", s.Framer.Name(), s.Code.Name(), s.BaudRate)
+	}
+	if s.Settings.Current() != profile.Link() {
+		t.Errorf("Stack() settings = %+v, want %+v", s.Settings.Current(), profile.Link())
+	}
+}
+
+func TestLoadMissingFile(t *testing.T) {
+	file, err := Load(filepath.Join(t.TempDir(), "missing.toml"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if file.Profile != DefaultProfile || len(file.Profiles) != len(Builtin) {
+		t.Errorf("Load() = %+v, want the built-in profiles", file)
+	}
+}
+
+func TestLoadMergesProfiles(t *testing.T) {
+	path := writeConfig(t, `
+profile = "slow"
+
+[profiles.slow]
+baud_rate = 9600
+slot_time = "5ms"
+
+[profiles.lab3-hamming]
+distortion_chance = 0
+`)
+	file, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slow, err := file.Get(file.Profile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Builtin[DefaultProfile]
+	want.BaudRate = 9600
+	want.SlotTime = 5 * time.Millisecond
+	if slow != want {
+		t.Errorf("slow = %+v, want %+v", slow, want)
+	}
+	hamming, _ := file.Get("lab3-hamming")
+	if hamming.DistortionChance != 0 || hamming.BusyChance != 0 {
+		t.Errorf("lab3-hamming = %+v", hamming)
+	}
+	if _, ok := file.Profiles["lab4-csmacd-noisy"]; !ok {
+		t.Error("built-in profile missing")
+	}
+}
+
+func TestLoadReportsEveryField(t *testing.T) {
+	path := writeConfig(t, `
+profile = "nowhere"
+
+[profiles.broken]
+busy_chance = 100
+data_bits = 8
+framing = "hdlc"
+colision_chance = 10
+`)
+	_, err := Load(path)
+	if err == nil {
+		t.Fatal("Load() accepted a broken file")
+	}
+	for _, part := range []string{"broken.busy_chance", "broken.data_bits", "broken.framing",
+		"profiles.broken.colision_chance", `"nowhere"`} {
+		if !strings.Contains(err.Error(), part) {
+			t.Errorf("error does not mention %s:\n%v", part, err)
+		}
+	}
+	var fieldErr *FieldError
+	if !errors.As(err, &fieldErr) {
+		t.Errorf("error %v has no FieldError", err)
+	}
+}
+
+func TestSaveLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lab_4", "config.toml")
+	file := Default()
+	custom := Builtin[DefaultProfile]
+	custom.CollisionChance = 55
+	custom.LineCode = "manchester"
+	if errs := file.Set("custom", custom); len(errs) != 0 {
+		t.Fatal(errs)
+	}
+	file.Profile = "custom"
+	if err := file.Save(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := loaded.Get("custom"); loaded.Profile != "custom" || got != custom {
+		t.Errorf("loaded %q %+v, want %+v", loaded.Profile, got, custom)
+	}
+	custom.MaxAttempts = 0
+	if errs := file.Set("custom", custom); len(errs) != 1 || errs[0].Field != "max_attempts" {
+		t.Errorf("Set() = %v, want a max_attempts error", errs)
+	}
+}
@@ -2,67 +2,181 @@ package csma_cd
 
 import (
 	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"lab_4/capture"
+	"lab_4/framing"
 	"lab_4/gui"
+	"lab_4/linecode"
+	"lab_4/logging"
+	"lab_4/metrics"
 	"lab_4/packet"
 	"lab_4/rs232"
-	"log"
+	"lab_4/settings"
+	"lab_4/stack"
 	"math"
-	"math/rand"
+	"strconv"
 	"time"
 )
 
-func ChannelBusy() bool {
-	return packet.Chance(70)
+var logger = logging.For("csma_cd")
+
+func ChannelBusy(link settings.Link) bool {
+	return packet.Chance(link.BusyChance)
 }
 
-func Collision() bool {
-	return packet.Chance(30)
+func Collision(link settings.Link) bool {
+	return packet.Chance(link.CollisionChance)
 }
 
-func Delay(attempts int) {
-	//log.Printf("Random delay for %d attempts", attempts)
-	if attempts > 10 {
-		attempts = 10
+var ErrTooManyCollisions = errors.New("Too many collisions")
+
+// Delay waits a random number of slot times, up to 2^BackoffLimit of them.
+func Delay(ctx context.Context, link settings.Link, attempts int) error {
+	logger.Debug("Random delay", "attempts", attempts)
+	if attempts > link.BackoffLimit {
+		attempts = link.BackoffLimit
+	}
+	times := packet.Random(int(math.Pow(2, float64(attempts))))
+	logger.Info("Random delay", "slots", times)
+	select {
+	case <-time.After(time.Duration(times) * link.SlotTime):
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
 	}
-	source := rand.NewSource(time.Now().UnixNano())
-	random := rand.New(source)
-	times := random.Intn(int(math.Pow(2, float64(attempts))))
-	log.Printf("Random delay: %d ms", times)
-	time.Sleep(time.Duration(times) * time.Millisecond)
 }
 
-func Transmitter(rawPacket []byte, formattedPacket string, u *gui.UserInterface) {
+func Transmitter(ctx context.Context, s *stack.Stack, rawPacket []byte, formattedPacket string,
+	output rs232.Sink, events gui.Publisher) error {
 	collisionInfo := ""
 	transmittedBytes := 0
+	port, _ := output.PortNumber()
+	link := s.Settings.Current()
+	encoder := s.Code.NewEncoder()
+	var symbols []byte
+	fields := packet.FrameFields(s.Framer, rawPacket)
+	span := func(kind gui.SpanKind, field packet.Field, start time.Time) {
+		events.Publish(gui.TimelineSpan{Kind: kind, Field: field, Start: start, End: time.Now()})
+	}
+	span(gui.SpanFrame, packet.FieldFlag, time.Now())
 	for transmittedBytes < len(rawPacket) {
 		attempts := 0
-		for attempts <= 16 {
-			if !ChannelBusy() {
-				//log.Printf("Channel is free")
-				err := u.InputPort.WriteBytes(rawPacket[transmittedBytes : transmittedBytes+1])
+		for attempts <= link.MaxAttempts {
+			if ctx.Err() != nil {
+				return abort(s, output, events, ctx.Err())
+			}
+			if !ChannelBusy(link) {
+				logger.Debug("Channel is free")
+				unit := encoder.Encode(rawPacket[transmittedBytes])
+				start := time.Now()
+				err := output.WriteBytes(EncodeLine(unit))
+				span(gui.SpanByte, fields[transmittedBytes], start)
 				if err != nil {
-					gui.ErrorWindow(err, u.App)
+					events.Publish(gui.Error{Err: err})
 				}
-				if Collision() {
+				if Collision(link) {
 					attempts++
-					//log.Printf("Transmitting collision")
+					span(gui.SpanCollision, fields[transmittedBytes], time.Now())
+					s.Stats.Collision(wireBits(s, 1))
+					metrics.Collisions.With(strconv.Itoa(port)).Inc()
+					logger.Debug("Transmitting collision", "attempts", attempts)
 					collisionInfo += "!"
-					u.UpdateStatus(formattedPacket + " " + collisionInfo)
-					err = u.InputPort.WriteBytes([]byte("j"))
+					events.Publish(gui.Collision{Status: formattedPacket + " " + collisionInfo})
+					record(s, capture.Event{Type: capture.EventCollision, Port: port, Attempt: attempts})
+					start = time.Now()
+					err = output.WriteBytes(ControlSignal(SymbolJam))
+					span(gui.SpanJam, fields[transmittedBytes], start)
+					record(s, capture.Event{Type: capture.EventJam, Port: port, Attempt: attempts})
+					if err != nil {
+						events.Publish(gui.Error{Err: err})
+					}
+					start = time.Now()
+					err = Delay(ctx, link, attempts)
+					span(gui.SpanBackoff, fields[transmittedBytes], start)
+					s.Stats.Backoff(time.Since(start))
+					metrics.Backoff.ObserveDuration(time.Since(start))
 					if err != nil {
-						gui.ErrorWindow(err, u.App)
+						return abort(s, output, events, err)
 					}
-					Delay(attempts)
 				} else {
 					collisionInfo += ". "
+					metrics.Attempts.Observe(float64(attempts + 1))
 					transmittedBytes++
+					symbols = append(symbols, unit...)
 					break
 				}
 			}
 		}
-		u.TransmittedBytes++
-		u.UpdateStatus(formattedPacket + " " + collisionInfo)
+		if attempts > link.MaxAttempts {
+			return abort(s, output, events, ErrTooManyCollisions)
+		}
+		events.Publish(gui.ByteSent{Status: formattedPacket + " " + collisionInfo})
+	}
+	s.Stats.FrameSent(payloadBits, wireBits(s, len(rawPacket)))
+	metrics.FramesTransmitted.With(strconv.Itoa(port), "sent").Inc()
+	events.Publish(gui.FrameSent{Status: formattedPacket + " " + collisionInfo})
+	events.Publish(gui.SymbolsSent{Code: s.Code.Name(), Symbols: symbols})
+	record(s, capture.Event{Type: capture.EventFrame, Port: port, Data: rawPacket})
+	record(s, capture.Event{Type: capture.EventIdle, Port: port})
+	start := time.Now()
+	err := output.WriteBytes(ControlSignal(SymbolIdle))
+	span(gui.SpanIdle, packet.FieldFlag, start)
+	return err
+}
+
+// Inject puts a composed frame on the line in one write, line coded and
+// followed by the idle symbol, without listening to the channel first. A
+// frame being transmitted at the same time is broken by it.
+func Inject(s *stack.Stack, output rs232.Sink, frame []byte) error {
+	port, _ := output.PortNumber()
+	encoder := s.Code.NewEncoder()
+	var line []byte
+	for _, b := range frame {
+		line = append(line, EncodeLine(encoder.Encode(b))...)
+	}
+	line = append(line, ControlSignal(SymbolIdle)...)
+	logger.Info("Injecting frame", "bytes", len(frame), "port", port)
+	record(s, capture.Event{Type: capture.EventFrame, Port: port, Data: frame})
+	return output.WriteBytes(line)
+}
+
+// payloadBits is the data carried by one frame.
+const payloadBits = 7
+
+// wireBits is how many bit times frame bytes take on the line: a line
+// symbol each, or uncoded one per lab bit and eight per byte otherwise.
+func wireBits(s *stack.Stack, frameBytes int) int {
+	if s.Code != linecode.None {
+		return frameBytes * s.Code.SymbolsPerByte()
+	}
+	if _, ok := s.Framer.(framing.Bits); ok {
+		return frameBytes
 	}
+	return 8 * frameBytes
+}
+
+func abort(s *stack.Stack, output rs232.Sink, events gui.Publisher, reason error) error {
+	logger.Warn("Packet aborted", "reason", reason)
+	s.Stats.FrameAborted()
+	port, _ := output.PortNumber()
+	metrics.FramesTransmitted.With(strconv.Itoa(port), "aborted").Inc()
+	record(s, capture.Event{Type: capture.EventAbort, Port: port})
+	start := time.Now()
+	err := output.WriteBytes(ControlSignal(SymbolAbort))
+	events.Publish(gui.TimelineSpan{Kind: gui.SpanAbort, Start: start, End: time.Now()})
+	if err != nil {
+		return errors.Join(reason, err)
+	}
+	return reason
+}
+
+// record captures an event of the link of s.
+func record(s *stack.Stack, event capture.Event) {
+	event.Framing = s.Framer.Name()
+	event.LineCode = s.Code.Name()
+	capture.Record(event)
 }
 
 func CleanPacketPrefix(rawData []byte) []byte {
@@ -74,52 +188,168 @@ func CleanPacketPrefix(rawData []byte) []byte {
 	return rawData
 }
 
+// CheckPacket reports whether rawData ends with a whole lab frame.
 func CheckPacket(rawData []byte) bool {
-	length := len(rawData)
-	lenPacket := 26
-	if length >= 26 {
-		rawData = CleanPacketPrefix(rawData)
-		length = len(rawData)
-		if length <= 28 && bytes.Equal(rawData[:8], []byte{1, 0, 0, 0, 0, 1, 1, 1}) {
-			for i := 7; i < length; i++ {
-				if i+8 <= length && bytes.Equal(rawData[i:i+7], []byte{1, 0, 0, 0, 0, 1, 1}) {
-					lenPacket += 1
-					i += 6
-				}
-			}
-			if length == lenPacket {
-				return true
-			}
+	rawData = CleanPacketPrefix(rawData)
+	_, n, err := framing.Lab.Next(rawData)
+	return err == nil && n > 0 && n == len(rawData)
+}
+
+// Receiver decodes the frames of one link. Its symbol and line decoders
+// keep their state from one frame to the next, so a control signal or a
+// line symbol split across the reads of two frames is not lost, and the
+// bytes after a frame wait for the next call, so a chunk may hold several
+// frames. Jams and aborts are counted in the stats of the link.
+type Receiver struct {
+	stack       *stack.Stack
+	chunks      <-chan rs232.Chunk
+	decoder     SymbolDecoder
+	lineDecoder *linecode.Decoder
+	line        []byte
+	port        int
+	rawPacket   []byte
+	idle        bool
+}
+
+type receivedFrame struct {
+	payload []byte
+	raw     []byte
+	err     error
+}
+
+func NewReceiver(s *stack.Stack, chunks <-chan rs232.Chunk) *Receiver {
+	return &Receiver{stack: s, chunks: chunks, lineDecoder: s.Code.NewDecoder()}
+}
+
+// Next returns the data of the next frame of the link.
+func (r *Receiver) Next(ctx context.Context) (string, error) {
+	for {
+		if frame, ok := r.decode(); ok {
+			return r.parse(frame)
+		}
+		var chunk rs232.Chunk
+		var ok bool
+		select {
+		case chunk, ok = <-r.chunks:
+		case <-ctx.Done():
+			return "", ctx.Err()
+		}
+		if !ok {
+			return "", rs232.ErrPortClosed
 		}
+		if chunk.Err != nil {
+			return "", chunk.Err
+		}
+		r.line = chunk.Data
+		r.port = chunk.Port
 	}
-	return false
 }
 
-func Receiver(outputPort *rs232.Port) (string, error) {
-	newText := ""
-	rawPacket := make([]byte, 0)
-	for !CheckPacket(rawPacket) {
-		rawData, err := outputPort.ReadBytes()
-		if err != nil && err.Error() != "Port has been closed" {
-			return "", err
+// decode feeds the line bytes left of the last chunk to the decoders until
+// a frame is complete. A jam or an abort applies to the bytes received so
+// far, so a frame is only taken once the data of the next one or the idle
+// symbol arrives, when its last byte can no longer be jammed.
+func (r *Receiver) decode() (receivedFrame, bool) {
+	if r.idle {
+		if frame, ok := r.take(); ok {
+			return frame, true
 		}
-		if len(rawData) < 1 {
+		r.idle = false
+	}
+	for len(r.line) > 0 {
+		symbol, ok := r.decoder.Decode(r.line[0])
+		r.line = r.line[1:]
+		if !ok {
 			continue
 		}
-		for bitNum := range rawData {
-			if rawData[bitNum] == 'j' && len(rawPacket) > 0 {
-				//log.Printf("Receiving collision")
-				rawPacket = rawPacket[0 : len(rawPacket)-1]
-			} else {
-				rawPacket = append(rawPacket, rawData[bitNum])
+		if !symbol.Control {
+			value, ok, err := r.lineDecoder.Decode(symbol.Value)
+			if err != nil {
+				logger.Warn("Byte dropped", "reason", err)
+			}
+			if !ok {
+				continue
+			}
+			frame, complete := r.take()
+			r.rawPacket = append(r.rawPacket, value)
+			if complete {
+				return frame, true
 			}
+			continue
+		}
+		if symbol.Value == SymbolIdle || symbol.Value == SymbolAbort {
+			r.lineDecoder.Reset()
 		}
+		r.rawPacket = handleControl(r.stack, symbol.Value, r.rawPacket, r.port)
+		if symbol.Value == SymbolIdle {
+			if frame, ok := r.take(); ok {
+				// More frames may have come before the idle symbol.
+				r.idle = true
+				return frame, true
+			}
+		}
+	}
+	return receivedFrame{}, false
+}
+
+func (r *Receiver) take() (receivedFrame, bool) {
+	payload, n, err := r.stack.Framer.Next(r.rawPacket)
+	if n == 0 {
+		return receivedFrame{}, false
+	}
+	frame := receivedFrame{payload: payload, raw: r.rawPacket[:n:n], err: err}
+	r.rawPacket = r.rawPacket[n:]
+	return frame, true
+}
+
+func (r *Receiver) parse(frame receivedFrame) (string, error) {
+	s := r.stack
+	record(s, capture.Event{Type: capture.EventFrame, Direction: capture.Received,
+		Port: r.port, Data: frame.raw})
+	if frame.err != nil {
+		metrics.FramesDecoded.With(s.Framer.Name(), "invalid_frame").Inc()
+		s.Stats.FrameDropped()
+		return "", frame.err
 	}
-	rawPacket = CleanPacketPrefix(rawPacket)
-	data, err := packet.DeserializePacket(rawPacket)
+	data, err := packet.ParsePayload(s, frame.payload)
 	if err != nil {
-		return newText, err
+		s.Stats.FrameDropped()
+		return "", err
+	}
+	s.Stats.FrameReceived()
+	return data, nil
+}
+
+func handleControl(s *stack.Stack, symbol byte, rawPacket []byte, port int) []byte {
+	event := capture.Event{Direction: capture.Received, Port: port}
+	switch symbol {
+	case SymbolJam:
+		event.Type = capture.EventJam
+	case SymbolAbort:
+		event.Type = capture.EventAbort
+	case SymbolIdle:
+		event.Type = capture.EventIdle
+	}
+	if event.Type != 0 {
+		record(s, event)
+	}
+	switch symbol {
+	case SymbolJam:
+		s.Stats.JamReceived()
+		if len(rawPacket) == 0 {
+			logger.Info("Jam received before data")
+			return rawPacket
+		}
+		logger.Info("Jam received")
+		return rawPacket[:len(rawPacket)-1]
+	case SymbolAbort:
+		s.Stats.AbortReceived()
+		logger.Warn("Packet aborted by transmitter")
+		return rawPacket[:0]
+	case SymbolIdle:
+		return rawPacket
+	default:
+		logger.Warn("Unknown control symbol", "symbol", fmt.Sprintf("0x%02x", symbol))
+		return rawPacket
 	}
-	newText += data
-	return newText, nil
 }
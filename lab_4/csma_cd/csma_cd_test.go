@@ -0,0 +1,409 @@
+package csma_cd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"lab_4/framing"
+	"lab_4/gui"
+	"lab_4/linecode"
+	"lab_4/metrics"
+	"lab_4/packet"
+	"lab_4/rs232"
+	"lab_4/settings"
+	"lab_4/stack"
+	"testing"
+)
+
+var flag = []byte{1, 0, 0, 0, 0, 1, 1, 1}
+
+func newStack(code linecode.Code) *stack.Stack {
+	return stack.New(framing.Lab, code, 115200, settings.Default)
+}
+
+func stuffedPacket(source int, data string) []byte {
+	p := packet.NewPacket(source, data)
+	p.GetHammingFCS()
+	return packet.BitStuffing(p)
+}
+
+func TestCheckPacket(t *testing.T) {
+	tests := []struct {
+		name    string
+		rawData []byte
+		want    bool
+	}{
+		{"plain packet", stuffedPacket(1, "0000000"), true},
+		{"one stuffed bit", stuffedPacket(1, "0000110"), true},
+		{"two stuffed bits", stuffedPacket(12, "0111000"), true},
+		{"garbage before packet", append([]byte{0, 1, 1, 0}, stuffedPacket(1, "1111111")...), true},
+		{"too short", stuffedPacket(1, "0000000")[:26], false},
+		{"missing stuffed bit", stuffedPacket(1, "0000110")[:27], false},
+		{"no flag", make([]byte, 27), false},
+		{"too long", append(stuffedPacket(1, "0000000"), 0, 0, 0), false},
+		{"empty", nil, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := CheckPacket(append([]byte(nil), test.rawData...)); got != test.want {
+				t.Errorf("CheckPacket(%s) = %v, want %v", packet.DataToStr(test.rawData), got, test.want)
+			}
+		})
+	}
+}
+
+func TestCleanPacketPrefix(t *testing.T) {
+	frame := stuffedPacket(1, "0101010")
+	tests := []struct {
+		name    string
+		rawData []byte
+		want    []byte
+	}{
+		{"starts with flag", frame, frame},
+		{"garbage before flag", append([]byte{1, 1, 0}, frame...), frame},
+		{"no flag", []byte{0, 1, 0, 1}, []byte{0, 1, 0, 1}},
+		{"empty", nil, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := CleanPacketPrefix(test.rawData)
+			if !bytes.Equal(got, test.want) {
+				t.Errorf("CleanPacketPrefix() = %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSymbolRoundTrip(t *testing.T) {
+	var line []byte
+	for value := 0; value < 256; value++ {
+		line = append(line, EncodeData(byte(value))...)
+	}
+	line = append(line, ControlSignal(SymbolJam)...)
+	decoder := SymbolDecoder{}
+	var data []byte
+	var controls []byte
+	for _, b := range line {
+		symbol, ok := decoder.Decode(b)
+		if !ok {
+			continue
+		}
+		if symbol.Control {
+			controls = append(controls, symbol.Value)
+		} else {
+			data = append(data, symbol.Value)
+		}
+	}
+	if len(data) != 256 {
+		t.Fatalf("decoded %d data bytes, want 256", len(data))
+	}
+	for value := range data {
+		if data[value] != byte(value) {
+			t.Errorf("byte %d decoded as %d", value, data[value])
+		}
+	}
+	if !bytes.Equal(controls, []byte{SymbolJam}) {
+		t.Errorf("decoded control symbols %q, want J", controls)
+	}
+}
+
+func TestReceiverReplay(t *testing.T) {
+	replay, err := rs232.OpenReplay("testdata/jam_split.rec", "/dev/ttyS2", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := newStack(linecode.None)
+	ctx := context.Background()
+	receiver := NewReceiver(s, replay.Chunks(ctx))
+	for _, want := range []string{"0000110", "1111111"} {
+		got, err := receiver.Next(ctx)
+		if err != nil {
+			t.Fatalf("Next() error: %v", err)
+		}
+		if got != want {
+			t.Errorf("Next() = %q, want %q", got, want)
+		}
+	}
+	_, err = receiver.Next(ctx)
+	if !errors.Is(err, rs232.ErrPortClosed) {
+		t.Errorf("Next() at the end of the recording returned %v", err)
+	}
+	counters := s.Stats.Current()
+	if jams := counters.JamsReceived; jams != 2 {
+		t.Errorf("counted %d jams, want 2", jams)
+	}
+	if aborts := counters.AbortsReceived; aborts != 1 {
+		t.Errorf("counted %d aborts, want 1", aborts)
+	}
+}
+
+func TestReceiverKeepsSymbolState(t *testing.T) {
+	s := newStack(linecode.None)
+	first := append(EncodeLine(stuffedPacket(1, "0000110")), Escape)
+	second := append([]byte{SymbolIdle}, EncodeLine(stuffedPacket(1, "1111111"))...)
+	second = append(second, ControlSignal(SymbolIdle)...)
+	chunks := make(chan rs232.Chunk, 2)
+	chunks <- rs232.Chunk{Port: 2, Data: first}
+	chunks <- rs232.Chunk{Port: 2, Data: second}
+	close(chunks)
+	ctx := context.Background()
+	receiver := NewReceiver(s, chunks)
+	for _, want := range []string{"0000110", "1111111"} {
+		got, err := receiver.Next(ctx)
+		if err != nil || got != want {
+			t.Fatalf("Next() = %q, %v, want %q", got, err, want)
+		}
+	}
+	// An idle symbol split between the chunks that was taken for data would
+	// put a stray byte before the second frame.
+	if counters := s.Stats.Current(); counters.FramesReceived != 2 || counters.FramesDropped != 0 {
+		t.Errorf("counted %d frames received and %d dropped, want 2 and 0",
+			counters.FramesReceived, counters.FramesDropped)
+	}
+}
+
+func TestReceiverJamAfterLastByte(t *testing.T) {
+	s := newStack(linecode.None)
+	frame := stuffedPacket(1, "0110101")
+	last := len(frame) - 1
+	wrong := append(frame[:last:last], frame[last]^1)
+	second := append(ControlSignal(SymbolJam), EncodeData(frame[last])...)
+	chunks := make(chan rs232.Chunk, 2)
+	chunks <- rs232.Chunk{Port: 2, Data: EncodeLine(wrong)}
+	chunks <- rs232.Chunk{Port: 2, Data: append(second, ControlSignal(SymbolIdle)...)}
+	close(chunks)
+	ctx := context.Background()
+	receiver := NewReceiver(s, chunks)
+	if got, err := receiver.Next(ctx); err != nil || got != "0110101" {
+		t.Fatalf("Next() = %q, %v, want 0110101", got, err)
+	}
+	if got, err := receiver.Next(ctx); !errors.Is(err, rs232.ErrPortClosed) {
+		t.Errorf("Next() after the frame = %q, %v, want %v", got, err, rs232.ErrPortClosed)
+	}
+	if jams := s.Stats.Current().JamsReceived; jams != 1 {
+		t.Errorf("counted %d jams, want 1", jams)
+	}
+}
+
+func TestReceiverFramesOfOneChunk(t *testing.T) {
+	for _, framer := range []framing.Framer{framing.Lab, framing.COBS} {
+		t.Run(framer.Name(), func(t *testing.T) {
+			s := stack.New(framer, linecode.None, 115200, settings.Default)
+			payloads := []string{"0000110", "1111111", "0101010"}
+			var line []byte
+			for _, data := range payloads {
+				frame, _, err := packet.SerializePacket(s, data, 1)
+				if err != nil {
+					t.Fatal(err)
+				}
+				line = append(line, EncodeLine(frame)...)
+				line = append(line, ControlSignal(SymbolIdle)...)
+			}
+			chunks := make(chan rs232.Chunk, 1)
+			chunks <- rs232.Chunk{Port: 2, Data: line}
+			close(chunks)
+			ctx := context.Background()
+			receiver := NewReceiver(s, chunks)
+			for _, want := range payloads {
+				got, err := receiver.Next(ctx)
+				if err != nil || got != want {
+					t.Fatalf("Next() = %q, %v, want %q", got, err, want)
+				}
+			}
+			if _, err := receiver.Next(ctx); !errors.Is(err, rs232.ErrPortClosed) {
+				t.Errorf("Next() after the last frame returned %v", err)
+			}
+		})
+	}
+}
+
+func FuzzCheckPacket(f *testing.F) {
+	f.Add(stuffedPacket(1, "0000110"))
+	f.Add(append(append([]byte{1, 0}, flag...), stuffedPacket(12, "0111000")...))
+	s := newStack(linecode.None)
+	f.Fuzz(func(t *testing.T, rawData []byte) {
+		if CheckPacket(append([]byte(nil), rawData...)) {
+			_, err := packet.DeserializePacket(s, CleanPacketPrefix(rawData))
+			if err != nil {
+				t.Fatalf("CheckPacket accepted %v that does not deserialize: %v", rawData, err)
+			}
+		}
+	})
+}
+
+func FuzzCleanPacketPrefix(f *testing.F) {
+	f.Add(stuffedPacket(1, "0000110"))
+	f.Add(append([]byte{1, 1, 1}, flag...))
+	f.Fuzz(func(t *testing.T, rawData []byte) {
+		got := CleanPacketPrefix(rawData)
+		if !bytes.HasSuffix(rawData, got) {
+			t.Fatalf("CleanPacketPrefix(%v) = %v is not a suffix", rawData, got)
+		}
+		if bytes.Contains(rawData, flag) && !bytes.HasPrefix(got, flag) {
+			t.Fatalf("CleanPacketPrefix(%v) = %v does not start with the flag", rawData, got)
+		}
+	})
+}
+
+func FuzzSymbolDecoder(f *testing.F) {
+	f.Add([]byte{Escape, 'x', 0, 1})
+	f.Add([]byte{0x6a, 0x1b, 0x1b})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		var line []byte
+		for _, b := range data {
+			line = append(line, EncodeData(b)...)
+		}
+		decoder := SymbolDecoder{}
+		var decoded []byte
+		for _, b := range line {
+			symbol, ok := decoder.Decode(b)
+			if !ok {
+				continue
+			}
+			if symbol.Control {
+				t.Fatalf("data %v decoded a control symbol", data)
+			}
+			decoded = append(decoded, symbol.Value)
+		}
+		if !bytes.Equal(decoded, data) {
+			t.Fatalf("data %v decoded as %v", data, decoded)
+		}
+	})
+}
+
+func TestInspectLine(t *testing.T) {
+	for _, code := range linecode.Codes {
+		t.Run(code.Name(), func(t *testing.T) {
+			s := newStack(code)
+			frame := stuffedPacket(3, "0110101")
+			encoder := code.NewEncoder()
+			var line []byte
+			var flagBytes int
+			jamAt := 0
+			for i, b := range frame {
+				unit := EncodeLine(encoder.Encode(b))
+				if i < len(flag) {
+					flagBytes += len(unit)
+				}
+				line = append(line, unit...)
+				if i == 10 {
+					// The collided byte is sent again after the jam.
+					jamAt = len(line)
+					line = append(line, ControlSignal(SymbolJam)...)
+					line = append(line, unit...)
+				}
+			}
+			line = append(line, ControlSignal(SymbolIdle)...)
+
+			data, err := DecodeLine(s, line)
+			if err != nil || data != "0110101" {
+				t.Fatalf("DecodeLine() = %q, %v", data, err)
+			}
+			marks := MarkLine(s, line)
+			for i, mark := range marks {
+				want := gui.MarkNone
+				switch {
+				case i < flagBytes:
+					want = gui.MarkFlag
+				case i == jamAt || i == jamAt+1:
+					want = gui.MarkJam
+				case i >= len(line)-2:
+					want = gui.MarkEnd
+				}
+				if mark != want {
+					t.Fatalf("mark of line byte %d = %d, want %d", i, mark, want)
+				}
+			}
+		})
+	}
+}
+
+// Looking at a frame in the inspector must not count it as received.
+func TestDecodeLineCountsNothing(t *testing.T) {
+	s := newStack(linecode.None)
+	p := packet.NewPacket(3, "0110101")
+	p.GetHammingFCS()
+	p.Data[2] ^= 1
+	frame := packet.BitStuffing(p)
+	encoder := linecode.None.NewEncoder()
+	var line []byte
+	for _, b := range frame {
+		line = append(line, EncodeLine(encoder.Encode(b))...)
+	}
+	line = append(line, ControlSignal(SymbolIdle)...)
+
+	decoded := func(result string) float64 {
+		return metrics.FramesDecoded.With(framing.Lab.Name(), result).Value()
+	}
+	before := s.Stats.Current().Counters
+	ok := decoded("ok")
+	corrections := metrics.HammingCorrections.With().Value()
+	data, err := DecodeLine(s, line)
+	if err != nil || data != "0110101" {
+		t.Fatalf("DecodeLine() = %q, %v, want the corrected data", data, err)
+	}
+	if after := s.Stats.Current().Counters; after != before {
+		t.Errorf("DecodeLine() changed the stats from %+v to %+v", before, after)
+	}
+	if decoded("ok") != ok || metrics.HammingCorrections.With().Value() != corrections {
+		t.Errorf("DecodeLine() changed the metrics")
+	}
+}
+
+func TestInject(t *testing.T) {
+	input, output := rs232.Pipe("/dev/ttyS1", "/dev/ttyS2")
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	s := newStack(linecode.None)
+	composed := packet.NewPacket(1, "1010101")
+	frame, _ := packet.ComposeFrame(s.Framer, composed, true, true)
+	if err := Inject(s, input, frame); err != nil {
+		t.Fatal(err)
+	}
+	data, err := NewReceiver(s, output.Chunks(ctx)).Next(ctx)
+	if err != nil || data != "1010101" {
+		t.Errorf("Next() = %q, %v", data, err)
+	}
+}
+
+func TestByteFramersCarrySpecialBytes(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination string
+		source      string
+		data        string
+		special     byte
+	}{
+		{"ppp flag", "0000", "0001", "1111110", 0x7E},
+		{"ppp escape", "0000", "0001", "1111101", 0x7D},
+		{"slip end", "1100", "0000", "0101010", 0xC0},
+		{"slip escape", "1101", "1011", "0101010", 0xDB},
+		{"zero", "0000", "0001", "0000000", 0x00},
+	}
+	for _, framer := range []framing.Framer{framing.PPP, framing.SLIP, framing.COBS} {
+		t.Run(framer.Name(), func(t *testing.T) {
+			s := stack.New(framer, linecode.None, 115200, settings.Default)
+			input, output := rs232.Pipe("/dev/ttyS1", "/dev/ttyS2")
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			receiver := NewReceiver(s, output.Chunks(ctx))
+			for _, test := range tests {
+				composed := packet.NewPacket(1, test.data)
+				composed.Destination = [4]byte(packet.StrToByte(test.destination))
+				composed.Source = [4]byte(packet.StrToByte(test.source))
+				composed.GetHammingFCS()
+				if !bytes.Contains(composed.Payload(framer), []byte{test.special}) {
+					t.Fatalf("%s: payload % x lacks 0x%02x", test.name, composed.Payload(framer), test.special)
+				}
+				frame, _ := packet.ComposeFrame(framer, composed, false, true)
+				if err := Inject(s, input, frame); err != nil {
+					t.Fatal(err)
+				}
+				data, err := receiver.Next(ctx)
+				if err != nil || data != test.data {
+					t.Errorf("%s: Next() = %q, %v, want %q", test.name, data, err, test.data)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,115 @@
+package csma_cd
+
+import (
+	"bytes"
+	"lab_4/framing"
+	"lab_4/gui"
+	"lab_4/packet"
+	"lab_4/stack"
+)
+
+// inspected is raw line data taken apart like the Receiver does, without
+// touching the statistics: the frame bytes, the line bytes each of them
+// came from and what every line byte is.
+type inspected struct {
+	frame []byte
+	spans [][2]int
+	marks []gui.ByteMark
+}
+
+func inspect(s *stack.Stack, line []byte) inspected {
+	result := inspected{marks: make([]gui.ByteMark, len(line))}
+	decoder := SymbolDecoder{}
+	lineDecoder := s.Code.NewDecoder()
+	unitStart := -1
+	escaped := false
+	for i, rawByte := range line {
+		symbol, ok := decoder.Decode(rawByte)
+		if !ok {
+			escaped = true
+			continue
+		}
+		start := i
+		if escaped {
+			start = i - 1
+			escaped = false
+		}
+		if !symbol.Control {
+			if unitStart < 0 {
+				unitStart = start
+			}
+			value, ok, err := lineDecoder.Decode(symbol.Value)
+			if err != nil {
+				unitStart = -1
+			}
+			if ok {
+				result.frame = append(result.frame, value)
+				result.spans = append(result.spans, [2]int{unitStart, i + 1})
+				unitStart = -1
+			}
+			continue
+		}
+		mark := gui.MarkControl
+		switch symbol.Value {
+		case SymbolJam:
+			mark = gui.MarkJam
+			if len(result.frame) > 0 {
+				result.frame = result.frame[:len(result.frame)-1]
+				result.spans = result.spans[:len(result.spans)-1]
+			}
+		case SymbolAbort:
+			mark = gui.MarkEnd
+			result.frame = result.frame[:0]
+			result.spans = result.spans[:0]
+			lineDecoder.Reset()
+			unitStart = -1
+		case SymbolIdle:
+			mark = gui.MarkEnd
+			lineDecoder.Reset()
+			unitStart = -1
+		}
+		for j := start; j <= i; j++ {
+			result.marks[j] = mark
+		}
+	}
+	if bits, ok := s.Framer.(framing.Bits); ok {
+		flag := bits.Rule.Flag
+		for from := 0; from < len(result.frame); {
+			index := bytes.Index(result.frame[from:], flag)
+			if index < 0 {
+				break
+			}
+			for _, span := range result.spans[from+index : from+index+len(flag)] {
+				for j := span[0]; j < span[1]; j++ {
+					result.marks[j] = gui.MarkFlag
+				}
+			}
+			from += index + len(flag)
+		}
+	}
+	return result
+}
+
+// MarkLine finds the flags of the lab framing, jams and the other control
+// symbols in raw line data.
+func MarkLine(s *stack.Stack, line []byte) []gui.ByteMark {
+	return inspect(s, line).marks
+}
+
+// DecodeLine decodes the first frame in raw line data without counting it
+// in the stats or metrics of the link.
+func DecodeLine(s *stack.Stack, line []byte) (string, error) {
+	return packet.InspectPacket(s, inspect(s, line).frame)
+}
+
+// InspectHandlers lets the inspector of a link take its line data apart.
+func InspectHandlers(s *stack.Stack) gui.InspectHandlers {
+	return gui.InspectHandlers{
+		Mark: func(line []byte) []gui.ByteMark {
+			return MarkLine(s, line)
+		},
+		Decode: func(line []byte) (string, error) {
+			return DecodeLine(s, line)
+		},
+	}
+}
@@ -0,0 +1,59 @@
+package csma_cd
+
+// Control signals travel on the line as Escape followed by a symbol byte.
+// A data byte equal to Escape is sent as Escape, SymbolEscape, so any
+// payload byte value can be transmitted.
+const (
+	Escape       byte = 0x1B
+	SymbolEscape byte = 'E'
+	SymbolJam    byte = 'J'
+	SymbolAbort  byte = 'A'
+	SymbolIdle   byte = 'I'
+)
+
+type Symbol struct {
+	Value   byte
+	Control bool
+}
+
+func EncodeData(data byte) []byte {
+	if data == Escape {
+		return []byte{Escape, SymbolEscape}
+	}
+	return []byte{data}
+}
+
+// EncodeLine escapes every line symbol of one coded byte.
+func EncodeLine(symbols []byte) []byte {
+	var line []byte
+	for _, symbol := range symbols {
+		line = append(line, EncodeData(symbol)...)
+	}
+	return line
+}
+
+func ControlSignal(symbol byte) []byte {
+	return []byte{Escape, symbol}
+}
+
+type SymbolDecoder struct {
+	escaped bool
+}
+
+// Decode consumes one line byte and reports whether it completed a symbol.
+// The escape state is kept between calls, so a control signal split across
+// two reads is still recognised.
+func (d *SymbolDecoder) Decode(b byte) (Symbol, bool) {
+	if d.escaped {
+		d.escaped = false
+		if b == SymbolEscape {
+			return Symbol{Value: Escape}, true
+		}
+		return Symbol{Value: b, Control: true}, true
+	}
+	if b == Escape {
+		d.escaped = true
+		return Symbol{}, false
+	}
+	return Symbol{Value: b}, true
+}
@@ -0,0 +1,66 @@
+package framing
+
+import (
+	"bytes"
+	"lab_4/stuffing"
+)
+
+// Bits frames a fixed number of bits with a stuffing rule. There is no
+// closing flag: a frame ends once Length bits are decoded and no stuffed
+// bit is pending.
+type Bits struct {
+	Rule   stuffing.Rule
+	Length int
+}
+
+var Lab = Bits{Rule: stuffing.Lab, Length: 19}
+
+func (b Bits) Name() string {
+	return "bits"
+}
+
+func (b Bits) Frame(payload []byte) ([]byte, []int) {
+	return b.Rule.Encode(payload)
+}
+
+func (b Bits) Delimiters() (int, int) {
+	return len(b.Rule.Flag), 0
+}
+
+func (b Bits) Next(data []byte) ([]byte, int, error) {
+	start := bytes.Index(data, b.Rule.Flag)
+	for start >= 0 {
+		payload, end, err := b.decode(data[start:])
+		if err == nil {
+			if end == 0 {
+				return nil, 0, nil
+			}
+			return payload, start + end, nil
+		}
+		// Another flag broke the frame, so the frame starts over there.
+		next := bytes.Index(data[start+1:], b.Rule.Flag)
+		if next < 0 {
+			return nil, 0, nil
+		}
+		start += next + 1
+	}
+	return nil, 0, nil
+}
+
+func (b Bits) decode(frame []byte) ([]byte, int, error) {
+	decoder := stuffing.NewDecoder(b.Rule)
+	payload := make([]byte, 0, b.Length)
+	for i, bit := range frame[len(b.Rule.Flag):] {
+		bit, ok, err := decoder.ReadBit(bit)
+		if err != nil {
+			return nil, 0, err
+		}
+		if ok {
+			payload = append(payload, bit)
+		}
+		if len(payload) == b.Length && !decoder.Pending() {
+			return payload, len(b.Rule.Flag) + i + 1, nil
+		}
+	}
+	return nil, 0, nil
+}
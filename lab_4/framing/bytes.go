@@ -0,0 +1,104 @@
+package framing
+
+import "bytes"
+
+// escaping stuffs bytes with an escape byte: every special byte is sent as
+// the escape byte followed by its replacement. Frames start and end with
+// the delimiter.
+type escaping struct {
+	name      string
+	delimiter byte
+	escape    byte
+	replace   map[byte]byte
+}
+
+var (
+	// PPP is PPP in HDLC-like framing (RFC 1662): 0x7E delimits, 0x7D
+	// escapes and the escaped byte has bit 5 flipped.
+	PPP Framer = escaping{
+		name:      "ppp",
+		delimiter: 0x7E,
+		escape:    0x7D,
+		replace:   map[byte]byte{0x7E: 0x5E, 0x7D: 0x5D},
+	}
+	// SLIP is RFC 1055 with the optional END before every packet.
+	SLIP Framer = escaping{
+		name:      "slip",
+		delimiter: 0xC0,
+		escape:    0xDB,
+		replace:   map[byte]byte{0xC0: 0xDC, 0xDB: 0xDD},
+	}
+)
+
+func (e escaping) Name() string {
+	return e.name
+}
+
+func (e escaping) Frame(payload []byte) ([]byte, []int) {
+	frame := []byte{e.delimiter}
+	var inserted []int
+	for _, b := range payload {
+		if replacement, ok := e.replace[b]; ok {
+			inserted = append(inserted, len(frame))
+			frame = append(frame, e.escape, replacement)
+			continue
+		}
+		frame = append(frame, b)
+	}
+	return append(frame, e.delimiter), inserted
+}
+
+func (e escaping) Delimiters() (int, int) {
+	return 1, 1
+}
+
+func (e escaping) Next(data []byte) ([]byte, int, error) {
+	body, n := delimited(data, e.delimiter)
+	if n == 0 {
+		return nil, 0, nil
+	}
+	payload := make([]byte, 0, len(body))
+	for i := 0; i < len(body); i++ {
+		if body[i] != e.escape {
+			payload = append(payload, body[i])
+			continue
+		}
+		i++
+		original, ok := e.original(body, i)
+		if !ok {
+			return nil, n, ErrInvalidFrame
+		}
+		payload = append(payload, original)
+	}
+	return payload, n, nil
+}
+
+func (e escaping) original(body []byte, i int) (byte, bool) {
+	if i >= len(body) {
+		return 0, false
+	}
+	for original, replacement := range e.replace {
+		if body[i] == replacement {
+			return original, true
+		}
+	}
+	return 0, false
+}
+
+// delimited returns the first non-empty run of bytes between two
+// delimiters and how many bytes of data end with the closing one.
+func delimited(data []byte, delimiter byte) ([]byte, int) {
+	start := bytes.IndexByte(data, delimiter)
+	for start >= 0 {
+		end := bytes.IndexByte(data[start+1:], delimiter)
+		if end < 0 {
+			return nil, 0
+		}
+		end += start + 1
+		if end > start+1 {
+			return data[start+1 : end], end + 1
+		}
+		start = end
+	}
+	return nil, 0
+}
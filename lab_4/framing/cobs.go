@@ -0,0 +1,58 @@
+package framing
+
+type cobs struct{}
+
+// COBS is Consistent Overhead Byte Stuffing: zeros are replaced by the
+// distance to the next one, so 0x00 only appears as the delimiter around
+// each frame. Only the leading code byte and the one after every full
+// block of 254 bytes are inserted; the others stand for a zero.
+var COBS Framer = cobs{}
+
+func (cobs) Name() string {
+	return "cobs"
+}
+
+func (cobs) Frame(payload []byte) ([]byte, []int) {
+	frame := []byte{0}
+	code := len(frame)
+	inserted := []int{code}
+	frame = append(frame, 1)
+	for i, b := range payload {
+		if b != 0 {
+			frame = append(frame, b)
+			frame[code]++
+		}
+		if b == 0 || frame[code] == 0xFF && i+1 < len(payload) {
+			if b != 0 {
+				inserted = append(inserted, len(frame))
+			}
+			code = len(frame)
+			frame = append(frame, 1)
+		}
+	}
+	return append(frame, 0), inserted
+}
+
+func (cobs) Delimiters() (int, int) {
+	return 1, 1
+}
+
+func (cobs) Next(data []byte) ([]byte, int, error) {
+	body, n := delimited(data, 0)
+	if n == 0 {
+		return nil, 0, nil
+	}
+	payload := make([]byte, 0, len(body))
+	for i := 0; i < len(body); {
+		code := int(body[i])
+		if i+code > len(body) {
+			return nil, n, ErrInvalidFrame
+		}
+		payload = append(payload, body[i+1:i+code]...)
+		i += code
+		if code < 0xFF && i < len(body) {
+			payload = append(payload, 0)
+		}
+	}
+	return payload, n, nil
+}
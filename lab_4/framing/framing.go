@@ -0,0 +1,46 @@
+// Package framing delimits packets on the line. Bits is the lab scheme of
+// bit stuffing over one bit per byte; PPP, SLIP and COBS carry any bytes.
+// Every link picks its framer.
+package framing
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrInvalidFrame   = errors.New("Invalid frame")
+	ErrUnknownFraming = errors.New("Unknown framing")
+)
+
+type Framer interface {
+	Name() string
+	// Frame returns payload ready for the line and the positions of the
+	// bytes the framer inserted into it, delimiters aside.
+	Frame(payload []byte) ([]byte, []int)
+	// Next finds the first complete frame in data and returns its payload
+	// and how many bytes of data it used. n is 0 while no frame is
+	// complete; a broken frame is reported with the bytes to drop.
+	Next(data []byte) (payload []byte, n int, err error)
+	// Delimiters is how many bytes open and close every frame.
+	Delimiters() (opening, closing int)
+}
+
+var Framers = []Framer{Lab, PPP, SLIP, COBS}
+
+func Names() []string {
+	names := make([]string, len(Framers))
+	for i, framer := range Framers {
+		names[i] = framer.Name()
+	}
+	return names
+}
+
+func ByName(name string) (Framer, error) {
+	for _, framer := range Framers {
+		if strings.EqualFold(framer.Name(), name) {
+			return framer, nil
+		}
+	}
+	return nil, ErrUnknownFraming
+}
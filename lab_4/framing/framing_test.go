@@ -0,0 +1,136 @@
+package framing
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func sequence(first, last int) []byte {
+	var data []byte
+	for b := first; b <= last; b++ {
+		data = append(data, byte(b))
+	}
+	return data
+}
+
+func join(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestKnownVectors(t *testing.T) {
+	tests := []struct {
+		name     string
+		framer   Framer
+		payload  []byte
+		want     []byte
+		inserted []int
+	}{
+		{"ppp plain", PPP, []byte{1, 2, 3}, []byte{0x7E, 1, 2, 3, 0x7E}, nil},
+		{"ppp flag and escape", PPP, []byte{0x7E, 1, 0x7D}, []byte{0x7E, 0x7D, 0x5E, 1, 0x7D, 0x5D, 0x7E}, []int{1, 4}},
+		{"slip end and esc", SLIP, []byte{0xC0, 0xDB, 5}, []byte{0xC0, 0xDB, 0xDC, 0xDB, 0xDD, 5, 0xC0}, []int{1, 3}},
+		{"cobs zero", COBS, []byte{0}, []byte{0, 1, 1, 0}, []int{1}},
+		{"cobs two zeros", COBS, []byte{0, 0}, []byte{0, 1, 1, 1, 0}, []int{1}},
+		{"cobs zero inside", COBS, []byte{0x11, 0x22, 0, 0x33}, []byte{0, 3, 0x11, 0x22, 2, 0x33, 0}, []int{1}},
+		{"cobs no zero", COBS, []byte{0x11, 0x22, 0x33, 0x44}, []byte{0, 5, 0x11, 0x22, 0x33, 0x44, 0}, []int{1}},
+		{"cobs trailing zeros", COBS, []byte{0x11, 0, 0, 0}, []byte{0, 2, 0x11, 1, 1, 1, 0}, []int{1}},
+		{"cobs 254 bytes", COBS, sequence(1, 254), join([]byte{0, 0xFF}, sequence(1, 254), []byte{0}), []int{1}},
+		{"cobs 255 bytes", COBS, sequence(1, 255), join([]byte{0, 0xFF}, sequence(1, 254), []byte{2, 0xFF, 0}), []int{1, 256}},
+		{"bits", Lab, []byte{0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 1, 0, 1, 1, 0, 1},
+			[]byte{1, 0, 0, 0, 0, 1, 1, 1, 0, 0, 0, 0, 0, 0, 0, 1, 0, 0, 0, 0, 1, 1, 0, 0, 1, 1, 0, 1}, []int{22}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			frame, inserted := test.framer.Frame(test.payload)
+			if !bytes.Equal(frame, test.want) {
+				t.Errorf("Frame() = % x, want % x", frame, test.want)
+			}
+			if !reflect.DeepEqual(inserted, test.inserted) {
+				t.Errorf("Frame() inserted at %v, want %v", inserted, test.inserted)
+			}
+			opening, closing := test.framer.Delimiters()
+			if len(frame) != opening+len(test.payload)+len(inserted)+closing {
+				t.Errorf("Frame() of %d bytes does not add up", len(frame))
+			}
+			payload, n, err := test.framer.Next(frame)
+			if err != nil || n != len(frame) || !bytes.Equal(payload, test.payload) {
+				t.Errorf("Next() = % x, %d, %v", payload, n, err)
+			}
+		})
+	}
+}
+
+func TestNextSkipsGarbageAndWaits(t *testing.T) {
+	for _, framer := range Framers {
+		t.Run(framer.Name(), func(t *testing.T) {
+			first := make([]byte, 19)
+			second := []byte{1, 1, 0, 1, 0, 0, 0, 0, 1, 1, 1, 0, 1, 0, 1, 1, 1, 1, 0}
+			frame, _ := framer.Frame(first)
+			next, _ := framer.Frame(second)
+			stream := join(frame, next)
+			if _, n, err := framer.Next(stream[:len(frame)-1]); n != 0 || err != nil {
+				t.Fatalf("Next() on a partial frame = %d, %v", n, err)
+			}
+			payload, n, err := framer.Next(stream)
+			if err != nil || n != len(frame) || !bytes.Equal(payload, first) {
+				t.Fatalf("Next() = %v, %d, %v", payload, n, err)
+			}
+			payload, _, err = framer.Next(stream[n:])
+			if err != nil || !bytes.Equal(payload, second) {
+				t.Fatalf("second Next() = %v, %v", payload, err)
+			}
+		})
+	}
+}
+
+func TestNextRejectsBrokenFrames(t *testing.T) {
+	tests := []struct {
+		framer Framer
+		data   []byte
+	}{
+		{PPP, []byte{0x7E, 1, 0x7D, 0x7E}},
+		{PPP, []byte{0x7E, 0x7D, 1, 0x7E}},
+		{SLIP, []byte{0xC0, 0xDB, 1, 0xC0}},
+		{COBS, []byte{0, 5, 1, 0}},
+	}
+	for _, test := range tests {
+		_, n, err := test.framer.Next(test.data)
+		if !errors.Is(err, ErrInvalidFrame) || n != len(test.data) {
+			t.Errorf("%s: Next(% x) = %d, %v", test.framer.Name(), test.data, n, err)
+		}
+	}
+}
+
+func TestByName(t *testing.T) {
+	for _, name := range Names() {
+		framer, err := ByName(name)
+		if err != nil || framer.Name() != name {
+			t.Errorf("ByName(%q) = %v, %v", name, framer, err)
+		}
+	}
+	if _, err := ByName("hdlc"); !errors.Is(err, ErrUnknownFraming) {
+		t.Errorf("ByName(hdlc) = %v", err)
+	}
+}
+
+func FuzzByteFramers(f *testing.F) {
+	f.Add([]byte{0x7E, 0x7D, 0xC0, 0xDB, 0})
+	f.Add(sequence(0, 255))
+	f.Fuzz(func(t *testing.T, payload []byte) {
+		if len(payload) == 0 {
+			return
+		}
+		for _, framer := range []Framer{PPP, SLIP, COBS} {
+			frame, inserted := framer.Frame(payload)
+			opening, closing := framer.Delimiters()
+			if len(frame) != opening+len(payload)+len(inserted)+closing {
+				t.Fatalf("%s: frame of %d bytes does not add up", framer.Name(), len(frame))
+			}
+			got, n, err := framer.Next(frame)
+			if err != nil || n != len(frame) || !bytes.Equal(got, payload) {
+				t.Fatalf("%s: % x came back as % x, %d, %v", framer.Name(), payload, got, n, err)
+			}
+		}
+	})
+}
@@ -0,0 +1,70 @@
+package gui
+
+import (
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+)
+
+const (
+	chartWidth  = 220
+	chartHeight = 60
+)
+
+// Chart draws the recent values of one series as a line scaled to its
+// maximum.
+type Chart struct {
+	title   string
+	unit    string
+	label   *widget.Label
+	lines   *fyne.Container
+	content fyne.CanvasObject
+}
+
+func NewChart(title, unit string) *Chart {
+	c := &Chart{title: title, unit: unit, label: widget.NewLabel(title)}
+	c.lines = container.NewWithoutLayout()
+	frame := canvas.NewRectangle(theme.Color(theme.ColorNameInputBackground))
+	frame.SetMinSize(fyne.NewSize(chartWidth, chartHeight))
+	c.content = container.NewBorder(c.label, nil, nil, nil, container.NewStack(frame, c.lines))
+	return c
+}
+
+func (c *Chart) Content() fyne.CanvasObject {
+	return c.content
+}
+
+func (c *Chart) SetValues(values []float64) {
+	peak := 0.0
+	for _, value := range values {
+		peak = max(peak, value)
+	}
+	last := 0.0
+	if len(values) > 0 {
+		last = values[len(values)-1]
+	}
+	c.label.SetText(fmt.Sprintf("%s: %.2f %s (max %.2f)", c.title, last, c.unit, peak))
+	if peak == 0 {
+		peak = 1
+	}
+	step := float32(chartWidth)
+	if len(values) > 1 {
+		step = chartWidth / float32(len(values)-1)
+	}
+	y := func(value float64) float32 {
+		return chartHeight - float32(value/peak)*(chartHeight-2) - 1
+	}
+	objects := make([]fyne.CanvasObject, 0, len(values))
+	for i := 1; i < len(values); i++ {
+		line := canvas.NewLine(theme.Color(theme.ColorNamePrimary))
+		line.StrokeWidth = 2
+		line.Position1 = fyne.NewPos(float32(i-1)*step, y(values[i-1]))
+		line.Position2 = fyne.NewPos(float32(i)*step, y(values[i]))
+		objects = append(objects, line)
+	}
+	c.lines.Objects = objects
+	c.lines.Refresh()
+}
@@ -0,0 +1,147 @@
+package gui
+
+import (
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"lab_4/framing"
+	"lab_4/packet"
+	"time"
+)
+
+// bitField is a row of buttons, one per bit of a packet field; a button
+// flips its bit.
+type bitField struct {
+	bits    []byte
+	buttons []*widget.Button
+	row     *fyne.Container
+}
+
+func newBitField(bits []byte, changed func()) *bitField {
+	f := &bitField{bits: bits, row: container.NewHBox()}
+	for i := range bits {
+		button := widget.NewButton("", func() {
+			f.bits[i] ^= 1
+			changed()
+		})
+		f.buttons = append(f.buttons, button)
+		f.row.Add(button)
+	}
+	f.refresh()
+	return f
+}
+
+func (f *bitField) refresh() {
+	for i, button := range f.buttons {
+		button.SetText(fmt.Sprint(f.bits[i]))
+		if f.bits[i] == 1 {
+			button.Importance = widget.HighImportance
+		} else {
+			button.Importance = widget.MediumImportance
+		}
+		button.Refresh()
+	}
+}
+
+func (f *bitField) setEnabled(enabled bool) {
+	for _, button := range f.buttons {
+		if enabled {
+			button.Enable()
+		} else {
+			button.Disable()
+		}
+	}
+}
+
+// Composer builds a frame bit by bit and injects it on the transmitter
+// port as it is, to see how the receiver copes with broken frames.
+type Composer struct {
+	framer     framing.Framer
+	packet     packet.Packet
+	computeFCS bool
+	stuff      bool
+	fields     []*bitField
+	fcs        *bitField
+	preview    *widget.Label
+	status     *widget.Label
+	dialog     dialog.Dialog
+}
+
+func NewComposer(window fyne.Window, framer framing.Framer, inject func(frame []byte) error) *Composer {
+	c := &Composer{
+		framer:     framer,
+		packet:     packet.NewPacket(0, "0000000"),
+		computeFCS: true,
+		stuff:      true,
+		preview:    widget.NewLabel(""),
+		status:     widget.NewLabel(""),
+	}
+	c.preview.TextStyle = fyne.TextStyle{Monospace: true}
+	c.preview.Wrapping = fyne.TextWrapBreak
+	form := widget.NewForm()
+	for _, field := range []struct {
+		name string
+		bits []byte
+	}{
+		{packet.FieldFlag.String(), c.packet.Flag[:]},
+		{packet.FieldDestination.String(), c.packet.Destination[:]},
+		{packet.FieldSource.String(), c.packet.Source[:]},
+		{packet.FieldData.String(), c.packet.Data[:]},
+		{packet.FieldFCS.String(), c.packet.FCS[:]},
+	} {
+		f := newBitField(field.bits, c.update)
+		c.fields = append(c.fields, f)
+		form.Append(field.name, f.row)
+	}
+	c.fcs = c.fields[len(c.fields)-1]
+	computeFCS := widget.NewCheck("Compute FCS", func(on bool) {
+		c.computeFCS = on
+		c.update()
+	})
+	computeFCS.SetChecked(c.computeFCS)
+	stuff := widget.NewCheck("Apply stuffing", func(on bool) {
+		c.stuff = on
+		c.update()
+	})
+	stuff.SetChecked(c.stuff)
+	injectButton := widget.NewButton("Inject", func() {
+		frame, _ := packet.ComposeFrame(c.framer, c.packet, c.computeFCS, c.stuff)
+		err := inject(frame)
+		if err != nil {
+			c.status.SetText(err.Error())
+			return
+		}
+		c.status.SetText(fmt.Sprintf("%d bytes injected at %s", len(frame), time.Now().Format(time.TimeOnly)))
+	})
+	injectButton.Importance = widget.HighImportance
+	closeButton := widget.NewButton("Close", func() { c.dialog.Hide() })
+	content := container.NewVBox(
+		form,
+		container.NewHBox(computeFCS, stuff),
+		widget.NewLabel("Frame on the line:"),
+		c.preview,
+		c.status,
+		container.NewHBox(injectButton, closeButton),
+	)
+	c.dialog = dialog.NewCustomWithoutButtons("Compose frame", content, window)
+	c.update()
+	return c
+}
+
+func (c *Composer) Show() {
+	c.dialog.Show()
+}
+
+func (c *Composer) update() {
+	if c.computeFCS {
+		c.packet.GetHammingFCS()
+	}
+	c.fcs.setEnabled(!c.computeFCS)
+	for _, field := range c.fields {
+		field.refresh()
+	}
+	frame, formatted := packet.ComposeFrame(c.framer, c.packet, c.computeFCS, c.stuff)
+	c.preview.SetText(fmt.Sprintf("%s\n%d bytes", formatted, len(frame)))
+}
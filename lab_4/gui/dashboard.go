@@ -0,0 +1,123 @@
+package gui
+
+import (
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/storage"
+	"fyne.io/fyne/v2/widget"
+	"lab_4/stack"
+	"lab_4/stats"
+)
+
+// chartSamples is how many of the last samples the charts show.
+const chartSamples = 120
+
+// Dashboard shows the session statistics and charts of the last samples.
+// Rates in the charts are per sample interval, the totals are cumulative.
+type Dashboard struct {
+	stack      *stack.Stack
+	totals     *widget.Label
+	throughput *Chart
+	collisions *Chart
+	errors     *Chart
+	content    fyne.CanvasObject
+}
+
+func NewDashboard(window func() fyne.Window, s *stack.Stack) *Dashboard {
+	d := &Dashboard{
+		stack:      s,
+		totals:     widget.NewLabel("No frames yet"),
+		throughput: NewChart("Throughput", "bit/s"),
+		collisions: NewChart("Collisions", "per frame"),
+		errors:     NewChart("Errors", "% of frames"),
+	}
+	export := widget.NewButton("Export CSV", func() {
+		d.export(window())
+	})
+	reset := widget.NewButton("Reset", func() {
+		s.Stats.Reset()
+		d.Update(s.Stats.Current(), nil)
+	})
+	d.content = container.NewBorder(nil, nil,
+		container.NewVBox(d.totals, container.NewHBox(export, reset)), nil,
+		container.NewHBox(d.throughput.Content(), d.collisions.Content(), d.errors.Content()),
+	)
+	return d
+}
+
+func (d *Dashboard) Content() fyne.CanvasObject {
+	return d.content
+}
+
+func (d *Dashboard) Update(current stats.Snapshot, history []stats.Snapshot) {
+	baudRate := d.stack.BaudRate
+	d.totals.SetText(fmt.Sprintf(
+		"Frames sent %d, aborted %d, received %d, corrected %d, dropped %d\n"+
+			"Payload %d bits of %d on the wire (%.1f%%), %d resent\n"+
+			"Throughput %.1f bit/s, %.3f%% of %d baud\n"+
+			"Collisions %d (%.2f per frame), backoff %s\n"+
+			"Jams received %d, aborts received %d",
+		current.FramesSent, current.FramesAborted, current.FramesReceived,
+		current.FramesCorrected, current.FramesDropped,
+		current.PayloadBits, current.WireBits, 100*current.Efficiency(), current.RetransmittedBits,
+		current.Throughput(), 100*current.Throughput()/float64(baudRate), baudRate,
+		current.Collisions, current.CollisionsPerFrame(), current.Backoff.Round(1e6),
+		current.JamsReceived, current.AbortsReceived))
+	if len(history) > chartSamples+1 {
+		history = history[len(history)-chartSamples-1:]
+	}
+	var throughput, collisions, errors []float64
+	for i := 1; i < len(history); i++ {
+		interval := stats.Snapshot{
+			Elapsed:  history[i].Time.Sub(history[i-1].Time),
+			Counters: difference(history[i].Counters, history[i-1].Counters),
+		}
+		throughput = append(throughput, interval.Throughput())
+		collisions = append(collisions, interval.CollisionsPerFrame())
+		errors = append(errors, 100*interval.ErrorRate())
+	}
+	d.throughput.SetValues(throughput)
+	d.collisions.SetValues(collisions)
+	d.errors.SetValues(errors)
+}
+
+func difference(a, b stats.Counters) stats.Counters {
+	return stats.Counters{
+		FramesSent:        a.FramesSent - b.FramesSent,
+		FramesAborted:     a.FramesAborted - b.FramesAborted,
+		FramesReceived:    a.FramesReceived - b.FramesReceived,
+		FramesCorrected:   a.FramesCorrected - b.FramesCorrected,
+		FramesDropped:     a.FramesDropped - b.FramesDropped,
+		JamsReceived:      a.JamsReceived - b.JamsReceived,
+		AbortsReceived:    a.AbortsReceived - b.AbortsReceived,
+		PayloadBits:       a.PayloadBits - b.PayloadBits,
+		WireBits:          a.WireBits - b.WireBits,
+		RetransmittedBits: a.RetransmittedBits - b.RetransmittedBits,
+		Collisions:        a.Collisions - b.Collisions,
+		Backoff:           a.Backoff - b.Backoff,
+	}
+}
+
+func (d *Dashboard) export(window fyne.Window) {
+	save := dialog.NewFileSave(func(writer fyne.URIWriteCloser, err error) {
+		if err != nil {
+			logger.Error("Statistics export failed", "err", err)
+			return
+		}
+		if writer == nil {
+			return
+		}
+		defer writer.Close()
+		err = stats.WriteCSV(writer, d.stack.Stats.History())
+		if err != nil {
+			dialog.ShowError(err, window)
+			return
+		}
+		logger.Info("Statistics exported", "file", writer.URI().Path())
+	}, window)
+	save.SetFileName("lab_4-stats.csv")
+	save.SetFilter(storage.NewExtensionFileFilter([]string{".csv"}))
+	save.Show()
+}
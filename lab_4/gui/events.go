@@ -0,0 +1,382 @@
+package gui
+
+import (
+	"context"
+	"fmt"
+	"fyne.io/fyne/v2"
+	"lab_4/packet"
+	"lab_4/rs232"
+	"lab_4/stats"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Event is a change of the interface state. Protocol goroutines publish
+// events and RunEvents applies them to widgets on the Fyne main thread.
+type Event interface {
+	apply(u *UserInterface)
+}
+
+type Publisher interface {
+	Publish(event Event)
+}
+
+type ByteSent struct {
+	Status string
+}
+
+type Collision struct {
+	Status string
+}
+
+type FrameSent struct {
+	Status string
+}
+
+type SymbolsSent struct {
+	Code    string
+	Symbols []byte
+}
+
+// TimelineSpan is one step of the transmitter; instant ones have End equal
+// to Start.
+type TimelineSpan struct {
+	Kind  SpanKind
+	Field packet.Field
+	Start time.Time
+	End   time.Time
+}
+
+type StatsSampled struct {
+	Snapshot stats.Snapshot
+}
+
+// TransferProgress reports a file transfer; Done and Total count
+// characters of the transfer text over the link, bytes of the file over a
+// modem protocol. Total is 0 while the size is unknown.
+type TransferProgress struct {
+	// Protocol is the modem protocol of the transfer, empty for one over
+	// the link.
+	Protocol string
+	Sending  bool
+	Name     string
+	Size     int64
+	Done     int64
+	Total    int64
+	Started  time.Time
+	Finished bool
+	Err      error
+	Path     string
+}
+
+// ProgressInterval limits how often a TransferReporter publishes progress.
+const ProgressInterval = 200 * time.Millisecond
+
+// TransferReporter publishes the progress of a transfer to Events, at most
+// every ProgressInterval while it runs.
+type TransferReporter struct {
+	Events    Publisher
+	State     TransferProgress
+	published time.Time
+}
+
+// Start publishes state as a transfer starting now.
+func (r *TransferReporter) Start(state TransferProgress) {
+	state.Started = time.Now()
+	r.State = state
+	r.Publish()
+}
+
+// Update records how much is done and publishes it once ProgressInterval
+// has passed since the last time.
+func (r *TransferReporter) Update(done int64) {
+	r.State.Done = done
+	if time.Since(r.published) >= ProgressInterval {
+		r.Publish()
+	}
+}
+
+func (r *TransferReporter) Finish(path string, err error) {
+	r.State.Finished = true
+	r.State.Path = path
+	r.State.Err = err
+	r.Publish()
+}
+
+func (r *TransferReporter) Publish() {
+	if r.Events != nil {
+		r.Events.Publish(r.State)
+	}
+	r.published = time.Now()
+}
+
+// ETA extrapolates the time left from the rate so far.
+func (e TransferProgress) ETA() time.Duration {
+	if e.Done <= 0 || e.Total <= e.Done {
+		return 0
+	}
+	elapsed := time.Since(e.Started)
+	return (time.Duration(float64(elapsed) * float64(e.Total-e.Done) / float64(e.Done))).Round(time.Second)
+}
+
+type ModemSession struct {
+	Running bool
+}
+
+type FrameReceived struct {
+	Port string
+	Data string
+}
+
+// RawChunk is what a port read or wrote, as it was on the line.
+type RawChunk struct {
+	Time      time.Time
+	Direction rs232.Direction
+	Port      string
+	Data      []byte
+}
+
+type Error struct {
+	Err error
+}
+
+type Warning struct {
+	Err error
+}
+
+type InputDiscarded struct{}
+
+type InputCleared struct{}
+
+type PortsUpdated struct {
+	Ports []string
+}
+
+type LogLine struct {
+	Level string
+	Text  string
+}
+
+type inputChanged struct {
+	text string
+}
+
+func (e ByteSent) apply(u *UserInterface) {
+	u.TransmittedBytes++
+	u.UpdateStatus(e.Status)
+}
+
+func (e Collision) apply(u *UserInterface) {
+	u.UpdateStatus(e.Status)
+}
+
+func (e FrameSent) apply(u *UserInterface) {
+	u.UpdateStatus(e.Status)
+}
+
+func (e SymbolsSent) apply(u *UserInterface) {
+	u.Waveform.SetSymbols(e.Code, e.Symbols)
+}
+
+func (e TimelineSpan) apply(u *UserInterface) {
+	u.Timeline.Add(e)
+}
+
+func (e StatsSampled) apply(u *UserInterface) {
+	u.Dashboard.Update(e.Snapshot, u.Stack.Stats.History())
+}
+
+func (e TransferProgress) apply(u *UserInterface) {
+	u.Transfers.Update(e)
+	// Only a transfer over the link takes the input entry's text path.
+	if e.Sending && e.Protocol == "" {
+		if e.Finished {
+			u.InputEntry.Enable()
+		} else {
+			u.InputEntry.Disable()
+		}
+	}
+	if !e.Finished {
+		return
+	}
+	switch {
+	case e.Err != nil:
+		u.Notifier.Notify(SeverityError, "File transfer of "+e.Name+" failed: "+e.Err.Error())
+	case e.Sending:
+		u.Notifier.Notify(SeverityInfo, "File "+e.Name+" sent")
+	default:
+		u.Notifier.Notify(SeverityInfo, "File saved to "+e.Path)
+	}
+}
+
+func (e ModemSession) apply(u *UserInterface) {
+	u.Modem.SetRunning(e.Running)
+}
+
+func (e FrameReceived) apply(u *UserInterface) {
+	u.OutputView.AppendText(e.Port, e.Data)
+}
+
+func (e RawChunk) apply(u *UserInterface) {
+	u.Inspector.Add(e)
+}
+
+func (e Error) apply(u *UserInterface) {
+	u.Notifier.Notify(SeverityError, e.Err.Error())
+}
+
+func (e Warning) apply(u *UserInterface) {
+	u.Notifier.Notify(SeverityWarning, e.Err.Error())
+}
+
+func (e InputDiscarded) apply(u *UserInterface) {
+	if u.TransmittedBytes == 0 {
+		InputCleared{}.apply(u)
+	}
+}
+
+func (e InputCleared) apply(u *UserInterface) {
+	u.inputText = ""
+	u.InputEntry.SetText("")
+}
+
+func (e PortsUpdated) apply(u *UserInterface) {
+	u.SelectInputPort.Options = e.Ports
+	u.SelectOutputPort.Options = e.Ports
+	u.SelectInputPort.Refresh()
+	u.SelectOutputPort.Refresh()
+	u.Modem.SetPorts(e.Ports)
+}
+
+func (e LogLine) apply(u *UserInterface) {
+	u.DebugView.Append(e.Level, e.Text)
+}
+
+func (e inputChanged) apply(u *UserInterface) {
+	prevText := u.inputText
+	newText := e.text
+	if len(newText) < len(prevText) || !strings.HasPrefix(newText, prevText) {
+		u.InputEntry.SetText(prevText)
+		u.InputEntry.CursorRow = len(prevText)
+		return
+	}
+	filteredText := ""
+	for _, char := range newText {
+		if char == '1' || char == '0' || char == '\n' {
+			filteredText += string(char)
+		}
+	}
+	if filteredText != newText {
+		u.InputEntry.SetText(filteredText)
+		u.InputEntry.CursorRow = len(filteredText)
+		return
+	}
+	if len(filteredText) > len(prevText) {
+		err := u.SendQueue.TrySend([]byte(filteredText[len(prevText):]))
+		if err != nil {
+			u.InputEntry.SetText(prevText)
+			u.InputEntry.CursorRow = len(prevText)
+			u.Notifier.Notify(SeverityWarning, err.Error())
+			return
+		}
+		u.inputText = filteredText
+	}
+}
+
+// maxPendingEvents bounds the events waiting for the UI. Past it the oldest
+// one is dropped.
+const maxPendingEvents = 4096
+
+// coalescing events replace a pending event they make obsolete, so frequent
+// progress and stats updates do not pile up while the UI is behind.
+type coalescing interface {
+	supersedes(pending Event) bool
+}
+
+func (e StatsSampled) supersedes(pending Event) bool {
+	_, ok := pending.(StatsSampled)
+	return ok
+}
+
+func (e TransferProgress) supersedes(pending Event) bool {
+	p, ok := pending.(TransferProgress)
+	return ok && !p.Finished && p.Protocol == e.Protocol && p.Sending == e.Sending && p.Name == e.Name
+}
+
+type eventBus struct {
+	mutex   sync.Mutex
+	pending []Event
+	dropped int
+	wake    chan struct{}
+}
+
+func newEventBus() *eventBus {
+	return &eventBus{wake: make(chan struct{}, 1)}
+}
+
+func (b *eventBus) add(event Event) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	if c, ok := event.(coalescing); ok {
+		for i := len(b.pending) - 1; i >= 0; i-- {
+			if c.supersedes(b.pending[i]) {
+				b.pending[i] = event
+				return
+			}
+		}
+	}
+	if len(b.pending) >= maxPendingEvents {
+		b.pending = append(b.pending[:0], b.pending[1:]...)
+		b.dropped++
+	}
+	b.pending = append(b.pending, event)
+}
+
+func (b *eventBus) take() ([]Event, int) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	pending, dropped := b.pending, b.dropped
+	b.pending = nil
+	b.dropped = 0
+	return pending, dropped
+}
+
+// Publish never blocks: events are queued and the UI goroutine is woken up.
+func (u *UserInterface) Publish(event Event) {
+	u.events.add(event)
+	select {
+	case u.events.wake <- struct{}{}:
+	default:
+	}
+}
+
+// RunEvents applies the published events in batches until ctx is cancelled,
+// waiting for each batch before taking the next one.
+func (u *UserInterface) RunEvents(ctx context.Context) {
+	for {
+		select {
+		case <-u.events.wake:
+		case <-ctx.Done():
+			return
+		}
+		pending, dropped := u.events.take()
+		applied := make(chan struct{})
+		fyne.Do(func() {
+			defer close(applied)
+			if dropped > 0 {
+				u.Notifier.Notify(SeverityWarning, fmt.Sprintf("%d interface updates dropped", dropped))
+			}
+			for _, event := range pending {
+				event.apply(u)
+			}
+			u.OutputView.Flush()
+			u.DebugView.Flush()
+		})
+		select {
+		case <-applied:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
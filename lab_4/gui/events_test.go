@@ -0,0 +1,52 @@
+package gui
+
+import "testing"
+
+func TestEventBusCoalesces(t *testing.T) {
+	bus := newEventBus()
+	bus.add(StatsSampled{})
+	bus.add(TransferProgress{Name: "a.txt", Done: 1})
+	bus.add(FrameReceived{Data: "0000110"})
+	bus.add(TransferProgress{Name: "b.txt", Done: 1})
+	bus.add(TransferProgress{Name: "a.txt", Done: 2})
+	bus.add(StatsSampled{})
+	bus.add(TransferProgress{Name: "a.txt", Done: 3, Finished: true})
+	bus.add(TransferProgress{Name: "a.txt", Done: 0})
+	pending, dropped := bus.take()
+	if dropped != 0 {
+		t.Errorf("dropped %d events", dropped)
+	}
+	want := []Event{
+		StatsSampled{},
+		TransferProgress{Name: "a.txt", Done: 3, Finished: true},
+		FrameReceived{Data: "0000110"},
+		TransferProgress{Name: "b.txt", Done: 1},
+		TransferProgress{Name: "a.txt", Done: 0},
+	}
+	if len(pending) != len(want) {
+		t.Fatalf("pending %v, want %v", pending, want)
+	}
+	for i := range want {
+		if pending[i] != want[i] {
+			t.Errorf("pending event %d = %v, want %v", i, pending[i], want[i])
+		}
+	}
+}
+
+func TestEventBusDropsOldest(t *testing.T) {
+	bus := newEventBus()
+	for i := 0; i < maxPendingEvents+10; i++ {
+		bus.add(FrameReceived{Data: string(rune('0' + i%2))})
+	}
+	bus.add(LogLine{Text: "last"})
+	pending, dropped := bus.take()
+	if len(pending) != maxPendingEvents || dropped != 11 {
+		t.Fatalf("%d events pending and %d dropped, want %d and 11", len(pending), dropped, maxPendingEvents)
+	}
+	if pending[len(pending)-1] != (LogLine{Text: "last"}) {
+		t.Errorf("last event %v, want the newest", pending[len(pending)-1])
+	}
+	if pending, dropped = bus.take(); len(pending) != 0 || dropped != 0 {
+		t.Errorf("take() after take() = %v, %d", pending, dropped)
+	}
+}
@@ -1,6 +1,7 @@
 package gui
 
 import (
+	"errors"
 	"fmt"
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/container"
@@ -8,19 +9,16 @@ import (
 	"fyne.io/fyne/v2/theme"
 	"fyne.io/fyne/v2/widget"
 	"image/color"
+	"lab_4/config"
+	"lab_4/logging"
+	"lab_4/queue"
 	"lab_4/rs232"
-	"log"
-	"strings"
+	"lab_4/settings"
+	"lab_4/stack"
+	"time"
 )
 
-type LogWriter struct {
-	entry *widget.Entry
-}
-
-func (lw *LogWriter) Write(p []byte) (n int, err error) {
-	lw.entry.SetText(lw.entry.Text + string(p))
-	return len(p), nil
-}
+var logger = logging.For("gui")
 
 type СustomTheme struct {
 	fyne.Theme
@@ -37,11 +35,7 @@ func (c СustomTheme) Color(name fyne.ThemeColorName, variant fyne.ThemeVariant)
 
 func ErrorWindow(err error, a fyne.App) {
 	w := a.NewWindow("Error")
-	done := make(chan struct{})
-	ok := widget.NewButton("Ok", func() {
-		w.Close()
-		close(done)
-	})
+	ok := widget.NewButton("Ok", func() { w.Close() })
 	ok.Resize(fyne.NewSize(250, 75))
 	w.SetContent(container.NewVBox(
 		container.NewCenter(
@@ -50,90 +44,106 @@ func ErrorWindow(err error, a fyne.App) {
 	)
 	w.SetFixedSize(true)
 	w.Show()
-	<-done
 }
 
+// UserInterface is one link of the window: its port pair, its protocol
+// stack and the views of what it does.
 type UserInterface struct {
 	App              fyne.App
+	Window           fyne.Window
+	Name             string
+	Stack            *stack.Stack
 	InputPort        *rs232.Port
 	OutputPort       *rs232.Port
 	TransmittedBytes int
+	SendQueue        *queue.Queue
 	InputEntry       *widget.Entry
-	OutputEntry      *widget.Entry
+	OutputView       *LogView
 	StatusEntry      *widget.Entry
-	DebugEntry       *widget.Entry
+	DebugView        *LogView
+	Notifier         *Notifier
+	Waveform         *Waveform
+	Timeline         *Timeline
+	Dashboard        *Dashboard
+	Transfers        *TransferPanel
+	Modem            *ModemPanel
+	Inspector        *Inspector
+	OnSendFile       func(name string, content []byte)
+	OnInjectFrame    func(frame []byte) error
+	OnClose          func()
+	OnProfilesSaved  func()
+	Composer         *Composer
+	Config           *config.File
+	ConfigPath       string
+	Profile          string
+	Settings         *Settings
+	LinkPanel        *LinkPanel
+	ModemHandlers    ModemHandlers
+	InspectHandlers  InspectHandlers
 	SelectInputPort  *widget.Select
 	SelectOutputPort *widget.Select
 	Grid             *fyne.Container
+	inputText        string
+	events           *eventBus
 }
 
 func (u *UserInterface) InitSelects(ports []string) {
 	u.SelectInputPort = widget.NewSelect(
 		ports,
 		func(s string) {
-			u.InputEntry.Text = ""
-			if u.InputPort.SerialPort != nil {
+			u.Publish(InputCleared{})
+			if u.InputPort.IsOpen() {
 				err := u.InputPort.ClosePort()
 				if err != nil {
-					ErrorWindow(err, u.App)
+					u.Publish(Error{Err: err})
 				}
 			}
 			_, err := u.InputPort.OpenPort(s)
 			if err != nil {
-				ErrorWindow(err, u.App)
-			}
-			err = UpdatePorts(u.SelectInputPort, u.SelectOutputPort)
-			if err != nil {
-				ErrorWindow(err, u.App)
+				u.Publish(Error{Err: err})
 			}
+			go u.RefreshPorts()
 		},
 	)
 	u.SelectInputPort.PlaceHolder = "Transmitter"
 	u.SelectOutputPort = widget.NewSelect(
 		ports,
 		func(s string) {
-			u.OutputEntry.SetText("")
+			u.OutputView.Clear()
 			_, err := u.OutputPort.OpenPort(s)
 			if err != nil {
-				ErrorWindow(err, u.App)
-			}
-			err = UpdatePorts(u.SelectInputPort, u.SelectOutputPort)
-			if err != nil {
-				ErrorWindow(err, u.App)
+				u.Publish(Error{Err: err})
 			}
+			go u.RefreshPorts()
 		},
 	)
 	u.SelectOutputPort.PlaceHolder = "Receiver"
 }
 
 func (u *UserInterface) InitEntries() {
+	u.events = newEventBus()
 	u.InputEntry = widget.NewMultiLineEntry()
 	u.InputEntry.PlaceHolder = "Write some text..."
-	prevText := u.InputEntry.Text
 	u.InputEntry.OnChanged = func(newText string) {
-		if len(newText) < len(prevText) || !strings.HasPrefix(newText, prevText) {
-			u.InputEntry.SetText(prevText)
-			u.InputEntry.CursorRow = len(prevText)
-		} else {
-			filteredText := ""
-			for _, char := range newText {
-				if char == '1' || char == '0' || char == '\n' {
-					filteredText += string(char)
-				}
-			}
-			if filteredText != newText {
-				u.InputEntry.SetText(filteredText)
-				u.InputEntry.CursorRow = len(filteredText)
-			} else {
-				prevText = filteredText
-			}
-		}
+		u.Publish(inputChanged{text: newText})
 	}
-	u.OutputEntry = InitReadOnlyEntry()
+	u.OutputView = NewLogView(2000, false)
 	u.StatusEntry = InitReadOnlyEntry()
-	u.DebugEntry = InitReadOnlyEntry()
-	log.SetFlags(log.Ltime)
-	log.SetOutput(&LogWriter{entry: u.DebugEntry})
+	u.DebugView = NewLogView(2000, true)
+	u.Notifier = NewNotifier(u.App, 100)
+	u.Waveform = NewWaveform()
+	u.Timeline = NewTimeline()
+	u.Dashboard = NewDashboard(func() fyne.Window { return u.Window }, u.Stack)
+	u.Transfers = NewTransferPanel(func() fyne.Window { return u.Window },
+		func(name string, content []byte) {
+			if u.OnSendFile != nil {
+				u.OnSendFile(name, content)
+			}
+		})
+	u.Modem = NewModemPanel(func() fyne.Window { return u.Window },
+		func() ModemHandlers { return u.ModemHandlers })
+	u.Inspector = NewInspector(func() InspectHandlers { return u.InspectHandlers })
+	u.LinkPanel = NewLinkPanel(u.Stack.Settings, u.profileLink)
 }
 
 func InitReadOnlyEntry() *widget.Entry {
@@ -144,39 +154,107 @@ func InitReadOnlyEntry() *widget.Entry {
 }
 
 func (u *UserInterface) MakeGrid() {
+	profiles := widget.NewButton("Profiles", u.ShowSettings)
 	statusBorder := container.NewBorder(
-		container.NewCenter(widget.NewLabel("Status")),
+		container.NewBorder(nil, nil, nil, profiles,
+			container.NewCenter(widget.NewLabel("Status"))),
 		nil, nil, nil,
 		u.StatusEntry,
 	)
+	logLevel := widget.NewSelect(Levels, func(name string) {
+		level, err := logging.ParseLevel(name)
+		if err == nil {
+			logging.Level.Set(level)
+		}
+	})
+	logLevel.SetSelected(logging.Level.Level().String())
 	debugBorder := container.NewBorder(
-		container.NewCenter(widget.NewLabel("Debug")),
+		container.NewBorder(nil, nil, nil, logLevel,
+			container.NewCenter(widget.NewLabel("Debug"))),
 		nil, nil, nil,
-		u.DebugEntry,
+		u.DebugView.Content(),
 	)
 	column1 := container.NewGridWithRows(2,
 		statusBorder,
 		debugBorder,
 	)
+	compose := widget.NewButton("Compose frame", u.ShowComposer)
 	column2 := container.NewBorder(
 		container.NewVBox(u.SelectInputPort,
-			container.NewCenter(widget.NewLabel("Transmitted data"))),
+			container.NewBorder(nil, nil, nil, compose,
+				container.NewCenter(widget.NewLabel("Transmitted data")))),
 		nil, nil, nil,
 		u.InputEntry)
 	column3 := container.NewBorder(
 		container.NewVBox(u.SelectOutputPort,
 			container.NewCenter(widget.NewLabel("Received data"))),
 		nil, nil, nil,
-		u.OutputEntry)
-	u.Grid = container.New(
+		u.OutputView.Content())
+	columns := container.New(
 		layout.NewGridLayoutWithColumns(3),
 		column1,
 		column2,
 		column3)
+	signals := container.NewAppTabs(
+		container.NewTabItem("Timeline", u.Timeline.Content()),
+		container.NewTabItem("Line code", u.Waveform.Content()),
+		container.NewTabItem("Statistics", u.Dashboard.Content()),
+		container.NewTabItem("Files", container.NewVBox(u.Transfers.Content(), u.Modem.Content())),
+		container.NewTabItem("Inspector", u.Inspector.Content()),
+		container.NewTabItem("Link", u.LinkPanel.Content()),
+	)
+	u.Grid = container.NewBorder(nil,
+		container.NewVBox(signals, u.Notifier.Content()),
+		nil, nil, columns)
+}
+
+func (u *UserInterface) ShowComposer() {
+	if u.Composer == nil {
+		u.Composer = NewComposer(u.Window, u.Stack.Framer, func(frame []byte) error {
+			if u.OnInjectFrame == nil {
+				return errors.New("Frame injection is not available")
+			}
+			return u.OnInjectFrame(frame)
+		})
+	}
+	u.Composer.Show()
+}
+
+func (u *UserInterface) ShowSettings() {
+	if u.Settings == nil {
+		if u.Config == nil {
+			u.Config = config.Default()
+		}
+		if u.Profile == "" {
+			u.Profile = u.Config.Profile
+		}
+		u.Settings = NewSettings(u.Window, u.Notifier, u.Config, u.ConfigPath, u.Profile, u.OnProfilesSaved)
+	}
+	u.Settings.Show()
+}
+
+// profileLink gives the link settings of the profile the session started
+// with.
+func (u *UserInterface) profileLink() (settings.Link, error) {
+	if u.Config == nil {
+		return config.Builtin[config.DefaultProfile].Link(), nil
+	}
+	profile, err := u.Config.Get(u.Profile)
+	if err != nil {
+		return settings.Link{}, err
+	}
+	return profile.Link(), nil
+}
+
+// Inspect shows the traffic of port in the inspector.
+func (u *UserInterface) Inspect(port *rs232.Port) {
+	port.SetTap(func(direction rs232.Direction, name string, data []byte) {
+		u.Publish(RawChunk{Time: time.Now(), Direction: direction, Port: name, Data: data})
+	})
 }
 
 func (u *UserInterface) UpdateStatus(formattedPacket string) {
-	mode := rs232.DefaultConfig()
+	mode := u.InputPort.Mode()
 	status := fmt.Sprintf("Ports parameters:\n"+
 		"Baudrate - %d\nData bits - %d\nStop bits - %d\n"+
 		"Parity - No\nStatus bits - RTS=true, DTR=true\n"+
@@ -185,15 +263,12 @@ func (u *UserInterface) UpdateStatus(formattedPacket string) {
 	u.StatusEntry.SetText(status)
 }
 
-func UpdatePorts(selectInputPort, selectOutputPort *widget.Select) error {
+func (u *UserInterface) RefreshPorts() {
 	newPorts, err := rs232.RemovePorts()
 	if err != nil {
-		return err
+		u.Publish(Error{Err: err})
+		return
 	}
-	selectInputPort.Options = newPorts
-	selectOutputPort.Options = newPorts
-	selectInputPort.Refresh()
-	selectOutputPort.Refresh()
-	//log.Printf("Ports list updated successful\n")
-	return nil
+	u.Publish(PortsUpdated{Ports: newPorts})
+	logger.Debug("Ports list updated", "ports", len(newPorts))
 }
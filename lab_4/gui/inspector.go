@@ -0,0 +1,417 @@
+package gui
+
+import (
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"image/color"
+	"lab_4/rs232"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ByteMark is what a byte of raw line data was recognised as.
+type ByteMark byte
+
+const (
+	MarkNone ByteMark = iota
+	MarkFlag
+	MarkJam
+	// MarkEnd is an idle or abort symbol: the frame before it is over.
+	MarkEnd
+	MarkControl
+)
+
+const (
+	maxChunks     = 5000
+	maxFrameBytes = 4096
+	bytesPerRow   = 8
+	previewBytes  = 12
+	bothWays      = "Both ways"
+	inspectHeight = 160
+)
+
+var directions = []string{bothWays, "Read", "Written"}
+
+var markColors = map[ByteMark]color.Color{
+	MarkFlag:    color.NRGBA{R: 0xfb, G: 0xc0, B: 0x2d, A: 0xff},
+	MarkJam:     collisionColor,
+	MarkEnd:     idleColor,
+	MarkControl: idleColor,
+}
+
+// InspectHandlers recognise and decode line data; the GUI does not know
+// the line symbols itself. Both get the bytes of one port and direction
+// starting after an idle symbol.
+type InspectHandlers struct {
+	Mark   func(line []byte) []ByteMark
+	Decode func(line []byte) (string, error)
+}
+
+type inspectedChunk struct {
+	RawChunk
+	marks []ByteMark
+}
+
+func (c *inspectedChunk) key() string {
+	return string(c.Direction) + c.Port
+}
+
+func (c *inspectedChunk) has(mark ByteMark) bool {
+	for _, m := range c.marks {
+		if m == mark {
+			return true
+		}
+	}
+	return false
+}
+
+// openFrame is the data of a port and direction since its last idle
+// symbol; skip bytes of the first chunk belong to the frame before.
+type openFrame struct {
+	chunks []*inspectedChunk
+	skip   int
+}
+
+// Inspector lists every chunk read from and written to the ports. The
+// selected chunk is shown in hex and bits with flags and jams highlighted,
+// and the frame it belongs to is decoded.
+type Inspector struct {
+	handlers  func() InspectHandlers
+	chunks    []*inspectedChunk
+	visible   []*inspectedChunk
+	frames    map[string]*openFrame
+	ports     map[string]bool
+	port      string
+	direction string
+	paused    bool
+	selected  *inspectedChunk
+	list      *widget.List
+	portList  *widget.Select
+	header    *widget.Label
+	dump      *widget.TextGrid
+	decoded   *widget.Label
+	content   fyne.CanvasObject
+}
+
+func NewInspector(handlers func() InspectHandlers) *Inspector {
+	i := &Inspector{
+		handlers: handlers,
+		frames:   make(map[string]*openFrame),
+		ports:    make(map[string]bool),
+		header:   widget.NewLabel("Select a chunk"),
+		dump:     widget.NewTextGrid(),
+		decoded:  widget.NewLabel(""),
+	}
+	i.list = widget.NewList(
+		func() int {
+			return len(i.visible)
+		},
+		func() fyne.CanvasObject {
+			label := widget.NewLabel("")
+			label.TextStyle = fyne.TextStyle{Monospace: true}
+			return label
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			if id < len(i.visible) {
+				item.(*widget.Label).SetText(i.visible[id].summary())
+			}
+		},
+	)
+	i.list.OnSelected = func(id widget.ListItemID) {
+		if id < len(i.visible) {
+			i.selected = i.visible[id]
+			i.showSelected()
+		}
+	}
+	i.portList = widget.NewSelect([]string{allPorts}, func(port string) {
+		i.port = port
+		i.filter()
+	})
+	i.portList.SetSelectedIndex(0)
+	direction := widget.NewSelect(directions, func(direction string) {
+		i.direction = direction
+		i.filter()
+	})
+	direction.SetSelectedIndex(0)
+	pause := widget.NewCheck("Pause", func(paused bool) {
+		i.paused = paused
+		if !paused {
+			i.filter()
+		}
+	})
+	clear := widget.NewButton("Clear", i.Clear)
+	height := canvas.NewRectangle(color.Transparent)
+	height.SetMinSize(fyne.NewSize(0, inspectHeight))
+	i.dump.SetText("")
+	split := container.NewHSplit(i.list, container.NewBorder(i.header, i.decoded, nil, nil,
+		container.NewScroll(i.dump)))
+	i.content = container.NewBorder(
+		container.NewHBox(i.portList, direction, pause, clear),
+		nil, nil, nil,
+		container.NewStack(height, split),
+	)
+	return i
+}
+
+func (i *Inspector) Content() fyne.CanvasObject {
+	return i.content
+}
+
+func (i *Inspector) Add(chunk RawChunk) {
+	c := &inspectedChunk{RawChunk: chunk, marks: make([]ByteMark, len(chunk.Data))}
+	if len(i.chunks) >= maxChunks {
+		i.chunks = append(i.chunks[:0], i.chunks[maxChunks/2:]...)
+		defer i.filter()
+	}
+	i.chunks = append(i.chunks, c)
+	i.mark(c)
+	if !i.ports[c.Port] {
+		i.ports[c.Port] = true
+		ports := make([]string, 0, len(i.ports))
+		for port := range i.ports {
+			ports = append(ports, port)
+		}
+		sort.Strings(ports)
+		i.portList.Options = append([]string{allPorts}, ports...)
+		i.portList.Refresh()
+	}
+	if i.paused || !i.matches(c) {
+		return
+	}
+	i.visible = append(i.visible, c)
+	i.list.Refresh()
+	if i.selected == nil {
+		i.list.ScrollToBottom()
+	}
+}
+
+// mark marks the frame c continues again: a flag is only recognised once
+// its last byte arrives, which may be several chunks later.
+func (i *Inspector) mark(c *inspectedChunk) {
+	mark := i.handlers().Mark
+	if mark == nil {
+		return
+	}
+	frame := i.frames[c.key()]
+	if frame == nil {
+		frame = new(openFrame)
+		i.frames[c.key()] = frame
+	}
+	frame.chunks = append(frame.chunks, c)
+	size := -frame.skip
+	for _, chunk := range frame.chunks {
+		size += len(chunk.Data)
+	}
+	for size > maxFrameBytes && len(frame.chunks) > 1 {
+		size -= len(frame.chunks[0].Data) - frame.skip
+		frame.chunks = frame.chunks[1:]
+		frame.skip = 0
+	}
+	var line []byte
+	for n, chunk := range frame.chunks {
+		if n == 0 {
+			line = append(line, chunk.Data[frame.skip:]...)
+		} else {
+			line = append(line, chunk.Data...)
+		}
+	}
+	marks := mark(line)
+	offset := 0
+	end := -1
+	for n, chunk := range frame.chunks {
+		start := 0
+		if n == 0 {
+			start = frame.skip
+		}
+		for j := start; j < len(chunk.Data) && offset < len(marks); j, offset = j+1, offset+1 {
+			chunk.marks[j] = marks[offset]
+			if marks[offset] == MarkEnd {
+				end = n
+				frame.skip = j + 1
+			}
+		}
+	}
+	if end >= 0 {
+		frame.chunks = frame.chunks[end:]
+		if frame.skip == len(frame.chunks[0].Data) {
+			frame.chunks = frame.chunks[1:]
+			frame.skip = 0
+		}
+	}
+}
+
+func (i *Inspector) Clear() {
+	i.chunks = nil
+	i.frames = make(map[string]*openFrame)
+	i.selected = nil
+	i.list.UnselectAll()
+	i.header.SetText("Select a chunk")
+	i.dump.SetText("")
+	i.decoded.SetText("")
+	i.filter()
+}
+
+func (i *Inspector) matches(c *inspectedChunk) bool {
+	if i.port != "" && i.port != allPorts && c.Port != i.port {
+		return false
+	}
+	switch i.direction {
+	case "Read":
+		return c.Direction == rs232.Read
+	case "Written":
+		return c.Direction == rs232.Write
+	}
+	return true
+}
+
+func (i *Inspector) filter() {
+	if i.paused {
+		return
+	}
+	i.visible = i.visible[:0]
+	for _, c := range i.chunks {
+		if i.matches(c) {
+			i.visible = append(i.visible, c)
+		}
+	}
+	i.list.Refresh()
+}
+
+func (c *inspectedChunk) summary() string {
+	preview := c.Data
+	if len(preview) > previewBytes {
+		preview = preview[:previewBytes]
+	}
+	hex := make([]string, len(preview))
+	for n, b := range preview {
+		hex[n] = fmt.Sprintf("%02x", b)
+	}
+	text := fmt.Sprintf("%s %c %s %4d  %s", c.Time.Format("15:04:05.000000"), c.Direction,
+		c.Port, len(c.Data), strings.Join(hex, " "))
+	if len(c.Data) > previewBytes {
+		text += " ..."
+	}
+	for _, tag := range []struct {
+		mark ByteMark
+		name string
+	}{{MarkFlag, "flag"}, {MarkJam, "jam"}, {MarkEnd, "end"}} {
+		if c.has(tag.mark) {
+			text += " [" + tag.name + "]"
+		}
+	}
+	return text
+}
+
+func (i *Inspector) showSelected() {
+	c := i.selected
+	i.header.SetText(fmt.Sprintf("%s %s %s, %d bytes", directionName(c.Direction), c.Port,
+		c.Time.Format(time.StampMicro), len(c.Data)))
+	i.dump.Rows = dumpRows(c)
+	i.dump.Refresh()
+	decode := i.handlers().Decode
+	if decode == nil {
+		i.decoded.SetText("")
+		return
+	}
+	data, err := decode(i.frameOf(c))
+	if err != nil {
+		i.decoded.SetText("Frame does not decode: " + err.Error())
+	} else {
+		i.decoded.SetText("Frame data: " + strings.ReplaceAll(data, "\n", "\\n"))
+	}
+}
+
+func directionName(direction rs232.Direction) string {
+	if direction == rs232.Read {
+		return "Read from"
+	}
+	return "Written to"
+}
+
+// dumpRows shows bytesPerRow bytes a row: offset, hex and bits.
+func dumpRows(c *inspectedChunk) []widget.TextGridRow {
+	var rows []widget.TextGridRow
+	for offset := 0; offset < len(c.Data); offset += bytesPerRow {
+		var cells []widget.TextGridCell
+		addText := func(text string, style widget.TextGridStyle) {
+			for _, r := range text {
+				cells = append(cells, widget.TextGridCell{Rune: r, Style: style})
+			}
+		}
+		end := min(offset+bytesPerRow, len(c.Data))
+		addText(fmt.Sprintf("%04x  ", offset), nil)
+		for j := offset; j < offset+bytesPerRow; j++ {
+			if j < end {
+				addText(fmt.Sprintf("%02x", c.Data[j]), markStyle(c.marks[j]))
+			} else {
+				addText("  ", nil)
+			}
+			addText(" ", nil)
+		}
+		addText(" ", nil)
+		for j := offset; j < end; j++ {
+			addText(fmt.Sprintf("%08b", c.Data[j]), markStyle(c.marks[j]))
+			addText(" ", nil)
+		}
+		rows = append(rows, widget.TextGridRow{Cells: cells})
+	}
+	return rows
+}
+
+func markStyle(mark ByteMark) widget.TextGridStyle {
+	background, ok := markColors[mark]
+	if !ok {
+		return nil
+	}
+	return &widget.CustomTextGridStyle{BGColor: background}
+}
+
+// frameOf collects the data of the frame c belongs to: from the last idle
+// symbol before it to the first one at or after it.
+func (i *Inspector) frameOf(c *inspectedChunk) []byte {
+	index := -1
+	for n, chunk := range i.chunks {
+		if chunk == c {
+			index = n
+			break
+		}
+	}
+	if index < 0 {
+		return c.Data
+	}
+	key := c.key()
+	var line []byte
+	for n := index - 1; n >= 0 && len(line) < maxFrameBytes; n-- {
+		chunk := i.chunks[n]
+		if chunk.key() != key {
+			continue
+		}
+		start := 0
+		for j, mark := range chunk.marks {
+			if mark == MarkEnd {
+				start = j + 1
+			}
+		}
+		line = append(append([]byte(nil), chunk.Data[start:]...), line...)
+		if start > 0 {
+			break
+		}
+	}
+	for n := index; n < len(i.chunks) && len(line) < maxFrameBytes; n++ {
+		chunk := i.chunks[n]
+		if chunk.key() != key {
+			continue
+		}
+		for j, mark := range chunk.marks {
+			if mark == MarkEnd {
+				return append(line, chunk.Data[:j+1]...)
+			}
+		}
+		line = append(line, chunk.Data...)
+	}
+	return line
+}
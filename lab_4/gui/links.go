@@ -0,0 +1,110 @@
+package gui
+
+import (
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"lab_4/config"
+	"lab_4/logging"
+	"log/slog"
+	"sync"
+)
+
+// Links is the application window: a tab per link, each an independent
+// UserInterface, and a bar to open more from the profiles. Notifier shows
+// what went wrong opening one, as no link tab is there to show it.
+type Links struct {
+	App      fyne.App
+	Window   fyne.Window
+	Notifier *Notifier
+	// OnOpen starts a link with the named profile and adds it with Add.
+	OnOpen   func(profile string) error
+	file     *config.File
+	mutex    sync.Mutex
+	links    []*UserInterface
+	opened   int
+	tabs     *container.DocTabs
+	profiles *widget.Select
+	content  fyne.CanvasObject
+}
+
+func NewLinks(app fyne.App, window fyne.Window, file *config.File, profile string) *Links {
+	l := &Links{App: app, Window: window, Notifier: NewNotifier(app, 100), file: file,
+		tabs: container.NewDocTabs()}
+	l.tabs.OnClosed = func(item *container.TabItem) {
+		for _, u := range l.remove(item) {
+			if u.OnClose != nil {
+				u.OnClose()
+			}
+		}
+	}
+	l.profiles = widget.NewSelect(file.Names(), nil)
+	l.profiles.SetSelected(profile)
+	open := widget.NewButton("Open link", func() {
+		if l.OnOpen == nil || l.profiles.Selected == "" {
+			return
+		}
+		err := l.OnOpen(l.profiles.Selected)
+		if err != nil {
+			l.Notifier.Notify(SeverityError, "Open link "+l.profiles.Selected+": "+err.Error())
+		}
+	})
+	l.content = container.NewBorder(
+		container.NewBorder(nil, nil, widget.NewLabel("Profile"), open, l.profiles),
+		l.Notifier.Content(), nil, nil,
+		l.tabs)
+	// Log records are not tied to a link, so every debug view shows them.
+	logging.AddSink(logging.NewLineHandler(func(level slog.Level, line string) {
+		for _, u := range l.Links() {
+			u.Publish(LogLine{Level: level.String(), Text: line})
+		}
+	}))
+	return l
+}
+
+func (l *Links) Content() fyne.CanvasObject {
+	return l.content
+}
+
+// Add shows a link built with MakeGrid in a new tab and selects it.
+func (l *Links) Add(u *UserInterface) {
+	l.mutex.Lock()
+	l.links = append(l.links, u)
+	l.opened++
+	title := fmt.Sprintf("%d: %s", l.opened, u.Name)
+	l.mutex.Unlock()
+	item := container.NewTabItem(title, u.Grid)
+	l.tabs.Append(item)
+	l.tabs.Select(item)
+}
+
+// RefreshProfiles offers the profiles of the configuration file as it is
+// now, after one was saved.
+func (l *Links) RefreshProfiles() {
+	l.profiles.Options = l.file.Names()
+	l.profiles.Refresh()
+}
+
+// Links are the open links in the order they were opened.
+func (l *Links) Links() []*UserInterface {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return append([]*UserInterface(nil), l.links...)
+}
+
+func (l *Links) remove(item *container.TabItem) []*UserInterface {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	var removed []*UserInterface
+	kept := l.links[:0]
+	for _, u := range l.links {
+		if u.Grid == item.Content {
+			removed = append(removed, u)
+			continue
+		}
+		kept = append(kept, u)
+	}
+	l.links = kept
+	return removed
+}
@@ -0,0 +1,113 @@
+package gui
+
+import (
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"lab_4/settings"
+)
+
+// linkSlider is a slider over one whole-number link setting.
+type linkSlider struct {
+	label  string
+	value  func(link *settings.Link) *int
+	limits settings.Range
+	slider *widget.Slider
+	text   *widget.Label
+}
+
+// LinkPanel changes the channel simulation and the FCS mode while the link
+// runs; the transmitter and receiver take them from the next frame on.
+type LinkPanel struct {
+	store   *settings.Store
+	sliders []*linkSlider
+	fcs     *widget.Select
+	status  *widget.Label
+	content fyne.CanvasObject
+}
+
+func NewLinkPanel(store *settings.Store, profile func() (settings.Link, error)) *LinkPanel {
+	p := &LinkPanel{store: store, status: widget.NewLabel("")}
+	p.sliders = []*linkSlider{
+		{label: "Channel busy, %", limits: settings.BusyChanceRange,
+			value: func(link *settings.Link) *int { return &link.BusyChance }},
+		{label: "Collision, %", limits: settings.CollisionChanceRange,
+			value: func(link *settings.Link) *int { return &link.CollisionChance }},
+		{label: "Distortion, %", limits: settings.DistortionChanceRange,
+			value: func(link *settings.Link) *int { return &link.DistortionChance }},
+		{label: "Attempts", limits: settings.MaxAttemptsRange,
+			value: func(link *settings.Link) *int { return &link.MaxAttempts }},
+		{label: "Backoff limit", limits: settings.BackoffLimitRange,
+			value: func(link *settings.Link) *int { return &link.BackoffLimit }},
+	}
+	form := widget.NewForm()
+	for _, s := range p.sliders {
+		s.slider = widget.NewSlider(float64(s.limits.Min), float64(s.limits.Max))
+		s.slider.Step = 1
+		s.text = widget.NewLabel("")
+		s.slider.OnChanged = func(value float64) {
+			link := store.Update(func(link *settings.Link) {
+				*s.value(link) = int(value)
+			})
+			s.text.SetText(fmt.Sprint(*s.value(&link)))
+		}
+		s.slider.OnChangeEnded = func(float64) {
+			p.changed()
+		}
+		form.Append(s.label, container.NewBorder(nil, nil, nil, s.text, s.slider))
+	}
+	p.fcs = widget.NewSelect(settings.FCSModeNames, func(name string) {
+		mode, err := settings.ParseFCSMode(name)
+		if err != nil {
+			return
+		}
+		if store.Current().FCS == mode {
+			return
+		}
+		store.Update(func(link *settings.Link) {
+			link.FCS = mode
+		})
+		p.changed()
+	})
+	form.Append("FCS", p.fcs)
+	reset := widget.NewButton("Reset to profile", func() {
+		link, err := profile()
+		if err != nil {
+			p.status.SetText(err.Error())
+			return
+		}
+		store.Set(link)
+		p.Refresh()
+		p.changed()
+	})
+	p.content = container.NewBorder(nil, nil, nil,
+		container.NewVBox(reset, p.status),
+		form)
+	p.Refresh()
+	return p
+}
+
+func (p *LinkPanel) Content() fyne.CanvasObject {
+	return p.content
+}
+
+// Refresh shows the current settings.
+func (p *LinkPanel) Refresh() {
+	link := p.store.Current()
+	for _, s := range p.sliders {
+		value := *s.value(&link)
+		s.slider.SetValue(float64(value))
+		s.text.SetText(fmt.Sprint(value))
+	}
+	p.fcs.SetSelected(link.FCS.String())
+}
+
+func (p *LinkPanel) changed() {
+	link := p.store.Current()
+	logger.Info("Link settings changed",
+		"busy", link.BusyChance, "collision", link.CollisionChance,
+		"distortion", link.DistortionChance, "attempts", link.MaxAttempts,
+		"backoff_limit", link.BackoffLimit, "fcs", link.FCS.String())
+	p.status.SetText("Changed; applies from the next frame")
+}
@@ -0,0 +1,217 @@
+package gui
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	allLevels   = "All levels"
+	allPorts    = "All ports"
+	maxLineSize = 256
+)
+
+var (
+	Levels      = []string{"DEBUG", "INFO", "WARN", "ERROR"}
+	portPattern = regexp.MustCompile(`/dev/[A-Za-z0-9]+`)
+)
+
+// LogView shows the last lines of an ever-growing text in a virtualised
+// list, so only the visible rows are rendered however long the session is.
+// While paused the shown lines are frozen but new ones are still stored.
+// Appended lines are shown by Flush, once for a whole batch of events.
+type LogView struct {
+	mutex    sync.Mutex
+	ring     *Ring
+	visible  []Line
+	ports    map[string]bool
+	options  []string
+	dirty    bool
+	search   string
+	level    string
+	port     string
+	paused   bool
+	list     *widget.List
+	portList *widget.Select
+	content  fyne.CanvasObject
+}
+
+func NewLogView(capacity int, showLevels bool) *LogView {
+	v := &LogView{
+		ring:  NewRing(capacity),
+		ports: make(map[string]bool),
+	}
+	v.list = widget.NewList(
+		func() int {
+			v.mutex.Lock()
+			defer v.mutex.Unlock()
+			return len(v.visible)
+		},
+		func() fyne.CanvasObject {
+			label := widget.NewLabel("")
+			label.TextStyle = fyne.TextStyle{Monospace: true}
+			return label
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			item.(*widget.Label).SetText(v.text(id))
+		},
+	)
+	search := widget.NewEntry()
+	search.PlaceHolder = "Search..."
+	search.OnChanged = func(text string) {
+		v.setFilter(func() { v.search = text })
+	}
+	v.portList = widget.NewSelect([]string{allPorts}, func(port string) {
+		v.setFilter(func() { v.port = port })
+	})
+	v.portList.SetSelectedIndex(0)
+	pause := widget.NewCheck("Pause", func(paused bool) {
+		v.mutex.Lock()
+		v.paused = paused
+		v.mutex.Unlock()
+		if !paused {
+			v.refresh()
+		}
+	})
+	clear := widget.NewButton("Clear", v.Clear)
+	filters := []fyne.CanvasObject{v.portList}
+	if showLevels {
+		levels := widget.NewSelect(append([]string{allLevels}, Levels...), func(level string) {
+			v.setFilter(func() { v.level = level })
+		})
+		levels.SetSelectedIndex(0)
+		filters = append([]fyne.CanvasObject{levels}, filters...)
+	}
+	filters = append(filters, pause, clear)
+	v.content = container.NewBorder(
+		container.NewBorder(nil, nil, nil, container.NewHBox(filters...), search),
+		nil, nil, nil,
+		v.list,
+	)
+	return v
+}
+
+func (v *LogView) Content() fyne.CanvasObject {
+	return v.content
+}
+
+// Append adds complete lines; text containing several lines is split.
+func (v *LogView) Append(level, text string) {
+	now := time.Now()
+	v.mutex.Lock()
+	for _, part := range strings.Split(strings.TrimRight(text, "\n"), "\n") {
+		v.push(Line{Time: now, Level: level, Port: portPattern.FindString(part), Text: part})
+	}
+	v.mutex.Unlock()
+}
+
+// AppendText continues the last line with a stream of text from port,
+// starting a new line on '\n' or when the line gets too long.
+func (v *LogView) AppendText(port, text string) {
+	now := time.Now()
+	v.mutex.Lock()
+	for _, char := range text {
+		last := v.ring.Last()
+		if last == nil || strings.HasSuffix(last.Text, "\n") || last.Port != port ||
+			len(last.Text) >= maxLineSize {
+			v.push(Line{Time: now, Port: port})
+			last = v.ring.Last()
+		}
+		last.Text += string(char)
+	}
+	v.mutex.Unlock()
+}
+
+// Flush shows the lines appended since the last refresh.
+func (v *LogView) Flush() {
+	v.mutex.Lock()
+	dirty := v.dirty
+	v.mutex.Unlock()
+	if dirty {
+		v.refresh()
+	}
+}
+
+func (v *LogView) Clear() {
+	v.mutex.Lock()
+	v.ring.Clear()
+	v.mutex.Unlock()
+	v.refresh()
+}
+
+func (v *LogView) push(line Line) {
+	v.ring.Push(line)
+	v.dirty = true
+	if line.Port != "" && !v.ports[line.Port] {
+		v.ports[line.Port] = true
+		ports := make([]string, 0, len(v.ports))
+		for port := range v.ports {
+			ports = append(ports, port)
+		}
+		sort.Strings(ports)
+		v.options = append([]string{allPorts}, ports...)
+	}
+}
+
+func (v *LogView) setFilter(update func()) {
+	v.mutex.Lock()
+	update()
+	v.mutex.Unlock()
+	v.refresh()
+}
+
+func (v *LogView) matches(line *Line) bool {
+	if v.level != "" && v.level != allLevels && line.Level != v.level {
+		return false
+	}
+	if v.port != "" && v.port != allPorts && line.Port != v.port {
+		return false
+	}
+	return v.search == "" || strings.Contains(strings.ToLower(line.Text), strings.ToLower(v.search))
+}
+
+func (v *LogView) text(id widget.ListItemID) string {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if id >= len(v.visible) {
+		return ""
+	}
+	line := v.visible[id]
+	text := strings.ReplaceAll(line.Text, "\n", "")
+	if line.Level == "" {
+		return line.Time.Format(time.TimeOnly) + " " + text
+	}
+	return line.Time.Format(time.TimeOnly) + " " + line.Level + " " + text
+}
+
+func (v *LogView) refresh() {
+	v.mutex.Lock()
+	options := v.options
+	v.options = nil
+	paused := v.paused
+	if !paused {
+		v.dirty = false
+		v.visible = v.visible[:0]
+		for i := 0; i < v.ring.Len(); i++ {
+			if line := v.ring.At(i); v.matches(line) {
+				v.visible = append(v.visible, *line)
+			}
+		}
+	}
+	v.mutex.Unlock()
+	if options != nil {
+		v.portList.Options = options
+		v.portList.Refresh()
+	}
+	if paused {
+		return
+	}
+	v.list.Refresh()
+	v.list.ScrollToBottom()
+}
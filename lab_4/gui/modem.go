@@ -0,0 +1,110 @@
+package gui
+
+import (
+	"errors"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"io"
+)
+
+// ModemPanel runs XMODEM, YMODEM and ZMODEM sessions with a device on a
+// port of its own, next to the link.
+type ModemPanel struct {
+	protocol *widget.Select
+	port     *widget.Select
+	send     *widget.Button
+	receive  *widget.Button
+	cancel   *widget.Button
+	content  fyne.CanvasObject
+}
+
+// ModemHandlers start and cancel sessions; the GUI does not know the
+// protocols itself.
+type ModemHandlers struct {
+	Send    func(protocol, port, name string, content []byte)
+	Receive func(protocol, port string)
+	Cancel  func()
+}
+
+func NewModemPanel(window func() fyne.Window, handlers func() ModemHandlers) *ModemPanel {
+	p := &ModemPanel{
+		protocol: widget.NewSelect(nil, nil),
+		port:     widget.NewSelect(nil, nil),
+	}
+	p.protocol.PlaceHolder = "Protocol"
+	p.port.PlaceHolder = "Device port"
+	p.send = widget.NewButton("Send", func() {
+		protocol, port, err := p.selected()
+		if err != nil {
+			dialog.ShowError(err, window())
+			return
+		}
+		dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil || reader == nil {
+				return
+			}
+			defer reader.Close()
+			content, err := io.ReadAll(reader)
+			if err != nil {
+				dialog.ShowError(err, window())
+				return
+			}
+			handlers().Send(protocol, port, reader.URI().Name(), content)
+		}, window())
+	})
+	p.receive = widget.NewButton("Receive", func() {
+		protocol, port, err := p.selected()
+		if err != nil {
+			dialog.ShowError(err, window())
+			return
+		}
+		handlers().Receive(protocol, port)
+	})
+	p.cancel = widget.NewButton("Cancel", func() {
+		handlers().Cancel()
+	})
+	p.cancel.Disable()
+	p.content = container.NewHBox(widget.NewLabel("Device"), p.protocol, p.port, p.send, p.receive, p.cancel)
+	return p
+}
+
+func (p *ModemPanel) selected() (string, string, error) {
+	if p.protocol.Selected == "" || p.port.Selected == "" {
+		return "", "", errors.New("Choose the protocol and the device port")
+	}
+	return p.protocol.Selected, p.port.Selected, nil
+}
+
+func (p *ModemPanel) Content() fyne.CanvasObject {
+	return p.content
+}
+
+func (p *ModemPanel) SetProtocols(names []string) {
+	p.protocol.Options = names
+	if len(names) > 0 && p.protocol.Selected == "" {
+		p.protocol.SetSelected(names[0])
+	}
+	p.protocol.Refresh()
+}
+
+func (p *ModemPanel) SetPorts(ports []string) {
+	p.port.Options = ports
+	p.port.Refresh()
+}
+
+func (p *ModemPanel) SetRunning(running bool) {
+	for _, button := range []*widget.Button{p.send, p.receive} {
+		if running {
+			button.Disable()
+		} else {
+			button.Enable()
+		}
+	}
+	if running {
+		p.cancel.Enable()
+	} else {
+		p.cancel.Disable()
+	}
+}
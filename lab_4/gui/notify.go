@@ -0,0 +1,155 @@
+package gui
+
+import (
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/widget"
+	"sync"
+	"time"
+)
+
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "INFO"
+	case SeverityWarning:
+		return "WARN"
+	default:
+		return "ERROR"
+	}
+}
+
+type Notification struct {
+	Severity Severity
+	Message  string
+	Count    int
+	First    time.Time
+	Last     time.Time
+}
+
+func (n Notification) String() string {
+	text := fmt.Sprintf("[%s] %s", n.Severity, n.Message)
+	if n.Count > 1 {
+		text += fmt.Sprintf(" (x%d)", n.Count)
+	}
+	return text
+}
+
+// Notifier collects notifications without ever blocking the caller.
+// Repeated messages of the same severity are merged into one entry with a
+// counter, and the most recently updated entry is shown in the status bar.
+type Notifier struct {
+	mutex   sync.Mutex
+	history []*Notification
+	limit   int
+	app     fyne.App
+	latest  *widget.Label
+	list    *widget.List
+	window  fyne.Window
+	content fyne.CanvasObject
+}
+
+func NewNotifier(a fyne.App, limit int) *Notifier {
+	n := &Notifier{app: a, limit: limit}
+	n.latest = widget.NewLabel("No notifications")
+	n.latest.Truncation = fyne.TextTruncateEllipsis
+	n.list = widget.NewList(
+		func() int {
+			n.mutex.Lock()
+			defer n.mutex.Unlock()
+			return len(n.history)
+		},
+		func() fyne.CanvasObject {
+			return widget.NewLabel("")
+		},
+		func(id widget.ListItemID, item fyne.CanvasObject) {
+			item.(*widget.Label).SetText(n.describe(id))
+		},
+	)
+	n.content = container.NewBorder(nil, nil, nil,
+		container.NewHBox(
+			widget.NewButton("History", n.ShowHistory),
+			widget.NewButton("Dismiss", n.Dismiss),
+		),
+		n.latest,
+	)
+	return n
+}
+
+func (n *Notifier) Content() fyne.CanvasObject {
+	return n.content
+}
+
+func (n *Notifier) Notify(severity Severity, message string) {
+	now := time.Now()
+	n.mutex.Lock()
+	var current *Notification
+	for i, item := range n.history {
+		if item.Severity == severity && item.Message == message {
+			current = item
+			n.history = append(n.history[:i], n.history[i+1:]...)
+			break
+		}
+	}
+	if current == nil {
+		current = &Notification{Severity: severity, Message: message, First: now}
+	}
+	current.Count++
+	current.Last = now
+	n.history = append([]*Notification{current}, n.history...)
+	if len(n.history) > n.limit {
+		n.history = n.history[:n.limit]
+	}
+	text := current.String()
+	n.mutex.Unlock()
+	n.latest.SetText(text)
+	n.list.Refresh()
+}
+
+func (n *Notifier) Dismiss() {
+	n.latest.SetText("No notifications")
+}
+
+func (n *Notifier) History() []Notification {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	history := make([]Notification, len(n.history))
+	for i, item := range n.history {
+		history[i] = *item
+	}
+	return history
+}
+
+func (n *Notifier) ShowHistory() {
+	if n.window != nil {
+		n.window.RequestFocus()
+		return
+	}
+	n.window = n.app.NewWindow("Notifications")
+	n.window.SetContent(n.list)
+	n.window.Resize(fyne.NewSize(500, 300))
+	n.window.SetOnClosed(func() {
+		n.window = nil
+	})
+	n.window.Show()
+}
+
+func (n *Notifier) describe(id widget.ListItemID) string {
+	n.mutex.Lock()
+	defer n.mutex.Unlock()
+	if id >= len(n.history) {
+		return ""
+	}
+	item := n.history[id]
+	return fmt.Sprintf("%s - %s %s", item.First.Format(time.TimeOnly),
+		item.Last.Format(time.TimeOnly), item)
+}
@@ -0,0 +1,59 @@
+package gui
+
+import "time"
+
+type Line struct {
+	Time  time.Time
+	Level string
+	Port  string
+	Text  string
+}
+
+// Ring keeps the last Cap lines; pushing into a full ring drops the oldest.
+type Ring struct {
+	lines []Line
+	start int
+	size  int
+}
+
+func NewRing(capacity int) *Ring {
+	return &Ring{lines: make([]Line, capacity)}
+}
+
+func (r *Ring) Cap() int {
+	return len(r.lines)
+}
+
+func (r *Ring) Len() int {
+	return r.size
+}
+
+func (r *Ring) Push(line Line) {
+	if len(r.lines) == 0 {
+		return
+	}
+	if r.size < len(r.lines) {
+		r.lines[(r.start+r.size)%len(r.lines)] = line
+		r.size++
+		return
+	}
+	r.lines[r.start] = line
+	r.start = (r.start + 1) % len(r.lines)
+}
+
+// At returns the i-th line counting from the oldest one.
+func (r *Ring) At(i int) *Line {
+	return &r.lines[(r.start+i)%len(r.lines)]
+}
+
+func (r *Ring) Last() *Line {
+	if r.size == 0 {
+		return nil
+	}
+	return r.At(r.size - 1)
+}
+
+func (r *Ring) Clear() {
+	r.start = 0
+	r.size = 0
+}
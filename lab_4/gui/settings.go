@@ -0,0 +1,244 @@
+package gui
+
+import (
+	"errors"
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"lab_4/config"
+	"lab_4/framing"
+	"lab_4/linecode"
+	"lab_4/settings"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrNoConfigFile = errors.New("No configuration file, start with -config")
+
+// profileField is a value of a profile edited as text.
+type profileField struct {
+	key   string
+	label string
+	get   func(p *config.Profile) string
+	set   func(p *config.Profile, text string) error
+	entry *widget.Entry
+}
+
+func intField(key, label string, value func(p *config.Profile) *int) *profileField {
+	return &profileField{
+		key:   key,
+		label: label,
+		get: func(p *config.Profile) string {
+			return strconv.Itoa(*value(p))
+		},
+		set: func(p *config.Profile, text string) error {
+			number, err := strconv.Atoi(text)
+			if err != nil {
+				return errors.New("Must be a whole number")
+			}
+			*value(p) = number
+			return nil
+		},
+	}
+}
+
+// validate checks the field alone, on top of the default profile.
+func (f *profileField) validate(text string) error {
+	profile := config.Builtin[config.DefaultProfile]
+	err := f.set(&profile, text)
+	if err != nil {
+		return err
+	}
+	for _, err := range profile.Validate() {
+		if err.Field == f.key {
+			return err.Err
+		}
+	}
+	return nil
+}
+
+// Settings edits the profiles of the configuration file. Saved profiles
+// are used by the links opened after.
+type Settings struct {
+	file     *config.File
+	path     string
+	active   string
+	profiles *widget.Select
+	name     *widget.Entry
+	fields   []*profileField
+	framing  *widget.Select
+	lineCode *widget.Select
+	fcs      *widget.Select
+	startup  *widget.Check
+	status   *widget.Label
+	notifier *Notifier
+	saved    func()
+	dialog   dialog.Dialog
+}
+
+// NewSettings edits file; saved is called after every save. Profiles that
+// do not validate when opened are reported to notifier.
+func NewSettings(window fyne.Window, notifier *Notifier, file *config.File, path, active string,
+	saved func()) *Settings {
+	s := &Settings{
+		notifier: notifier,
+		saved:    saved,
+		file:     file,
+		path:     path,
+		active:   active,
+		name:     widget.NewEntry(),
+		framing:  widget.NewSelect(framing.Names(), nil),
+		lineCode: widget.NewSelect(linecode.Names(), nil),
+		fcs:      widget.NewSelect(settings.FCSModeNames, nil),
+		startup:  widget.NewCheck("Use at startup", nil),
+		status:   widget.NewLabel(""),
+	}
+	s.status.Wrapping = fyne.TextWrapWord
+	s.fields = []*profileField{
+		intField("baud_rate", "Baud rate", func(p *config.Profile) *int { return &p.BaudRate }),
+		intField("data_bits", "Data bits", func(p *config.Profile) *int { return &p.DataBits }),
+		intField("busy_chance", "Channel busy, %", func(p *config.Profile) *int { return &p.BusyChance }),
+		intField("collision_chance", "Collision, %", func(p *config.Profile) *int { return &p.CollisionChance }),
+		intField("distortion_chance", "Distortion, %", func(p *config.Profile) *int { return &p.DistortionChance }),
+		intField("max_attempts", "Attempts", func(p *config.Profile) *int { return &p.MaxAttempts }),
+		intField("backoff_limit", "Backoff limit", func(p *config.Profile) *int { return &p.BackoffLimit }),
+		{
+			key:   "slot_time",
+			label: "Slot time",
+			get: func(p *config.Profile) string {
+				return p.SlotTime.String()
+			},
+			set: func(p *config.Profile, text string) error {
+				duration, err := time.ParseDuration(text)
+				if err != nil {
+					return errors.New("Must be a duration such as 1ms")
+				}
+				p.SlotTime = duration
+				return nil
+			},
+		},
+	}
+	s.name.Validator = func(text string) error {
+		if text == "" {
+			return config.ErrNoName
+		}
+		return nil
+	}
+	form := widget.NewForm(widget.NewFormItem("Name", s.name))
+	for _, field := range s.fields {
+		field.entry = widget.NewEntry()
+		field.entry.Validator = field.validate
+		form.Append(field.label, field.entry)
+	}
+	form.Append("Framing", s.framing)
+	form.Append("Line code", s.lineCode)
+	form.Append("FCS", s.fcs)
+	s.profiles = widget.NewSelect(file.Names(), s.show)
+	save := widget.NewButton("Save", s.save)
+	save.Importance = widget.HighImportance
+	closeButton := widget.NewButton("Close", func() { s.dialog.Hide() })
+	content := container.NewVBox(
+		s.profiles,
+		form,
+		s.startup,
+		s.status,
+		container.NewHBox(save, closeButton),
+	)
+	s.dialog = dialog.NewCustomWithoutButtons("Profiles", content, window)
+	s.dialog.Resize(fyne.NewSize(420, 0))
+	s.profiles.SetSelected(active)
+	return s
+}
+
+func (s *Settings) Show() {
+	s.dialog.Show()
+}
+
+func (s *Settings) show(name string) {
+	profile, err := s.file.Get(name)
+	if err != nil {
+		s.status.SetText(err.Error())
+		return
+	}
+	s.name.SetText(name)
+	for _, field := range s.fields {
+		field.entry.SetText(field.get(&profile))
+	}
+	s.framing.SetSelected(profile.Framing)
+	s.lineCode.SetSelected(profile.LineCode)
+	s.fcs.SetSelected(profile.FCS)
+	s.startup.SetChecked(s.file.Profile == name)
+	s.status.SetText("")
+	errs := profile.Validate()
+	for _, err := range errs {
+		err.Profile = name
+		s.notifier.Notify(SeverityWarning, "Profile "+err.Error())
+	}
+	s.mark(errs)
+}
+
+// mark shows errs on the entries of their fields and in the status line.
+func (s *Settings) mark(errs []*config.FieldError) {
+	if len(errs) == 0 {
+		return
+	}
+	messages := make([]string, len(errs))
+	for i, err := range errs {
+		messages[i] = err.Error()
+		if err.Field == "name" {
+			s.name.SetValidationError(err.Err)
+		}
+		for _, field := range s.fields {
+			if field.key == err.Field {
+				field.entry.SetValidationError(err.Err)
+			}
+		}
+	}
+	s.status.SetText(strings.Join(messages, "\n"))
+}
+
+func (s *Settings) save() {
+	if s.path == "" {
+		s.status.SetText(ErrNoConfigFile.Error())
+		return
+	}
+	var profile config.Profile
+	valid := true
+	for _, field := range s.fields {
+		err := field.set(&profile, field.entry.Text)
+		field.entry.SetValidationError(err)
+		valid = valid && err == nil
+	}
+	if !valid {
+		s.status.SetText("Correct the marked fields")
+		return
+	}
+	profile.Framing = s.framing.Selected
+	profile.LineCode = s.lineCode.Selected
+	profile.FCS = s.fcs.Selected
+	name := s.name.Text
+	errs := s.file.Set(name, profile)
+	if len(errs) > 0 {
+		s.mark(errs)
+		return
+	}
+	if s.startup.Checked {
+		s.file.Profile = name
+	}
+	err := s.file.Save(s.path)
+	if err != nil {
+		s.status.SetText(err.Error())
+		return
+	}
+	s.profiles.Options = s.file.Names()
+	s.profiles.Selected = name
+	s.profiles.Refresh()
+	if s.saved != nil {
+		s.saved()
+	}
+	s.status.SetText(fmt.Sprintf("Saved to %s; links opened from now on use it, this one keeps %s",
+		s.path, s.active))
+}
@@ -0,0 +1,178 @@
+package gui
+
+import (
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"image/color"
+	"lab_4/packet"
+	"time"
+)
+
+type SpanKind int
+
+const (
+	SpanFrame SpanKind = iota
+	SpanByte
+	SpanCollision
+	SpanJam
+	SpanBackoff
+	SpanIdle
+	SpanAbort
+)
+
+const (
+	slotWidth      = 8
+	timelineHeight = 36
+	maxSpans       = 20000
+	// Backoff gaps grow with their duration but stay readable.
+	pixelsPerMillisecond = 4
+	minGapWidth          = 4
+	maxGapWidth          = 400
+)
+
+var fieldColors = map[packet.Field]color.Color{
+	packet.FieldFlag:        color.NRGBA{R: 0x80, G: 0x80, B: 0x80, A: 0xff},
+	packet.FieldDestination: color.NRGBA{R: 0x42, G: 0x85, B: 0xf4, A: 0xff},
+	packet.FieldSource:      color.NRGBA{R: 0x00, G: 0xac, B: 0xc1, A: 0xff},
+	packet.FieldData:        color.NRGBA{R: 0x34, G: 0xa8, B: 0x53, A: 0xff},
+	packet.FieldFCS:         color.NRGBA{R: 0x9c, G: 0x27, B: 0xb0, A: 0xff},
+	packet.FieldStuffed:     color.NRGBA{R: 0xff, G: 0x98, B: 0x00, A: 0xff},
+}
+
+var (
+	collisionColor = color.NRGBA{R: 0xe5, G: 0x39, B: 0x35, A: 0xff}
+	idleColor      = color.NRGBA{R: 0x60, G: 0x60, B: 0x60, A: 0xff}
+)
+
+// Timeline draws everything the transmitter did in the session, one slot
+// per byte on the line. Frames are separated by a line, collisions are red
+// marks, jams red blocks and backoff delays gaps as long as they lasted.
+type Timeline struct {
+	spans   []TimelineSpan
+	x       float32
+	objects *fyne.Container
+	size    *canvas.Rectangle
+	scroll  *container.Scroll
+	content fyne.CanvasObject
+}
+
+func NewTimeline() *Timeline {
+	t := &Timeline{
+		objects: container.NewWithoutLayout(),
+		size:    canvas.NewRectangle(color.Transparent),
+	}
+	t.size.SetMinSize(fyne.NewSize(0, timelineHeight))
+	t.scroll = container.NewHScroll(container.NewStack(t.size, t.objects))
+	t.content = container.NewBorder(legend(), nil, nil, nil, t.scroll)
+	return t
+}
+
+func legend() fyne.CanvasObject {
+	items := container.NewHBox()
+	for field := packet.FieldFlag; field <= packet.FieldStuffed; field++ {
+		items.Add(legendItem(field.String(), fieldColors[field]))
+	}
+	items.Add(legendItem("Collision / jam", collisionColor))
+	items.Add(legendItem("Idle / abort", idleColor))
+	return items
+}
+
+func legendItem(name string, fill color.Color) fyne.CanvasObject {
+	box := canvas.NewRectangle(fill)
+	box.SetMinSize(fyne.NewSize(10, 10))
+	text := canvas.NewText(name, theme.Color(theme.ColorNameForeground))
+	text.TextSize = theme.CaptionTextSize()
+	return container.NewHBox(container.NewCenter(box), text)
+}
+
+func (t *Timeline) Content() fyne.CanvasObject {
+	return t.content
+}
+
+func (t *Timeline) Add(span TimelineSpan) {
+	if len(t.spans) >= maxSpans {
+		t.spans = append(t.spans[:0], t.spans[maxSpans/2:]...)
+		t.redraw()
+	}
+	t.spans = append(t.spans, span)
+	t.draw(span)
+	t.size.SetMinSize(fyne.NewSize(t.x, timelineHeight))
+	t.objects.Refresh()
+	t.scroll.Offset = fyne.NewPos(max(0, t.x-t.scroll.Size().Width), 0)
+	t.scroll.Refresh()
+}
+
+func (t *Timeline) Clear() {
+	t.spans = t.spans[:0]
+	t.redraw()
+}
+
+func (t *Timeline) redraw() {
+	t.x = 0
+	t.objects.Objects = nil
+	for _, span := range t.spans {
+		t.draw(span)
+	}
+	t.size.SetMinSize(fyne.NewSize(t.x, timelineHeight))
+	t.objects.Refresh()
+}
+
+func (t *Timeline) draw(span TimelineSpan) {
+	switch span.Kind {
+	case SpanFrame:
+		t.x += slotWidth / 2
+		t.line(idleColor, 0, timelineHeight)
+		t.x += slotWidth / 2
+	case SpanByte:
+		t.block(fieldColors[span.Field], 0, timelineHeight)
+		if span.Field == packet.FieldStuffed {
+			t.objects.Add(outline(t.x, 0, slotWidth, timelineHeight))
+		}
+		t.x += slotWidth
+	case SpanCollision:
+		t.line(collisionColor, 0, timelineHeight)
+	case SpanJam:
+		t.block(collisionColor, timelineHeight/4, timelineHeight/2)
+		t.x += slotWidth
+	case SpanBackoff:
+		width := float32(span.End.Sub(span.Start)) / float32(time.Millisecond) * pixelsPerMillisecond
+		width = min(max(width, minGapWidth), maxGapWidth)
+		gap := canvas.NewLine(idleColor)
+		gap.Position1 = fyne.NewPos(t.x, timelineHeight/2)
+		gap.Position2 = fyne.NewPos(t.x+width, timelineHeight/2)
+		t.objects.Add(gap)
+		t.x += width
+	case SpanIdle:
+		t.block(idleColor, timelineHeight/2-1, 2)
+		t.x += slotWidth
+	case SpanAbort:
+		t.block(idleColor, 0, timelineHeight)
+		t.x += slotWidth
+	}
+}
+
+func (t *Timeline) block(fill color.Color, y, height float32) {
+	rect := canvas.NewRectangle(fill)
+	rect.Move(fyne.NewPos(t.x+1, y))
+	rect.Resize(fyne.NewSize(slotWidth-2, height))
+	t.objects.Add(rect)
+}
+
+func (t *Timeline) line(stroke color.Color, y1, y2 float32) {
+	line := canvas.NewLine(stroke)
+	line.StrokeWidth = 2
+	line.Position1 = fyne.NewPos(t.x, y1)
+	line.Position2 = fyne.NewPos(t.x, y2)
+	t.objects.Add(line)
+}
+
+func outline(x, y, width, height float32) fyne.CanvasObject {
+	rect := canvas.NewRectangle(color.Transparent)
+	rect.StrokeColor = theme.Color(theme.ColorNameForeground)
+	rect.StrokeWidth = 1
+	rect.Move(fyne.NewPos(x, y))
+	rect.Resize(fyne.NewSize(width, height))
+	return rect
+}
@@ -0,0 +1,87 @@
+package gui
+
+import (
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/dialog"
+	"fyne.io/fyne/v2/widget"
+	"io"
+	"time"
+)
+
+// TransferPanel shows the file being sent and the one being received.
+type TransferPanel struct {
+	sendLabel    *widget.Label
+	sendBar      *widget.ProgressBar
+	receiveLabel *widget.Label
+	receiveBar   *widget.ProgressBar
+	content      fyne.CanvasObject
+}
+
+func NewTransferPanel(window func() fyne.Window, send func(name string, content []byte)) *TransferPanel {
+	p := &TransferPanel{
+		sendLabel:    widget.NewLabel("Nothing sent"),
+		sendBar:      widget.NewProgressBar(),
+		receiveLabel: widget.NewLabel("Nothing received"),
+		receiveBar:   widget.NewProgressBar(),
+	}
+	sendFile := widget.NewButton("Send file", func() {
+		dialog.ShowFileOpen(func(reader fyne.URIReadCloser, err error) {
+			if err != nil || reader == nil {
+				return
+			}
+			defer reader.Close()
+			content, err := io.ReadAll(reader)
+			if err != nil {
+				dialog.ShowError(err, window())
+				return
+			}
+			send(reader.URI().Name(), content)
+		}, window())
+	})
+	p.content = container.NewBorder(nil, nil, sendFile, nil,
+		container.NewGridWithColumns(2,
+			container.NewVBox(p.sendLabel, p.sendBar),
+			container.NewVBox(p.receiveLabel, p.receiveBar)))
+	return p
+}
+
+func (p *TransferPanel) Content() fyne.CanvasObject {
+	return p.content
+}
+
+func (p *TransferPanel) Update(e TransferProgress) {
+	label, bar := p.receiveLabel, p.receiveBar
+	verb := "Receiving"
+	if e.Sending {
+		label, bar = p.sendLabel, p.sendBar
+		verb = "Sending"
+	}
+	fraction := 0.0
+	if e.Total > 0 {
+		fraction = float64(e.Done) / float64(e.Total)
+	}
+	if e.Finished && e.Err == nil {
+		fraction = 1
+	}
+	bar.SetValue(fraction)
+	switch {
+	case e.Finished && e.Err != nil:
+		label.SetText(fmt.Sprintf("%s %s failed: %v", verb, e.Name, e.Err))
+	case e.Finished && e.Sending:
+		label.SetText(fmt.Sprintf("Sent %s (%d bytes) in %s", e.Name, e.Size, since(e.Started)))
+	case e.Finished:
+		label.SetText(fmt.Sprintf("Saved %s (%d bytes) in %s", e.Path, e.Size, since(e.Started)))
+	case e.Total == 0 && e.Done > 0:
+		label.SetText(fmt.Sprintf("%s %s: %d bytes", verb, e.Name, e.Done))
+	case e.Total == 0:
+		label.SetText(verb + " header...")
+	default:
+		label.SetText(fmt.Sprintf("%s %s: %.0f%%, ETA %s", verb, e.Name, 100*fraction, e.ETA()))
+	}
+}
+
+func since(started time.Time) time.Duration {
+	return time.Since(started).Round(time.Second)
+}
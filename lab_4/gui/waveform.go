@@ -0,0 +1,79 @@
+package gui
+
+import (
+	"fmt"
+	"fyne.io/fyne/v2"
+	"fyne.io/fyne/v2/canvas"
+	"fyne.io/fyne/v2/container"
+	"fyne.io/fyne/v2/theme"
+	"fyne.io/fyne/v2/widget"
+	"image/color"
+	"lab_4/linecode"
+)
+
+const (
+	symbolWidth    = 6
+	waveformHeight = 40
+	waveformMargin = 4
+)
+
+// Waveform draws the line symbols of the last transmitted frame as a square
+// wave, with the numbers that matter for clock recovery and DC balance.
+type Waveform struct {
+	info    *widget.Label
+	lines   *fyne.Container
+	size    *canvas.Rectangle
+	content fyne.CanvasObject
+}
+
+func NewWaveform() *Waveform {
+	w := &Waveform{
+		info:  widget.NewLabel("Line code: no frame sent yet"),
+		lines: container.NewWithoutLayout(),
+		size:  canvas.NewRectangle(nil),
+	}
+	w.size.SetMinSize(fyne.NewSize(0, waveformHeight+2*waveformMargin))
+	w.content = container.NewBorder(w.info, nil, nil, nil,
+		container.NewHScroll(container.NewStack(w.size, w.lines)))
+	return w
+}
+
+func (w *Waveform) Content() fyne.CanvasObject {
+	return w.content
+}
+
+func (w *Waveform) SetSymbols(code string, symbols []byte) {
+	stats := linecode.Analyze(symbols)
+	w.info.SetText(fmt.Sprintf("Line code: %s, %d symbols, balance %+d, %d transitions, longest run %d",
+		code, stats.Symbols, stats.Balance, stats.Transitions, stats.LongestRun))
+	color := theme.Color(theme.ColorNamePrimary)
+	objects := make([]fyne.CanvasObject, 0, 2*len(symbols))
+	for i, symbol := range symbols {
+		x := float32(i * symbolWidth)
+		y := level(symbol)
+		objects = append(objects, segment(color, x, y, x+symbolWidth, y))
+		if i > 0 && level(symbols[i-1]) != y {
+			objects = append(objects, segment(color, x, level(symbols[i-1]), x, y))
+		}
+	}
+	w.lines.Objects = objects
+	w.size.SetMinSize(fyne.NewSize(float32(len(symbols)*symbolWidth), waveformHeight+2*waveformMargin))
+	w.lines.Refresh()
+	w.content.Refresh()
+}
+
+// level places 1 high and every other symbol low.
+func level(symbol byte) float32 {
+	if symbol == 1 {
+		return waveformMargin
+	}
+	return waveformMargin + waveformHeight
+}
+
+func segment(stroke color.Color, x1, y1, x2, y2 float32) *canvas.Line {
+	line := canvas.NewLine(stroke)
+	line.StrokeWidth = 2
+	line.Position1 = fyne.NewPos(x1, y1)
+	line.Position2 = fyne.NewPos(x2, y2)
+	return line
+}
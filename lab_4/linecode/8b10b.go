@@ -0,0 +1,96 @@
+package linecode
+
+// 5b/6b and 3b/4b codes for a negative running disparity; the positive
+// ones are their complements where the code is unbalanced.
+var fiveBSixB = [32]uint16{
+	0b100111, 0b011101, 0b101101, 0b110001, 0b110101, 0b101001, 0b011001, 0b111000,
+	0b111001, 0b100101, 0b010101, 0b110100, 0b001101, 0b101100, 0b011100, 0b010111,
+	0b011011, 0b100011, 0b010011, 0b110010, 0b001011, 0b101010, 0b011010, 0b111010,
+	0b110011, 0b100110, 0b010110, 0b110110, 0b001110, 0b101110, 0b011110, 0b101011,
+}
+
+var threeBFourB = [8]uint16{
+	0b1011, 0b1001, 0b0101, 0b1100, 0b1101, 0b1010, 0b0110, 0b1110,
+}
+
+// alternate7 is D.x.A7, used instead of D.x.P7 where P7 would make a run
+// of five equal symbols across the sub-blocks.
+const alternate7 = 0b0111
+
+func ones(block uint16, size int) int {
+	count := 0
+	for i := 0; i < size; i++ {
+		count += int(block >> i & 1)
+	}
+	return count
+}
+
+// subBlock picks the code for the current running disparity and updates
+// it. D.07 (111000) is balanced but still has a complement.
+func subBlock(code uint16, size int, disparity *int, alwaysFlip bool) uint16 {
+	balance := 2*ones(code, size) - size
+	if *disparity > 0 && (balance != 0 || alwaysFlip) {
+		code = ^code & (1<<size - 1)
+	}
+	if balance != 0 {
+		*disparity = -*disparity
+	}
+	return code
+}
+
+func encode8b10b(s *state, b byte) []byte {
+	x, y := b&0x1F, b>>5
+	six := subBlock(fiveBSixB[x], 6, &s.disparity, x == 7)
+	four := threeBFourB[y]
+	if y == 7 && (s.disparity < 0 && (x == 17 || x == 18 || x == 20) ||
+		s.disparity > 0 && (x == 11 || x == 13 || x == 14)) {
+		four = alternate7
+	}
+	four = subBlock(four, 4, &s.disparity, y == 3)
+	return append(blockBits(six, 6), blockBits(four, 4)...)
+}
+
+// decoded8b10b is what a 10-bit block stands for at one running
+// disparity.
+type decoded8b10b struct {
+	value     byte
+	disparity int
+	valid     bool
+}
+
+// decodeTables has a table for the negative and one for the positive
+// running disparity, indexed by the 10-bit block.
+var decodeTables = func() (tables [2][1 << 10]decoded8b10b) {
+	for i, disparity := range []int{-1, 1} {
+		for value := 0; value < 256; value++ {
+			s := state{disparity: disparity}
+			block, _ := blockOf(encode8b10b(&s, byte(value)))
+			tables[i][block] = decoded8b10b{value: byte(value), disparity: s.disparity, valid: true}
+		}
+	}
+	return tables
+}()
+
+func disparityTable(disparity int) int {
+	if disparity < 0 {
+		return 0
+	}
+	return 1
+}
+
+func decode8b10b(s *state, symbols []byte) (byte, error) {
+	block, ok := blockOf(symbols)
+	if !ok {
+		return 0, ErrInvalidSymbols
+	}
+	current := disparityTable(s.disparity)
+	decoded := decodeTables[current][block]
+	if !decoded.valid {
+		if decodeTables[1-current][block].valid {
+			return 0, ErrDisparity
+		}
+		return 0, ErrInvalidSymbols
+	}
+	s.disparity = decoded.disparity
+	return decoded.value, nil
+}
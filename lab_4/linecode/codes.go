@@ -0,0 +1,171 @@
+package linecode
+
+// Bytes go out most significant bit first; the block codes send the high
+// nibble first, 8B/10B sends abcdei fghj as in the standard.
+var (
+	None = &code{
+		name: "none",
+		unit: 1,
+		encode: func(s *state, b byte) []byte {
+			return []byte{b}
+		},
+		decode: func(s *state, symbols []byte) (byte, error) {
+			return symbols[0], nil
+		},
+	}
+	// NRZ sends a 1 as the high level and a 0 as the low one.
+	NRZ = &code{
+		name: "nrz",
+		unit: 8,
+		encode: func(s *state, b byte) []byte {
+			return bitsOf(b)
+		},
+		decode: func(s *state, symbols []byte) (byte, error) {
+			return byteOf(symbols)
+		},
+	}
+	// NRZI toggles the level for a 1 and keeps it for a 0.
+	NRZI = &code{
+		name: "nrzi",
+		unit: 8,
+		encode: func(s *state, b byte) []byte {
+			symbols := bitsOf(b)
+			for i, bit := range symbols {
+				s.level ^= bit
+				symbols[i] = s.level
+			}
+			return symbols
+		},
+		decode: func(s *state, symbols []byte) (byte, error) {
+			bits := make([]byte, len(symbols))
+			for i, symbol := range symbols {
+				if symbol > 1 {
+					return 0, ErrInvalidSymbols
+				}
+				bits[i] = symbol ^ s.level
+				s.level = symbol
+			}
+			return byteOf(bits)
+		},
+	}
+	// Manchester follows IEEE 802.3: a 0 is high then low, a 1 is low
+	// then high.
+	Manchester = &code{
+		name: "manchester",
+		unit: 16,
+		encode: func(s *state, b byte) []byte {
+			symbols := make([]byte, 0, 16)
+			for _, bit := range bitsOf(b) {
+				symbols = append(symbols, 1-bit, bit)
+			}
+			return symbols
+		},
+		decode: func(s *state, symbols []byte) (byte, error) {
+			bits := make([]byte, 0, 8)
+			for i := 0; i < len(symbols); i += 2 {
+				if symbols[i] > 1 || symbols[i] == symbols[i+1] || symbols[i+1] > 1 {
+					return 0, ErrInvalidSymbols
+				}
+				bits = append(bits, symbols[i+1])
+			}
+			return byteOf(bits)
+		},
+	}
+	// DifferentialManchester changes the level in the middle of every bit
+	// and, for a 0, also at its start.
+	DifferentialManchester = &code{
+		name: "diff-manchester",
+		unit: 16,
+		encode: func(s *state, b byte) []byte {
+			symbols := make([]byte, 0, 16)
+			for _, bit := range bitsOf(b) {
+				if bit == 0 {
+					s.level ^= 1
+				}
+				symbols = append(symbols, s.level, s.level^1)
+				s.level ^= 1
+			}
+			return symbols
+		},
+		decode: func(s *state, symbols []byte) (byte, error) {
+			bits := make([]byte, 0, 8)
+			for i := 0; i < len(symbols); i += 2 {
+				if symbols[i] > 1 || symbols[i] == symbols[i+1] || symbols[i+1] > 1 {
+					return 0, ErrInvalidSymbols
+				}
+				if symbols[i] == s.level {
+					bits = append(bits, 1)
+				} else {
+					bits = append(bits, 0)
+				}
+				s.level = symbols[i+1]
+			}
+			return byteOf(bits)
+		},
+	}
+	// FourBFiveB maps every nibble to a 5-bit code with at most three 0s
+	// in a row, so NRZI on top of it always has a transition.
+	FourBFiveB = &code{
+		name: "4b5b",
+		unit: 10,
+		encode: func(s *state, b byte) []byte {
+			return append(blockBits(fourBFiveB[b>>4], 5), blockBits(fourBFiveB[b&0xF], 5)...)
+		},
+		decode: func(s *state, symbols []byte) (byte, error) {
+			high, ok := lookup(fourBFiveB[:], symbols[:5])
+			if !ok {
+				return 0, ErrInvalidSymbols
+			}
+			low, ok := lookup(fourBFiveB[:], symbols[5:])
+			if !ok {
+				return 0, ErrInvalidSymbols
+			}
+			return byte(high<<4 | low), nil
+		},
+	}
+	// EightBTenB is the IBM 8B/10B code for data characters, keeping the
+	// running disparity between -1 and +1.
+	EightBTenB = &code{
+		name:   "8b10b",
+		unit:   10,
+		encode: encode8b10b,
+		decode: decode8b10b,
+	}
+)
+
+var fourBFiveB = [16]uint16{
+	0b11110, 0b01001, 0b10100, 0b10101, 0b01010, 0b01011, 0b01110, 0b01111,
+	0b10010, 0b10011, 0b10110, 0b10111, 0b11010, 0b11011, 0b11100, 0b11101,
+}
+
+func blockBits(block uint16, size int) []byte {
+	bits := make([]byte, size)
+	for i := range bits {
+		bits[i] = byte(block>>(size-1-i)) & 1
+	}
+	return bits
+}
+
+func blockOf(bits []byte) (uint16, bool) {
+	var block uint16
+	for _, bit := range bits {
+		if bit > 1 {
+			return 0, false
+		}
+		block = block<<1 | uint16(bit)
+	}
+	return block, true
+}
+
+func lookup(table []uint16, bits []byte) (int, bool) {
+	block, ok := blockOf(bits)
+	if !ok {
+		return 0, false
+	}
+	for value, code := range table {
+		if code == block {
+			return value, true
+		}
+	}
+	return 0, false
+}
@@ -0,0 +1,166 @@
+// Package linecode turns every byte of a frame into line symbols, one
+// level (0 or 1) per symbol, and back. Codes keep state between bytes
+// (the line level, the running disparity), so a frame is coded with one
+// Encoder and decoded with one Decoder. Every link picks its code; None
+// keeps the bytes as they are.
+package linecode
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrInvalidSymbols = errors.New("Invalid line symbols")
+	// ErrDisparity is a valid 8B/10B block sent at the other running
+	// disparity, so a symbol was lost or flipped before it.
+	ErrDisparity   = errors.New("Running disparity mismatch")
+	ErrUnknownCode = errors.New("Unknown line code")
+)
+
+type Code interface {
+	Name() string
+	// SymbolsPerByte is how many symbols one byte takes on the line.
+	SymbolsPerByte() int
+	NewEncoder() *Encoder
+	NewDecoder() *Decoder
+}
+
+// state is what a code remembers between bytes.
+type state struct {
+	level     byte
+	disparity int
+}
+
+type code struct {
+	name   string
+	unit   int
+	encode func(s *state, b byte) []byte
+	decode func(s *state, symbols []byte) (byte, error)
+}
+
+func (c *code) Name() string {
+	return c.name
+}
+
+func (c *code) SymbolsPerByte() int {
+	return c.unit
+}
+
+func (c *code) NewEncoder() *Encoder {
+	return &Encoder{code: c, state: initialState()}
+}
+
+func (c *code) NewDecoder() *Decoder {
+	return &Decoder{code: c, state: initialState()}
+}
+
+func initialState() state {
+	return state{level: 0, disparity: -1}
+}
+
+type Encoder struct {
+	code  *code
+	state state
+}
+
+func (e *Encoder) Encode(b byte) []byte {
+	return e.code.encode(&e.state, b)
+}
+
+// Decoder collects symbols until they make up a byte.
+type Decoder struct {
+	code    *code
+	state   state
+	symbols []byte
+}
+
+// Decode returns the byte and true once its last symbol arrives. Invalid
+// symbols are dropped together with the byte they belong to.
+func (d *Decoder) Decode(symbol byte) (byte, bool, error) {
+	d.symbols = append(d.symbols, symbol)
+	if len(d.symbols) < d.code.unit {
+		return 0, false, nil
+	}
+	next := d.state
+	b, err := d.code.decode(&next, d.symbols)
+	d.symbols = d.symbols[:0]
+	if err != nil {
+		return 0, false, err
+	}
+	d.state = next
+	return b, true, nil
+}
+
+// Reset starts over at a frame boundary.
+func (d *Decoder) Reset() {
+	d.state = initialState()
+	d.symbols = d.symbols[:0]
+}
+
+var Codes = []Code{None, NRZ, NRZI, Manchester, DifferentialManchester, FourBFiveB, EightBTenB}
+
+func Names() []string {
+	names := make([]string, len(Codes))
+	for i, code := range Codes {
+		names[i] = code.Name()
+	}
+	return names
+}
+
+func ByName(name string) (Code, error) {
+	for _, code := range Codes {
+		if strings.EqualFold(code.Name(), name) {
+			return code, nil
+		}
+	}
+	return nil, ErrUnknownCode
+}
+
+// Stats describe a symbol stream: DC balance is the number of 1s minus the
+// number of 0s, and the longest run without a transition is what a
+// receiver has to bridge to keep its clock.
+type Stats struct {
+	Symbols     int
+	Balance     int
+	LongestRun  int
+	Transitions int
+}
+
+func Analyze(symbols []byte) Stats {
+	stats := Stats{Symbols: len(symbols)}
+	run := 0
+	for i, symbol := range symbols {
+		if symbol == 0 {
+			stats.Balance--
+		} else {
+			stats.Balance++
+		}
+		if i > 0 && symbol != symbols[i-1] {
+			stats.Transitions++
+			run = 0
+		}
+		run++
+		stats.LongestRun = max(stats.LongestRun, run)
+	}
+	return stats
+}
+
+func bitsOf(b byte) []byte {
+	bits := make([]byte, 8)
+	for i := range bits {
+		bits[i] = b >> (7 - i) & 1
+	}
+	return bits
+}
+
+func byteOf(bits []byte) (byte, error) {
+	var b byte
+	for _, bit := range bits {
+		if bit > 1 {
+			return 0, ErrInvalidSymbols
+		}
+		b = b<<1 | bit
+	}
+	return b, nil
+}
@@ -0,0 +1,168 @@
+package linecode
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func symbolString(symbols []byte) string {
+	var text strings.Builder
+	for _, symbol := range symbols {
+		text.WriteByte(symbol + '0')
+	}
+	return text.String()
+}
+
+func encodeAll(code Code, data []byte) []byte {
+	encoder := code.NewEncoder()
+	var symbols []byte
+	for _, b := range data {
+		symbols = append(symbols, encoder.Encode(b)...)
+	}
+	return symbols
+}
+
+func allBytes() []byte {
+	data := make([]byte, 0, 512)
+	for i := 0; i < 512; i++ {
+		data = append(data, byte(i*37+i/256))
+	}
+	return data
+}
+
+func TestKnownVectors(t *testing.T) {
+	tests := []struct {
+		code Code
+		data []byte
+		want string
+	}{
+		{NRZ, []byte{0xA5}, "10100101"},
+		{NRZI, []byte{0xA5}, "11000110"},
+		{Manchester, []byte{0xA0}, "0110011010101010"},
+		{DifferentialManchester, []byte{0xA0}, "0101101010101010"},
+		{FourBFiveB, []byte{0x0F}, "1111011101"},
+		{EightBTenB, []byte{0x00}, "1001110100"},
+		{EightBTenB, []byte{0xB5}, "1010101010"},
+		{EightBTenB, []byte{0x4A}, "0101010101"},
+		{EightBTenB, []byte{0xF1}, "1000110111"},
+		{EightBTenB, []byte{0x00, 0x00}, "10011101001001110100"},
+		{EightBTenB, []byte{0x07, 0x07}, "11100010110001110100"},
+	}
+	for _, test := range tests {
+		if got := symbolString(encodeAll(test.code, test.data)); got != test.want {
+			t.Errorf("%s(% x) = %s, want %s", test.code.Name(), test.data, got, test.want)
+		}
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	data := allBytes()
+	for _, code := range Codes {
+		t.Run(code.Name(), func(t *testing.T) {
+			symbols := encodeAll(code, data)
+			if len(symbols) != len(data)*code.SymbolsPerByte() {
+				t.Fatalf("%d symbols for %d bytes", len(symbols), len(data))
+			}
+			decoder := code.NewDecoder()
+			var decoded []byte
+			for _, symbol := range symbols {
+				b, ok, err := decoder.Decode(symbol)
+				if err != nil {
+					t.Fatalf("Decode() error after %d bytes: %v", len(decoded), err)
+				}
+				if ok {
+					decoded = append(decoded, b)
+				}
+			}
+			if string(decoded) != string(data) {
+				t.Errorf("decoded % x", decoded)
+			}
+		})
+	}
+}
+
+func TestClockAndBalance(t *testing.T) {
+	data := allBytes()
+	tests := []struct {
+		code       Code
+		maxRun     int
+		maxBalance int
+	}{
+		{Manchester, 2, 0},
+		{DifferentialManchester, 2, 2},
+		{EightBTenB, 5, 2},
+	}
+	for _, test := range tests {
+		stats := Analyze(encodeAll(test.code, data))
+		if stats.LongestRun > test.maxRun {
+			t.Errorf("%s: longest run %d", test.code.Name(), stats.LongestRun)
+		}
+		if stats.Balance > test.maxBalance || stats.Balance < -test.maxBalance {
+			t.Errorf("%s: balance %d", test.code.Name(), stats.Balance)
+		}
+	}
+	for _, code := range fourBFiveB {
+		if strings.Contains(symbolString(blockBits(code, 5)), "0000") {
+			t.Errorf("4B/5B code %05b has four 0s", code)
+		}
+	}
+}
+
+func TestInvalidSymbols(t *testing.T) {
+	tests := []struct {
+		code    Code
+		symbols string
+	}{
+		{Manchester, "1100000000000000"},
+		{FourBFiveB, "0000011110"},
+		{EightBTenB, "1111111111"},
+		{NRZ, "00000002"},
+	}
+	for _, test := range tests {
+		decoder := test.code.NewDecoder()
+		var err error
+		for _, char := range test.symbols {
+			_, _, err = decoder.Decode(byte(char - '0'))
+		}
+		if !errors.Is(err, ErrInvalidSymbols) {
+			t.Errorf("%s: Decode(%s) = %v", test.code.Name(), test.symbols, err)
+		}
+	}
+}
+
+func TestByName(t *testing.T) {
+	for _, name := range Names() {
+		if code, err := ByName(name); err != nil || code.Name() != name {
+			t.Errorf("ByName(%q) = %v, %v", name, code, err)
+		}
+	}
+	if _, err := ByName("mlt-3"); !errors.Is(err, ErrUnknownCode) {
+		t.Errorf("ByName(mlt-3) = %v", err)
+	}
+}
+
+func TestDisparityMismatch(t *testing.T) {
+	positive := state{disparity: 1}
+	decoder := EightBTenB.NewDecoder()
+	var err error
+	for _, symbol := range encode8b10b(&positive, 0x00) {
+		_, _, err = decoder.Decode(symbol)
+	}
+	if !errors.Is(err, ErrDisparity) {
+		t.Errorf("Decode() of a block for the positive running disparity = %v, want %v", err, ErrDisparity)
+	}
+	var decoded []byte
+	for _, symbol := range encodeAll(EightBTenB, []byte{0x00, 0x07}) {
+		b, ok, err := decoder.Decode(symbol)
+		if err != nil {
+			t.Fatalf("Decode() after the mismatch: %v", err)
+		}
+		if ok {
+			decoded = append(decoded, b)
+		}
+	}
+	if string(decoded) != "\x00\x07" {
+		t.Errorf("decoded % x after the mismatch", decoded)
+	}
+}
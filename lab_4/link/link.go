@@ -0,0 +1,86 @@
+// Package link runs the transmitting and receiving sides of a port pair
+// without depending on how the ports or the interface are provided, so the
+// same loops serve the GUI and the integration tests.
+package link
+
+import (
+	"context"
+	"errors"
+	"lab_4/csma_cd"
+	"lab_4/gui"
+	"lab_4/packet"
+	"lab_4/queue"
+	"lab_4/rs232"
+	"lab_4/stack"
+	"strings"
+)
+
+// Transmit frames queued text 7 bits at a time and sends every frame with
+// CSMA/CD until ctx is cancelled. ready is checked before each payload;
+// when it fails the pending text is discarded and the error reported.
+// An empty payload completes the pending text with newlines, so the next
+// payload starts a packet. A frame that is not sent fails its payload.
+func Transmit(ctx context.Context, s *stack.Stack, sendQueue *queue.Queue, output rs232.Sink,
+	events gui.Publisher, ready func() error) {
+	pendingText := ""
+	_ = sendQueue.Run(ctx, func(ctx context.Context, payload []byte) error {
+		number, err := output.PortNumber()
+		if err == nil && ready != nil {
+			err = ready()
+		}
+		if err != nil {
+			pendingText = ""
+			events.Publish(gui.InputDiscarded{})
+			events.Publish(gui.Error{Err: err})
+			return err
+		}
+		pendingText += string(payload)
+		if len(payload) == 0 && len(pendingText)%7 != 0 {
+			pendingText += strings.Repeat("\n", 7-len(pendingText)%7)
+		}
+		var failed error
+		for len(pendingText) >= 7 {
+			dataChunk := pendingText[:7]
+			pendingText = pendingText[7:]
+			rawPacket, formattedPacket, err := packet.SerializePacket(s, dataChunk, number)
+			if err != nil {
+				events.Publish(gui.Error{Err: err})
+				if failed == nil {
+					failed = err
+				}
+				continue
+			}
+			err = csma_cd.Transmitter(ctx, s, rawPacket, formattedPacket, output, events)
+			if errors.Is(err, csma_cd.ErrTooManyCollisions) {
+				events.Publish(gui.Warning{Err: err})
+			} else if err != nil && ctx.Err() == nil {
+				events.Publish(gui.Error{Err: err})
+			}
+			if err != nil && failed == nil {
+				failed = err
+			}
+		}
+		return failed
+	})
+}
+
+// Receive publishes every frame decoded from chunks until the port is
+// closed or ctx is cancelled.
+func Receive(ctx context.Context, s *stack.Stack, chunks <-chan rs232.Chunk, port string,
+	events gui.Publisher) error {
+	receiver := csma_cd.NewReceiver(s, chunks)
+	for {
+		data, err := receiver.Next(ctx)
+		if errors.Is(err, rs232.ErrPortClosed) {
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			events.Publish(gui.Error{Err: err})
+			continue
+		}
+		events.Publish(gui.FrameReceived{Port: port, Data: data})
+	}
+}
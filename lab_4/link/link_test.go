@@ -0,0 +1,290 @@
+package link
+
+import (
+	"context"
+	"lab_4/csma_cd"
+	"lab_4/framing"
+	"lab_4/gui"
+	"lab_4/linecode"
+	"lab_4/packet"
+	"lab_4/queue"
+	"lab_4/rs232"
+	"lab_4/settings"
+	"lab_4/stack"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recorder struct {
+	mutex      sync.Mutex
+	collisions int
+	spans      map[gui.SpanKind]int
+	errors     []error
+	frames     chan string
+}
+
+func (r *recorder) Publish(event gui.Event) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	switch e := event.(type) {
+	case gui.Collision:
+		r.collisions++
+	case gui.Error:
+		r.errors = append(r.errors, e.Err)
+	case gui.Warning:
+		r.errors = append(r.errors, e.Err)
+	case gui.TimelineSpan:
+		if r.spans == nil {
+			r.spans = make(map[gui.SpanKind]int)
+		}
+		r.spans[e.Kind]++
+	case gui.FrameReceived:
+		r.frames <- e.Data
+	}
+}
+
+func (r *recorder) count(kind gui.SpanKind) int {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.spans[kind]
+}
+
+// newStack is a link with short backoff slots, so tests do not wait.
+func newStack(framer framing.Framer, code linecode.Code) *stack.Stack {
+	link := settings.Default
+	link.SlotTime = 10 * time.Microsecond
+	return stack.New(framer, code, 115200, link)
+}
+
+func TestLinkDeliversPayloads(t *testing.T) {
+	for _, framer := range framing.Framers {
+		t.Run(framer.Name(), func(t *testing.T) {
+			testDelivery(t, newStack(framer, linecode.None))
+		})
+	}
+}
+
+func TestLinkLineCodes(t *testing.T) {
+	for _, code := range linecode.Codes {
+		t.Run(code.Name(), func(t *testing.T) {
+			testDelivery(t, newStack(framing.Lab, code))
+		})
+	}
+}
+
+func testDelivery(t *testing.T, s *stack.Stack) {
+	packet.Seed(1)
+	input, output := rs232.Pipe("/dev/ttyS1", "/dev/ttyS2")
+	transmitted := &recorder{frames: make(chan string, 64)}
+	received := &recorder{frames: make(chan string, 64)}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	sendQueue := queue.New(64)
+	transmitCtx, stopTransmit := context.WithCancel(ctx)
+	stopped := make(chan struct{})
+	go func() {
+		Transmit(transmitCtx, s, sendQueue, input, transmitted, nil)
+		close(stopped)
+	}()
+	done := make(chan error, 1)
+	go func() {
+		done <- Receive(ctx, s, output.Chunks(ctx), output.PortName(), received)
+	}()
+
+	counters := s.Stats.Current()
+	started := time.Now()
+	payloads := []string{"0000110", "1111111", "0101010", "1000011", "000000\n", "0110011"}
+	for _, payload := range payloads {
+		if err := sendQueue.Send(ctx, []byte(payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []string
+	for len(got) < len(payloads) {
+		select {
+		case frame := <-received.frames:
+			got = append(got, frame)
+		case <-ctx.Done():
+			t.Fatalf("received %q before timeout, want %q", got, payloads)
+		}
+	}
+	elapsed := time.Since(started)
+	// The receiver may finish a frame while its last byte still collides,
+	// so wait for the transmitter to send the idle symbol after each frame.
+	for transmitted.count(gui.SpanIdle) < len(payloads) && ctx.Err() == nil {
+		time.Sleep(time.Millisecond)
+	}
+	stopTransmit()
+	<-stopped
+	input.Close()
+	if err := <-done; err != nil {
+		t.Errorf("Receive() = %v after the port was closed", err)
+	}
+
+	if strings.Join(got, "|") != strings.Join(payloads, "|") {
+		t.Errorf("received %q, want %q", got, payloads)
+	}
+	if len(transmitted.errors) != 0 || len(received.errors) != 0 {
+		t.Errorf("unexpected errors: %v %v", transmitted.errors, received.errors)
+	}
+	if jams := s.Stats.Current().JamsReceived - counters.JamsReceived; jams != transmitted.collisions {
+		t.Errorf("received %d jams for %d collisions", jams, transmitted.collisions)
+	}
+	if transmitted.spans[gui.SpanJam] != transmitted.collisions ||
+		transmitted.spans[gui.SpanBackoff] != transmitted.collisions {
+		t.Errorf("timeline has %d jams and %d backoffs for %d collisions", transmitted.spans[gui.SpanJam],
+			transmitted.spans[gui.SpanBackoff], transmitted.collisions)
+	}
+	if frames := transmitted.spans[gui.SpanFrame]; frames != len(payloads) {
+		t.Errorf("timeline has %d frames, want %d", frames, len(payloads))
+	}
+	after := s.Stats.Current()
+	if sent := after.FramesSent - counters.FramesSent; sent != len(payloads) {
+		t.Errorf("counted %d frames sent, want %d", sent, len(payloads))
+	}
+	if received := after.FramesReceived - counters.FramesReceived; received != len(payloads) {
+		t.Errorf("counted %d frames received, want %d", received, len(payloads))
+	}
+	if collisions := after.Collisions - counters.Collisions; collisions != transmitted.collisions {
+		t.Errorf("counted %d collisions, want %d", collisions, transmitted.collisions)
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("delivery took %v", elapsed)
+	}
+}
+
+// A jam after the last byte of a frame takes that byte back like any other,
+// so the frame is only complete with the byte sent again after the jam.
+func TestLinkJamAfterLastByte(t *testing.T) {
+	s := newStack(framing.Lab, linecode.None)
+	s.Settings.Update(func(link *settings.Link) {
+		link.FCS = settings.FCSDetect
+		link.DistortionChance = 0
+	})
+	frame, _, err := packet.SerializePacket(s, "0110101", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := len(frame) - 1
+	line := csma_cd.EncodeLine(frame[:last])
+	line = append(line, csma_cd.EncodeLine([]byte{frame[last] ^ 1})...)
+	line = append(line, csma_cd.ControlSignal(csma_cd.SymbolJam)...)
+	line = append(line, csma_cd.EncodeLine(frame[last:])...)
+	line = append(line, csma_cd.ControlSignal(csma_cd.SymbolIdle)...)
+
+	input, output := rs232.Pipe("/dev/ttyS1", "/dev/ttyS2")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	received := &recorder{frames: make(chan string, 4)}
+	done := make(chan error, 1)
+	go func() {
+		done <- Receive(ctx, s, output.Chunks(ctx), output.PortName(), received)
+	}()
+	if err := input.WriteBytes(line); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-received.frames:
+		if data != "0110101" {
+			t.Errorf("received %q, want 0110101", data)
+		}
+	case <-ctx.Done():
+		t.Fatal("no frame received")
+	}
+	input.Close()
+	if err := <-done; err != nil {
+		t.Errorf("Receive() = %v after the port was closed", err)
+	}
+	if len(received.errors) != 0 {
+		t.Errorf("unexpected errors: %v", received.errors)
+	}
+	counters := s.Stats.Current()
+	if counters.FramesReceived != 1 || counters.FramesDropped != 0 || counters.JamsReceived != 1 {
+		t.Errorf("counted %d frames received, %d dropped and %d jams, want 1, 0 and 1",
+			counters.FramesReceived, counters.FramesDropped, counters.JamsReceived)
+	}
+}
+
+func TestTransmitDiscardsWhenNotReady(t *testing.T) {
+	input, _ := rs232.Pipe("/dev/ttyS1", "/dev/ttyS2")
+	events := &recorder{frames: make(chan string, 1)}
+	ctx, cancel := context.WithCancel(context.Background())
+	sendQueue := queue.New(1)
+	stopped := make(chan struct{})
+	go func() {
+		Transmit(ctx, newStack(framing.Lab, linecode.None), sendQueue, input, events,
+			func() error { return rs232.ErrNotOpen })
+		close(stopped)
+	}()
+	if err := sendQueue.Send(ctx, []byte("0000110")); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		events.mutex.Lock()
+		count := len(events.errors)
+		events.mutex.Unlock()
+		if count > 0 {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	<-stopped
+	if len(events.errors) != 1 || events.errors[0] != rs232.ErrNotOpen {
+		t.Errorf("errors = %v, want [%v]", events.errors, rs232.ErrNotOpen)
+	}
+}
+
+func TestLinksRunSideBySide(t *testing.T) {
+	stacks := []*stack.Stack{newStack(framing.Lab, linecode.None), newStack(framing.COBS, linecode.Manchester)}
+	stacks[1].Settings.Update(func(link *settings.Link) { link.CollisionChance = 0 })
+	payloads := [][]string{{"0000110", "1111111", "0101010"}, {"1000011", "0110011"}}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	var wg sync.WaitGroup
+	got := make([][]string, len(stacks))
+	for i, s := range stacks {
+		input, output := rs232.Pipe("/dev/ttyS"+strconv.Itoa(2*i+1), "/dev/ttyS"+strconv.Itoa(2*i+2))
+		defer input.Close()
+		sendQueue := queue.New(64)
+		received := &recorder{frames: make(chan string, 64)}
+		go Transmit(ctx, s, sendQueue, input, &recorder{}, nil)
+		go func() {
+			_ = Receive(ctx, s, output.Chunks(ctx), output.PortName(), received)
+		}()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for _, payload := range payloads[i] {
+				if err := sendQueue.Send(ctx, []byte(payload)); err != nil {
+					return
+				}
+			}
+			for len(got[i]) < len(payloads[i]) {
+				select {
+				case frame := <-received.frames:
+					got[i] = append(got[i], frame)
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	for i, s := range stacks {
+		if strings.Join(got[i], "|") != strings.Join(payloads[i], "|") {
+			t.Errorf("link %d received %q, want %q", i, got[i], payloads[i])
+		}
+		if received := s.Stats.Current().FramesReceived; received != len(payloads[i]) {
+			t.Errorf("link %d counted %d frames received, want %d", i, received, len(payloads[i]))
+		}
+	}
+	if collisions := stacks[1].Stats.Current().Collisions; collisions != 0 {
+		t.Errorf("link without collisions counted %d", collisions)
+	}
+}
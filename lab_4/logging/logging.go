@@ -0,0 +1,176 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+)
+
+// Level is shared by every sink, so switching it changes the verbosity of
+// the whole application at runtime.
+var Level = new(slog.LevelVar)
+
+var sinks struct {
+	sync.RWMutex
+	handlers []slog.Handler
+	// generation counts the sinks added, so loggers notice new ones.
+	generation int
+}
+
+// For returns the logger of a subsystem. Loggers may be created before any
+// sink is added: records are dispatched to the sinks present at log time.
+func For(subsystem string) *slog.Logger {
+	return slog.New(&fanout{}).With("subsystem", subsystem)
+}
+
+func AddSink(handler slog.Handler) {
+	sinks.Lock()
+	defer sinks.Unlock()
+	sinks.handlers = append(sinks.handlers, handler)
+	sinks.generation++
+}
+
+func Options() *slog.HandlerOptions {
+	return &slog.HandlerOptions{Level: Level}
+}
+
+func ParseLevel(name string) (slog.Level, error) {
+	var level slog.Level
+	err := level.UnmarshalText([]byte(name))
+	return level, err
+}
+
+// fanout passes records to every sink. The handler of each sink with the
+// attributes and groups of the logger is built once, and again only after
+// a sink is added.
+type fanout struct {
+	derive     []func(slog.Handler) slog.Handler
+	mutex      sync.Mutex
+	built      bool
+	generation int
+	handlers   []slog.Handler
+}
+
+func (f *fanout) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= Level.Level()
+}
+
+func (f *fanout) Handle(ctx context.Context, record slog.Record) error {
+	var errs []error
+	for _, handler := range f.sinkHandlers() {
+		if !handler.Enabled(ctx, record.Level) {
+			continue
+		}
+		if err := handler.Handle(ctx, record.Clone()); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("logging: %v", errs)
+	}
+	return nil
+}
+
+func (f *fanout) sinkHandlers() []slog.Handler {
+	sinks.RLock()
+	base, generation := sinks.handlers, sinks.generation
+	sinks.RUnlock()
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	if f.built && f.generation == generation {
+		return f.handlers
+	}
+	handlers := make([]slog.Handler, len(base))
+	for i, handler := range base {
+		for _, derive := range f.derive {
+			handler = derive(handler)
+		}
+		handlers[i] = handler
+	}
+	f.built, f.generation, f.handlers = true, generation, handlers
+	return handlers
+}
+
+func (f *fanout) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return f.with(func(handler slog.Handler) slog.Handler {
+		return handler.WithAttrs(attrs)
+	})
+}
+
+func (f *fanout) WithGroup(name string) slog.Handler {
+	return f.with(func(handler slog.Handler) slog.Handler {
+		return handler.WithGroup(name)
+	})
+}
+
+func (f *fanout) with(derive func(slog.Handler) slog.Handler) *fanout {
+	derived := &fanout{derive: append(f.derive[:len(f.derive):len(f.derive)], derive)}
+	derived.sinkHandlers()
+	return derived
+}
+
+// LineHandler formats records as "subsystem: message key=value" lines and
+// passes them to a callback, which is how the GUI debug pane receives logs.
+type LineHandler struct {
+	output func(level slog.Level, line string)
+	attrs  []slog.Attr
+	group  string
+}
+
+func NewLineHandler(output func(level slog.Level, line string)) *LineHandler {
+	return &LineHandler{output: output}
+}
+
+func (h *LineHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return level >= Level.Level()
+}
+
+func (h *LineHandler) Handle(_ context.Context, record slog.Record) error {
+	var line strings.Builder
+	subsystem := ""
+	write := func(attr slog.Attr) {
+		if attr.Key == "subsystem" {
+			subsystem = attr.Value.String()
+			return
+		}
+		fmt.Fprintf(&line, " %s=%v", attr.Key, attr.Value)
+	}
+	for _, attr := range h.attrs {
+		write(attr)
+	}
+	record.Attrs(func(attr slog.Attr) bool {
+		if h.group != "" {
+			attr.Key = h.group + "." + attr.Key
+		}
+		write(attr)
+		return true
+	})
+	text := record.Message + line.String()
+	if subsystem != "" {
+		text = subsystem + ": " + text
+	}
+	h.output(record.Level, text)
+	return nil
+}
+
+func (h *LineHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	clone := *h
+	for _, attr := range attrs {
+		if h.group != "" {
+			attr.Key = h.group + "." + attr.Key
+		}
+		clone.attrs = append(clone.attrs[:len(clone.attrs):len(clone.attrs)], attr)
+	}
+	return &clone
+}
+
+func (h *LineHandler) WithGroup(name string) slog.Handler {
+	clone := *h
+	if clone.group != "" {
+		name = clone.group + "." + name
+	}
+	clone.group = name
+	return &clone
+}
@@ -0,0 +1,110 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// withSinks runs a test with only its own sinks and the level at Debug.
+func withSinks(t *testing.T) {
+	sinks.Lock()
+	saved := sinks.handlers
+	sinks.handlers = nil
+	sinks.generation++
+	sinks.Unlock()
+	level := Level.Level()
+	Level.Set(slog.LevelDebug)
+	t.Cleanup(func() {
+		sinks.Lock()
+		sinks.handlers = saved
+		sinks.generation++
+		sinks.Unlock()
+		Level.Set(level)
+	})
+}
+
+type lines struct {
+	mutex sync.Mutex
+	lines []string
+}
+
+func (l *lines) add(level slog.Level, line string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.lines = append(l.lines, level.String()+" "+line)
+}
+
+func (l *lines) get() []string {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	return append([]string(nil), l.lines...)
+}
+
+func TestFanoutReachesEverySink(t *testing.T) {
+	withSinks(t)
+	logger := For("test").With("port", 1)
+	gui := new(lines)
+	AddSink(NewLineHandler(gui.add))
+	var output bytes.Buffer
+	AddSink(slog.NewJSONHandler(&output, Options()))
+
+	logger.WithGroup("frame").Info("Frame sent", "bits", 27)
+	want := []string{"INFO test: Frame sent port=1 frame.bits=27"}
+	if got := gui.get(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("line sink got %q, want %q", got, want)
+	}
+	var record map[string]any
+	if err := json.Unmarshal(output.Bytes(), &record); err != nil {
+		t.Fatalf("JSON sink wrote %q: %v", output.String(), err)
+	}
+	frame, _ := record["frame"].(map[string]any)
+	if record["subsystem"] != "test" || record["port"] != 1.0 || frame["bits"] != 27.0 {
+		t.Errorf("JSON sink got %v", record)
+	}
+}
+
+func TestLevelFiltering(t *testing.T) {
+	withSinks(t)
+	logger := For("test")
+	all := new(lines)
+	AddSink(NewLineHandler(all.add))
+	var warnings bytes.Buffer
+	AddSink(slog.NewTextHandler(&warnings, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	logger.Debug("Debug record")
+	logger.Warn("Warning record")
+	Level.Set(slog.LevelError)
+	logger.Warn("Filtered warning")
+	if logger.Enabled(context.Background(), slog.LevelWarn) {
+		t.Error("Enabled(Warn) with the level at Error")
+	}
+	want := []string{"DEBUG test: Debug record", "WARN test: Warning record"}
+	if got := all.get(); strings.Join(got, "|") != strings.Join(want, "|") {
+		t.Errorf("line sink got %q, want %q", got, want)
+	}
+	if text := warnings.String(); strings.Count(text, "\n") != 1 || !strings.Contains(text, "Warning record") {
+		t.Errorf("warning sink got %q, want only the first warning", text)
+	}
+}
+
+func TestSinkAddedLater(t *testing.T) {
+	withSinks(t)
+	logger := For("test").With("port", 2)
+	first := new(lines)
+	AddSink(NewLineHandler(first.add))
+	logger.Info("One")
+	second := new(lines)
+	AddSink(NewLineHandler(second.add))
+	logger.Info("Two")
+	if got := first.get(); len(got) != 2 {
+		t.Errorf("first sink got %q, want both records", got)
+	}
+	if got := second.get(); len(got) != 1 || got[0] != "INFO test: Two port=2" {
+		t.Errorf("sink added later got %q, want the second record", got)
+	}
+}
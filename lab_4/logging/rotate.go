@@ -0,0 +1,87 @@
+package logging
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// RotatingFile is an io.Writer that renames the file to path.1, path.2, ...
+// once it grows past maxSize bytes, keeping at most backups old files.
+type RotatingFile struct {
+	mutex   sync.Mutex
+	path    string
+	maxSize int64
+	backups int
+	file    *os.File
+	size    int64
+}
+
+func NewRotatingFile(path string, maxSize int64, backups int) (*RotatingFile, error) {
+	err := os.MkdirAll(filepath.Dir(path), 0o755)
+	if err != nil {
+		return nil, err
+	}
+	r := &RotatingFile{path: path, maxSize: maxSize, backups: backups}
+	return r, r.open()
+}
+
+func (r *RotatingFile) Write(p []byte) (int, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.size+int64(len(p)) > r.maxSize && r.size > 0 {
+		err := r.rotate()
+		if err != nil {
+			return 0, err
+		}
+	}
+	n, err := r.file.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+func (r *RotatingFile) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return r.file.Close()
+}
+
+func (r *RotatingFile) open() error {
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return err
+	}
+	r.file = file
+	r.size = info.Size()
+	return nil
+}
+
+func (r *RotatingFile) rotate() error {
+	err := r.file.Close()
+	if err != nil {
+		return err
+	}
+	for i := r.backups; i > 0; i-- {
+		from := r.path
+		if i > 1 {
+			from = fmt.Sprintf("%s.%d", r.path, i-1)
+		}
+		err = os.Rename(from, fmt.Sprintf("%s.%d", r.path, i))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if r.backups == 0 {
+		err = os.Remove(r.path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return r.open()
+}
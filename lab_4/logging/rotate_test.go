@@ -0,0 +1,92 @@
+package logging
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func writeLines(t *testing.T, file *RotatingFile, lines ...string) {
+	t.Helper()
+	for _, line := range lines {
+		if _, err := file.Write([]byte(line)); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	content, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(content)
+}
+
+func TestRotatingFileKeepsBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "logs", "lab_4.log")
+	file, err := NewRotatingFile(path, 10, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeLines(t, file, "aaaa\n", "bbbb\n", "cccc\n", "dddd\n", "eeee\n", "ffff\n", "gggg\n")
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]string{
+		path:        "gggg\n",
+		path + ".1": "eeee\nffff\n",
+		path + ".2": "cccc\ndddd\n",
+	}
+	for path, content := range want {
+		if got := readFile(t, path); got != content {
+			t.Errorf("%s = %q, want %q", filepath.Base(path), got, content)
+		}
+	}
+	if _, err := os.Stat(path + ".3"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("third backup exists: %v", err)
+	}
+}
+
+func TestRotatingFileAppends(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lab_4.log")
+	if err := os.WriteFile(path, []byte("old\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	file, err := NewRotatingFile(path, 10, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeLines(t, file, "new\n", "next\n")
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path+".1"); got != "old\nnew\n" {
+		t.Errorf("backup = %q, want the old content and the first write", got)
+	}
+	if got := readFile(t, path); got != "next\n" {
+		t.Errorf("log = %q, want the write that did not fit", got)
+	}
+}
+
+func TestRotatingFileWithoutBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "lab_4.log")
+	file, err := NewRotatingFile(path, 8, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeLines(t, file, "first\n", "second\n")
+	if err := file.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if got := readFile(t, path); got != "second\n" {
+		t.Errorf("log = %q, want only the last write", got)
+	}
+	matches, _ := filepath.Glob(path + ".*")
+	if len(matches) != 0 {
+		t.Errorf("backups %v without any allowed", matches)
+	}
+}
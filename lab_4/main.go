@@ -1,94 +1,491 @@
 package main
 
 import (
+	"context"
 	"errors"
+	"flag"
+	"fmt"
 	"fyne.io/fyne/v2"
 	"fyne.io/fyne/v2/app"
 	"fyne.io/fyne/v2/theme"
 	"go.bug.st/serial"
+	"lab_4/capture"
+	"lab_4/config"
 	"lab_4/csma_cd"
+	"lab_4/framing"
 	"lab_4/gui"
-	"lab_4/packet"
+	"lab_4/linecode"
+	"lab_4/link"
+	"lab_4/logging"
+	"lab_4/metrics"
+	"lab_4/modem"
+	"lab_4/queue"
 	"lab_4/rs232"
-	"runtime"
+	"lab_4/stack"
+	"lab_4/transfer"
+	"log/slog"
+	"os"
+	"os/signal"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 )
 
-func TransmitData(u *gui.UserInterface) {
-	prevText := ""
-	for {
-		if u.InputEntry != nil && u.InputPort.SerialPort != nil &&
-			u.InputPort.Number != 0 && rs232.PortIsOpen("/dev/ttyS"+strconv.Itoa(u.InputPort.Number+1)) {
-			currentText := u.InputEntry.Text
-			for len(currentText)-len(prevText) >= 7 {
-				dataChunk := currentText[len(prevText) : len(prevText)+7]
-				rawPacket, formattedPacket, err := packet.SerializePacket(dataChunk, u.InputPort.Number)
-				if err != nil {
-					gui.ErrorWindow(err, u.App)
-					return
-				}
-				csma_cd.Transmitter(rawPacket, formattedPacket, u)
-				prevText += dataChunk
-			}
+func TransmitData(ctx context.Context, u *gui.UserInterface) {
+	link.Transmit(ctx, u.Stack, u.SendQueue, u.InputPort, u, func() error {
+		number, err := u.InputPort.PortNumber()
+		if err != nil || !u.InputPort.IsOpen() || number == 0 ||
+			!rs232.PortIsOpen("/dev/ttyS"+strconv.Itoa(number+1)) {
+			return errors.New("Open the both ports of the pair")
+		}
+		return nil
+	})
+}
+
+func ReceiveData(ctx context.Context, u *gui.UserInterface, files *transfer.Receiver) {
+	for ctx.Err() == nil {
+		if !u.OutputPort.IsOpen() {
+			time.Sleep(100 * time.Millisecond)
+			continue
+		}
+		_ = link.Receive(ctx, u.Stack, u.OutputPort.Chunks(ctx), u.OutputPort.PortName(), files)
+		time.Sleep(100 * time.Millisecond)
+	}
+}
+
+func SendFile(ctx context.Context, u *gui.UserInterface, path string) {
+	for !u.InputPort.IsOpen() {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(100 * time.Millisecond):
+		}
+	}
+	err := transfer.SendFile(ctx, u.SendQueue, path, u)
+	if err != nil {
+		slog.Error("File transfer failed", "path", path, "err", err)
+	}
+}
+
+// modemSession is the cancel function of the running modem session.
+type modemSession struct {
+	mutex  sync.Mutex
+	cancel context.CancelFunc
+}
+
+func (m *modemSession) Start(ctx context.Context, u *gui.UserInterface, protocolName, portName, dir string,
+	files []modem.File) {
+	protocol, err := modem.ByName(protocolName)
+	if err != nil {
+		u.Publish(gui.Error{Err: err})
+		return
+	}
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.cancel != nil {
+		return
+	}
+	ctx, m.cancel = context.WithCancel(ctx)
+	u.Publish(gui.ModemSession{Running: true})
+	go func() {
+		defer func() {
+			m.Cancel()
+			u.Publish(gui.ModemSession{Running: false})
+		}()
+		port := &rs232.Port{BaudRate: u.Stack.BaudRate}
+		u.Inspect(port)
+		_, err := port.OpenPort(portName)
+		if err != nil {
+			u.Publish(gui.Error{Err: err})
+			return
+		}
+		defer port.ClosePort()
+		if files == nil {
+			_, _ = protocol.Receive(ctx, port, dir, u)
 		} else {
-			if u.InputEntry.Text != "" && u.TransmittedBytes == 0 {
-				u.InputEntry.Text = ""
-				gui.ErrorWindow(errors.New("Open the both ports of the pair"), u.App)
-			}
+			_ = protocol.Send(ctx, port, files, u)
 		}
-		runtime.GC()
+	}()
+}
+
+func (m *modemSession) Cancel() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if m.cancel != nil {
+		m.cancel()
+		m.cancel = nil
 	}
 }
 
-func ReceiveData(u *gui.UserInterface) {
+// consoleProgress prints transfer progress for the command line.
+type consoleProgress struct{}
+
+func (consoleProgress) Publish(event gui.Event) {
+	e, ok := event.(gui.TransferProgress)
+	if !ok {
+		return
+	}
+	switch {
+	case e.Finished && e.Err != nil:
+		fmt.Fprintf(os.Stderr, "\r%s: %v\n", e.Name, e.Err)
+	case e.Finished && e.Path != "":
+		fmt.Fprintf(os.Stderr, "\r%s: %d bytes saved to %s\n", e.Name, e.Size, e.Path)
+	case e.Finished:
+		fmt.Fprintf(os.Stderr, "\r%s: %d bytes sent\n", e.Name, e.Size)
+	case e.Total > 0:
+		fmt.Fprintf(os.Stderr, "\r%s: %d of %d bytes, ETA %s", e.Name, e.Done, e.Total, e.ETA())
+	default:
+		fmt.Fprintf(os.Stderr, "\r%s: %d bytes", e.Name, e.Done)
+	}
+}
+
+// runModem sends paths with the protocol, or receives to dir when there
+// are none, without the GUI.
+func runModem(protocolName, portName, dir string, baudRate int, paths []string) error {
+	protocol, err := modem.ByName(protocolName)
+	if err != nil {
+		return err
+	}
+	var files []modem.File
+	for _, path := range paths {
+		file, err := modem.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		files = append(files, file)
+	}
+	port := &rs232.Port{BaudRate: baudRate}
+	_, err = port.OpenPort(portName)
+	if err != nil {
+		return err
+	}
+	defer port.ClosePort()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	if len(files) == 0 {
+		_, err = protocol.Receive(ctx, port, dir, consoleProgress{})
+		return err
+	}
+	return protocol.Send(ctx, port, files, consoleProgress{})
+}
+
+func SampleStats(ctx context.Context, u *gui.UserInterface) {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
 	for {
-		if u.OutputEntry != nil && u.OutputPort.SerialPort != nil {
-			data, err := csma_cd.Receiver(u.OutputPort)
-			if err != nil && err.Error() != "Port has been closed" {
-				gui.ErrorWindow(err, u.App)
-				continue
-			}
-			u.OutputEntry.SetText(u.OutputEntry.Text + data)
+		select {
+		case <-ticker.C:
+			u.Publish(gui.StatsSampled{Snapshot: u.Stack.Stats.Sample()})
+		case <-ctx.Done():
+			return
 		}
-		runtime.GC()
 	}
 }
 
-func main() {
-	u := new(gui.UserInterface)
-	u.App = app.New()
-	w := u.App.NewWindow("Serial port communication")
-	u.App.Settings().SetTheme(&gui.СustomTheme{Theme: theme.DefaultTheme()})
+func setupLogging(level, file string) error {
+	parsedLevel, err := logging.ParseLevel(level)
+	if err != nil {
+		return err
+	}
+	logging.Level.Set(parsedLevel)
+	logging.AddSink(slog.NewJSONHandler(os.Stderr, logging.Options()))
+	if file != "" {
+		rotatingFile, err := logging.NewRotatingFile(file, 1<<20, 3)
+		if err != nil {
+			return err
+		}
+		logging.AddSink(slog.NewTextHandler(rotatingFile, logging.Options()))
+	}
+	slog.SetDefault(logging.For("main"))
+	return nil
+}
+
+// startupProfile is the profile a link opened at startup uses, with the
+// framing and line code flags taking precedence.
+func startupProfile(file *config.File, name, framingName, lineCodeName string) (config.Profile, error) {
+	profile, err := file.Get(name)
+	if err != nil {
+		return config.Profile{}, err
+	}
+	if framingName != "" {
+		profile.Framing = framingName
+	}
+	if lineCodeName != "" {
+		profile.LineCode = lineCodeName
+	}
+	var errs []error
+	for _, err := range profile.Validate() {
+		err.Profile = name
+		errs = append(errs, err)
+	}
+	return profile, errors.Join(errs...)
+}
+
+// application is what the links of the window share.
+type application struct {
+	ctx        context.Context
+	links      *gui.Links
+	config     *config.File
+	configPath string
+	receiveDir string
+	recorder   *rs232.Recorder
+}
+
+// open starts a link with its own ports, protocol stack and statistics and
+// adds it to the window.
+func (a *application) open(name string, profile config.Profile) (*gui.UserInterface, error) {
+	s, err := profile.Stack()
+	if err != nil {
+		return nil, err
+	}
 	ports, err := serial.GetPortsList()
-	if err != nil || len(ports) == 0 {
-		gui.ErrorWindow(errors.New("No serial ports found"), u.App)
-		time.Sleep(time.Minute)
-		panic("No serial ports found!")
+	if err != nil {
+		return nil, err
+	}
+	if len(ports) == 0 {
+		return nil, errors.New("No serial ports found")
+	}
+	ctx, cancel := context.WithCancel(a.ctx)
+	u := new(gui.UserInterface)
+	u.App = a.links.App
+	u.Window = a.links.Window
+	u.Name = name
+	u.Stack = s
+	u.InputPort = &rs232.Port{BaudRate: s.BaudRate}
+	u.OutputPort = &rs232.Port{BaudRate: s.BaudRate}
+	if a.recorder != nil {
+		u.InputPort.SetRecorder(a.recorder)
+		u.OutputPort.SetRecorder(a.recorder)
 	}
-	u.InputPort = new(rs232.Port)
-	u.OutputPort = new(rs232.Port)
 	u.TransmittedBytes = 0
+	u.Config = a.config
+	u.ConfigPath = a.configPath
+	u.Profile = name
+	u.OnProfilesSaved = a.links.RefreshProfiles
+	u.SendQueue = queue.New(64)
+	u.InspectHandlers = csma_cd.InspectHandlers(s)
 	u.InitEntries()
 	u.InitSelects(ports)
 	u.UpdateStatus("")
 	u.MakeGrid()
-	w.SetContent(u.Grid)
-	w.Resize(fyne.NewSize(675, 475))
+	u.Inspect(u.InputPort)
+	u.Inspect(u.OutputPort)
+	go u.RunEvents(ctx)
 	go func() {
-		for {
-			if u.InputPort.SerialPort == nil || u.OutputPort.SerialPort == nil {
-				err := gui.UpdatePorts(u.SelectInputPort, u.SelectOutputPort)
-				if err != nil {
-					gui.ErrorWindow(err, u.App)
-				}
-			} else {
+		for ctx.Err() == nil {
+			if u.InputPort.IsOpen() && u.OutputPort.IsOpen() {
 				break
 			}
+			u.RefreshPorts()
 			time.Sleep(100 * time.Millisecond)
 		}
 	}()
-	go TransmitData(u)
-	go ReceiveData(u)
+	go TransmitData(ctx, u)
+	go ReceiveData(ctx, u, transfer.NewReceiver(a.receiveDir, u))
+	u.OnSendFile = func(name string, content []byte) {
+		go transfer.Send(ctx, u.SendQueue, name, content, u)
+	}
+	u.OnInjectFrame = func(frame []byte) error {
+		if !u.InputPort.IsOpen() {
+			return rs232.ErrNotOpen
+		}
+		return csma_cd.Inject(u.Stack, u.InputPort, frame)
+	}
+	session := new(modemSession)
+	u.Modem.SetProtocols(modem.Names())
+	u.ModemHandlers = gui.ModemHandlers{
+		Send: func(protocol, port, name string, content []byte) {
+			file := modem.File{Name: name, Content: content, ModTime: time.Now(), Mode: 0o644}
+			session.Start(ctx, u, protocol, port, a.receiveDir, []modem.File{file})
+		},
+		Receive: func(protocol, port string) {
+			session.Start(ctx, u, protocol, port, a.receiveDir, nil)
+		},
+		Cancel: session.Cancel,
+	}
+	go SampleStats(ctx, u)
+	u.OnClose = func() {
+		cancel()
+		session.Cancel()
+		_ = u.InputPort.ClosePort()
+		_ = u.OutputPort.ClosePort()
+		slog.Info("Link closed", "profile", name)
+	}
+	a.links.Add(u)
+	slog.Info("Link opened", "profile", name, "framing", s.Framer.Name(), "line_code", s.Code.Name())
+	return u, nil
+}
+
+func defaultLogFile() string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "lab_4", "lab_4.log")
+}
+
+func replayRecording(path, port string, speed float64, s *stack.Stack) error {
+	replay, err := rs232.OpenReplay(path, port, speed)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	receiver := csma_cd.NewReceiver(s, replay.Chunks(ctx))
+	for {
+		data, err := receiver.Next(ctx)
+		if errors.Is(err, rs232.ErrPortClosed) {
+			return nil
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			continue
+		}
+		fmt.Print(data)
+	}
+}
+
+func main() {
+	logLevel := flag.String("log-level", "INFO", "Log level: DEBUG, INFO, WARN or ERROR")
+	logFile := flag.String("log-file", defaultLogFile(), "Rotating log file, empty to disable")
+	captureFile := flag.String("capture", "", "Write the session to a pcapng file")
+	recordFile := flag.String("record", "", "Record raw port traffic to a file")
+	replayFile := flag.String("replay", "", "Decode a recording without the GUI and exit")
+	replayPort := flag.String("replay-port", "", "Port of the recording to replay, empty for all")
+	replaySpeed := flag.Float64("replay-speed", 0, "Replay speed, 1 for original timing, 0 for no delays")
+	configFile := flag.String("config", config.DefaultPath(), "Configuration file with the link profiles")
+	profileName := flag.String("profile", "", "Profile of the link opened at startup, empty for the one the configuration names")
+	linkProfiles := flag.String("links", "",
+		"Comma separated profiles to open a link with each at startup, empty for one link with -profile")
+	framingName := flag.String("framing", "",
+		"Framing of the links opened at startup instead of the profile's: "+strings.Join(framing.Names(), ", "))
+	lineCodeName := flag.String("line-code", "",
+		"Line code of the links opened at startup instead of the profile's: "+strings.Join(linecode.Names(), ", "))
+	metricsAddr := flag.String("metrics-addr", "", "Serve OpenMetrics on this address, e.g. :9464")
+	sendFile := flag.String("send-file", "", "Send this file over the first link once its transmitter port is open")
+	receiveDir := flag.String("receive-dir", ".", "Directory received files are saved to")
+	modemName := flag.String("modem", "",
+		"Transfer files with a device without the GUI and exit: "+strings.Join(modem.Names(), ", "))
+	modemPort := flag.String("modem-port", "", "Serial port of the device for -modem")
+	modemSend := flag.String("modem-send", "", "Comma separated files to send with -modem, empty to receive")
+	flag.Parse()
+	err := setupLogging(*logLevel, *logFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	configuration, err := config.Load(*configFile)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	names := []string{*profileName}
+	if *linkProfiles != "" {
+		names = strings.Split(*linkProfiles, ",")
+	}
+	profiles := make([]config.Profile, len(names))
+	for i, name := range names {
+		if name == "" {
+			names[i] = configuration.Profile
+		}
+		profiles[i], err = startupProfile(configuration, names[i], *framingName, *lineCodeName)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+	}
+	if *captureFile != "" {
+		err = capture.Start(*captureFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		defer capture.Stop()
+	}
+	if *modemName != "" {
+		var paths []string
+		if *modemSend != "" {
+			paths = strings.Split(*modemSend, ",")
+		}
+		err = runModem(*modemName, *modemPort, *receiveDir, profiles[0].BaudRate, paths)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *replayFile != "" {
+		s, err := profiles[0].Stack()
+		if err == nil {
+			err = replayRecording(*replayFile, *replayPort, *replaySpeed, s)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
+	}
+	fyneApp := app.New()
+	w := fyneApp.NewWindow("Serial port communication")
+	fyneApp.Settings().SetTheme(&gui.СustomTheme{Theme: theme.DefaultTheme()})
+	ports, err := serial.GetPortsList()
+	if err != nil || len(ports) == 0 {
+		gui.ErrorWindow(errors.New("No serial ports found"), fyneApp)
+		time.Sleep(time.Minute)
+		panic("No serial ports found!")
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	fyneApp.Lifecycle().SetOnStopped(cancel)
+	a := &application{
+		ctx:        ctx,
+		links:      gui.NewLinks(fyneApp, w, configuration, names[0]),
+		config:     configuration,
+		configPath: *configFile,
+		receiveDir: *receiveDir,
+	}
+	if *recordFile != "" {
+		a.recorder, err = rs232.CreateRecorder(*recordFile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		defer a.recorder.Close()
+	}
+	a.links.OnOpen = func(name string) error {
+		profile, err := configuration.Get(name)
+		if err != nil {
+			return err
+		}
+		_, err = a.open(name, profile)
+		return err
+	}
+	var first *gui.UserInterface
+	for i, profile := range profiles {
+		u, err := a.open(names[i], profile)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(2)
+		}
+		if first == nil {
+			first = u
+		}
+	}
+	w.SetContent(a.links.Content())
+	w.Resize(fyne.NewSize(675, 475))
+	if *metricsAddr != "" {
+		go func() {
+			err := metrics.Serve(ctx, *metricsAddr)
+			if err != nil {
+				slog.Error("Metrics endpoint failed", "addr", *metricsAddr, "err", err)
+				for _, u := range a.links.Links() {
+					u.Publish(gui.Error{Err: err})
+				}
+			}
+		}()
+	}
+	if *sendFile != "" {
+		go SendFile(ctx, first, *sendFile)
+	}
 	w.ShowAndRun()
 }
@@ -0,0 +1,23 @@
+package metrics
+
+// Metrics of the link, updated by the packages that log the same events.
+var (
+	PortBytes = NewCounterVec("rs232_bytes",
+		"Bytes read from and written to serial ports.", "port", "direction")
+	FramesEncoded = NewCounterVec("packet_frames_encoded",
+		"Packets serialized into frames.", "framing")
+	FramesDecoded = NewCounterVec("packet_frames_decoded",
+		"Frames deserialized into packets, by result.", "framing", "result")
+	HammingCorrections = NewCounterVec("packet_hamming_corrections",
+		"Data bits corrected by the Hamming code.")
+	Collisions = NewCounterVec("csma_cd_collisions",
+		"Collisions detected while transmitting.", "port")
+	FramesTransmitted = NewCounterVec("csma_cd_frames",
+		"Frames the transmitter finished, by result.", "port", "result")
+	Attempts = NewHistogram("csma_cd_attempts",
+		"Attempts needed to put one byte on the line.",
+		[]float64{1, 2, 3, 4, 6, 8, 12, 16})
+	Backoff = NewHistogram("csma_cd_backoff_seconds",
+		"Backoff delays after collisions.",
+		[]float64{0.001, 0.002, 0.004, 0.008, 0.016, 0.032, 0.064, 0.128, 0.256, 0.512, 1.024})
+)
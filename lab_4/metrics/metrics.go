@@ -0,0 +1,226 @@
+// Package metrics keeps counters and histograms of the link and serves
+// them in the OpenMetrics text format, so long runs can be scraped by
+// Prometheus. Metrics are registered once as package variables and updated
+// from the same places that log.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const ContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+type metric interface {
+	write(w io.Writer)
+}
+
+var registry = struct {
+	sync.Mutex
+	metrics []metric
+}{}
+
+func register(m metric) {
+	registry.Lock()
+	defer registry.Unlock()
+	registry.metrics = append(registry.metrics, m)
+}
+
+// CounterVec is a family of counters told apart by label values.
+type CounterVec struct {
+	name   string
+	help   string
+	labels []string
+	mutex  sync.Mutex
+	values map[string]*Counter
+}
+
+type Counter struct {
+	labels string
+	mutex  sync.Mutex
+	value  float64
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{name: name, help: help, labels: labels, values: make(map[string]*Counter)}
+	register(c)
+	return c
+}
+
+// With returns the counter for the label values, in the order the labels
+// were declared.
+func (c *CounterVec) With(values ...string) *Counter {
+	labels := formatLabels(c.labels, values)
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	counter, ok := c.values[labels]
+	if !ok {
+		counter = &Counter{labels: labels}
+		c.values[labels] = counter
+	}
+	return counter
+}
+
+func (c *Counter) Add(value float64) {
+	if value < 0 {
+		return
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.value += value
+}
+
+func (c *Counter) Inc() {
+	c.Add(1)
+}
+
+func (c *Counter) Value() float64 {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return c.value
+}
+
+func (c *CounterVec) write(w io.Writer) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	fmt.Fprintf(w, "# TYPE %s counter\n# HELP %s %s\n", c.name, c.name, escapeHelp(c.help))
+	for _, labels := range sortedKeys(c.values) {
+		fmt.Fprintf(w, "%s_total%s %s\n", c.name, labels, formatValue(c.values[labels].Value()))
+	}
+}
+
+type Histogram struct {
+	name    string
+	help    string
+	buckets []float64
+	mutex   sync.Mutex
+	counts  []uint64
+	count   uint64
+	sum     float64
+}
+
+func NewHistogram(name, help string, buckets []float64) *Histogram {
+	h := &Histogram{name: name, help: help, buckets: buckets, counts: make([]uint64, len(buckets))}
+	register(h)
+	return h
+}
+
+func (h *Histogram) Observe(value float64) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	for i, bound := range h.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += value
+}
+
+func (h *Histogram) ObserveDuration(d time.Duration) {
+	h.Observe(d.Seconds())
+}
+
+func (h *Histogram) write(w io.Writer) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	fmt.Fprintf(w, "# TYPE %s histogram\n# HELP %s %s\n", h.name, h.name, escapeHelp(h.help))
+	for i, bound := range h.buckets {
+		fmt.Fprintf(w, "%s_bucket{le=\"%s\"} %d\n", h.name, formatValue(bound), h.counts[i])
+	}
+	fmt.Fprintf(w, "%s_bucket{le=\"+Inf\"} %d\n", h.name, h.count)
+	fmt.Fprintf(w, "%s_sum %s\n%s_count %d\n", h.name, formatValue(h.sum), h.name, h.count)
+}
+
+// Write puts every registered metric to w, ending with the "# EOF" line
+// OpenMetrics requires.
+func Write(w io.Writer) {
+	registry.Lock()
+	metrics := append([]metric(nil), registry.metrics...)
+	registry.Unlock()
+	for _, m := range metrics {
+		m.write(w)
+	}
+	fmt.Fprint(w, "# EOF\n")
+}
+
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		Write(w)
+	})
+}
+
+// Serve exposes /metrics on addr until ctx is cancelled.
+func Serve(ctx context.Context, addr string) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", Handler())
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 5 * time.Second}
+	go func() {
+		<-ctx.Done()
+		server.Close()
+	}()
+	err = server.Serve(listener)
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+	return err
+}
+
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		pairs[i] = name + "=\"" + escapeLabel(value) + "\""
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var (
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func escapeHelp(help string) string {
+	return helpEscaper.Replace(help)
+}
+
+func formatValue(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func sortedKeys(values map[string]*Counter) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
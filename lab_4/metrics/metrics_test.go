@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteOpenMetrics(t *testing.T) {
+	counter := NewCounterVec("test_events", "Events of \"tests\".\nSecond line.", "kind")
+	counter.With("a").Inc()
+	counter.With(`b"\`).Add(2)
+	counter.With("a").Add(-1)
+	histogram := NewHistogram("test_delay_seconds", "Delays.", []float64{0.5, 1})
+	histogram.Observe(0.25)
+	histogram.Observe(0.75)
+	histogram.ObserveDuration(2 * time.Second)
+	var text strings.Builder
+	Write(&text)
+	for _, want := range []string{
+		"# TYPE test_events counter\n# HELP test_events Events of \"tests\".\\nSecond line.\n",
+		"test_events_total{kind=\"a\"} 1\ntest_events_total{kind=\"b\\\"\\\\\"} 2\n",
+		"# TYPE test_delay_seconds histogram\n",
+		"test_delay_seconds_bucket{le=\"0.5\"} 1\n",
+		"test_delay_seconds_bucket{le=\"1\"} 2\n",
+		"test_delay_seconds_bucket{le=\"+Inf\"} 3\n",
+		"test_delay_seconds_sum 3\ntest_delay_seconds_count 3\n",
+	} {
+		if !strings.Contains(text.String(), want) {
+			t.Errorf("output has no %q:\n%s", want, text.String())
+		}
+	}
+	if !strings.HasSuffix(text.String(), "# EOF\n") {
+		t.Error("output does not end with # EOF")
+	}
+}
+
+func TestServe(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skip(err)
+	}
+	addr := listener.Addr().String()
+	listener.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- Serve(ctx, addr) }()
+	var response *http.Response
+	for i := 0; i < 50; i++ {
+		response, err = http.Get("http://" + addr + "/metrics")
+		if err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(response.Body)
+	response.Body.Close()
+	if response.Header.Get("Content-Type") != ContentType {
+		t.Errorf("Content-Type = %q", response.Header.Get("Content-Type"))
+	}
+	if !strings.Contains(string(body), "# TYPE rs232_bytes counter") {
+		t.Errorf("link metrics missing:\n%s", body)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Serve() = %v after cancel", err)
+	}
+}
@@ -0,0 +1,109 @@
+package modem
+
+import (
+	"context"
+	"lab_4/rs232"
+	"time"
+)
+
+const can = 0x18
+
+// conn reads a port byte by byte with timeouts. Reading goes on in the
+// background until close, so pending input can be checked without waiting.
+type conn struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+	port   Port
+	chunks <-chan rs232.Chunk
+	buffer []byte
+}
+
+func newConn(ctx context.Context, port Port) *conn {
+	ctx, cancel := context.WithCancel(ctx)
+	return &conn{ctx: ctx, cancel: cancel, port: port, chunks: rs232.ReadChunks(ctx, port)}
+}
+
+func (c *conn) close() {
+	c.cancel()
+}
+
+func (c *conn) write(data []byte) error {
+	if err := c.ctx.Err(); err != nil {
+		return err
+	}
+	return c.port.WriteBytes(data)
+}
+
+func (c *conn) receive(chunk rs232.Chunk, ok bool) error {
+	if !ok {
+		if err := c.ctx.Err(); err != nil {
+			return err
+		}
+		return rs232.ErrPortClosed
+	}
+	if chunk.Err != nil {
+		return chunk.Err
+	}
+	c.buffer = append(c.buffer, chunk.Data...)
+	return nil
+}
+
+func (c *conn) readByte(timeout time.Duration) (byte, error) {
+	if len(c.buffer) == 0 {
+		timer := time.NewTimer(timeout)
+		defer timer.Stop()
+		for len(c.buffer) == 0 {
+			select {
+			case chunk, ok := <-c.chunks:
+				err := c.receive(chunk, ok)
+				if err != nil {
+					return 0, err
+				}
+			case <-timer.C:
+				return 0, ErrTimeout
+			case <-c.ctx.Done():
+				return 0, c.ctx.Err()
+			}
+		}
+	}
+	b := c.buffer[0]
+	c.buffer = c.buffer[1:]
+	return b, nil
+}
+
+// pending reports whether input is waiting, without blocking.
+func (c *conn) pending() (bool, error) {
+	for {
+		select {
+		case chunk, ok := <-c.chunks:
+			err := c.receive(chunk, ok)
+			if err != nil {
+				return false, err
+			}
+		default:
+			return len(c.buffer) > 0, c.ctx.Err()
+		}
+	}
+}
+
+// purge drops input until the line has been quiet for a tenth of Timeout,
+// well before the other side sends again.
+func (c *conn) purge() error {
+	c.buffer = nil
+	for {
+		_, err := c.readByte(Timeout / 10)
+		if err == ErrTimeout {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		c.buffer = nil
+	}
+}
+
+// abort tells the other side to give up, the way sz and rz do.
+func (c *conn) abort() {
+	sequence := []byte{can, can, can, can, can, can, can, can, 8, 8, 8, 8, 8, 8, 8, 8}
+	_ = c.port.WriteBytes(sequence)
+}
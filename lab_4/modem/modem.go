@@ -0,0 +1,158 @@
+// Package modem moves files over a serial port with the classic transfer
+// protocols, so the tool can talk to boot loaders and to sz/rz: XMODEM with
+// checksum or CRC, XMODEM-1K, YMODEM batch and ZMODEM. Unlike the link, a
+// transfer owns its port for as long as it runs.
+package modem
+
+import (
+	"context"
+	"errors"
+	"lab_4/gui"
+	"lab_4/logging"
+	"lab_4/rs232"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrUnknownProtocol = errors.New("Unknown transfer protocol")
+	ErrSingleFile      = errors.New("XMODEM sends exactly one file")
+	ErrTimeout         = errors.New("Other side stopped answering")
+	ErrCancelled       = errors.New("Transfer cancelled by the other side")
+	ErrTooManyErrors   = errors.New("Too many errors, transfer aborted")
+	ErrSequence        = errors.New("Block out of sequence")
+	ErrInvalidHeader   = errors.New("Invalid file header")
+)
+
+var logger = logging.For("modem")
+
+// Timeout is how long to wait for the other side before retrying, and
+// Retries how many times to retry before giving up.
+var (
+	Timeout = 10 * time.Second
+	Retries = 10
+)
+
+// Port is anything a transfer can run on: a Port or a PipeEnd.
+type Port interface {
+	rs232.Source
+	rs232.Sink
+}
+
+type File struct {
+	Name    string
+	Content []byte
+	ModTime time.Time
+	Mode    os.FileMode
+}
+
+func ReadFile(path string) (File, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return File{}, err
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return File{}, err
+	}
+	return File{Name: filepath.Base(path), Content: content, ModTime: info.ModTime(), Mode: info.Mode().Perm()}, nil
+}
+
+type Protocol interface {
+	Name() string
+	// Send transfers files and returns once the receiver confirmed them.
+	Send(ctx context.Context, port Port, files []File, events gui.Publisher) error
+	// Receive saves the files the sender offers to dir and returns their
+	// paths.
+	Receive(ctx context.Context, port Port, dir string, events gui.Publisher) ([]string, error)
+}
+
+var Protocols = []Protocol{XModem, XModemCRC, XModem1K, YModem, ZModem}
+
+func Names() []string {
+	names := make([]string, len(Protocols))
+	for i, protocol := range Protocols {
+		names[i] = protocol.Name()
+	}
+	return names
+}
+
+func ByName(name string) (Protocol, error) {
+	for _, protocol := range Protocols {
+		if strings.EqualFold(protocol.Name(), name) {
+			return protocol, nil
+		}
+	}
+	return nil, ErrUnknownProtocol
+}
+
+type progress struct {
+	gui.TransferReporter
+	protocol string
+	active   bool
+}
+
+func newProgress(events gui.Publisher, protocol string) *progress {
+	return &progress{TransferReporter: gui.TransferReporter{Events: events}, protocol: protocol}
+}
+
+func (p *progress) start(sending bool, name string, size int64) {
+	p.Start(gui.TransferProgress{Protocol: p.protocol, Sending: sending, Name: name, Size: size, Total: size})
+	p.active = true
+}
+
+func (p *progress) finish(path string, err error) {
+	if err == nil {
+		p.State.Done = p.State.Total
+	}
+	p.active = false
+	p.Finish(path, err)
+}
+
+// fail reports the error that ended a session, for the file in progress or
+// for the session as a whole.
+func (p *progress) fail(sending bool, err error) {
+	logger.Warn("Transfer failed", "protocol", p.protocol, "err", err)
+	if !p.active {
+		p.State = gui.TransferProgress{Protocol: p.protocol, Sending: sending, Name: p.protocol, Started: time.Now()}
+	}
+	p.finish("", err)
+}
+
+// save writes a received file to dir under the name the sender gave,
+// without directories and without replacing existing files.
+func save(dir, name string, content []byte, modTime time.Time) (string, error) {
+	name = filepath.Base(filepath.FromSlash(name))
+	if name == "." || name == string(filepath.Separator) || name == ".." {
+		name = "received.bin"
+	}
+	err := os.MkdirAll(dir, 0o755)
+	if err != nil {
+		return "", err
+	}
+	ext := filepath.Ext(name)
+	for i := 0; ; i++ {
+		path := filepath.Join(dir, name)
+		if i > 0 {
+			path = filepath.Join(dir, strings.TrimSuffix(name, ext)+"."+strconv.Itoa(i)+ext)
+		}
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = file.Write(content)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err == nil && !modTime.IsZero() {
+			err = os.Chtimes(path, modTime, modTime)
+		}
+		return path, err
+	}
+}
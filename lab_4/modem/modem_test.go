@@ -0,0 +1,382 @@
+package modem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"lab_4/gui"
+	"lab_4/rs232"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestVectors(t *testing.T) {
+	if crc := crc16(0, []byte("123456789")); crc != 0x31c3 {
+		t.Errorf("crc16() = %#x, want 0x31c3", crc)
+	}
+	// What sz and rz open a session with.
+	vectors := []struct {
+		header zheader
+		want   string
+	}{
+		{zheader{kind: zrqinit}, "**\x18B00000000000000\r\x8a\x11"},
+		{zheader{kind: zrinit, data: [4]byte{3: 0x23}}, "**\x18B0100000023be50\r\x8a\x11"},
+		{zheader{kind: zfin}, "**\x18B0800000000022d\r\x8a"},
+	}
+	for _, v := range vectors {
+		if got := string(hexHeader(v.header)); got != v.want {
+			t.Errorf("hexHeader(%d) = %q, want %q", v.header.kind, got, v.want)
+		}
+	}
+}
+
+func TestZMODEMFraming(t *testing.T) {
+	data := make([]byte, 256)
+	for i := range data {
+		data[i] = byte(i)
+	}
+	for _, wide := range []bool{false, true} {
+		a, b := rs232.Pipe("/dev/ttyS1", "/dev/ttyS2")
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		h := posHeader(zdata, 0x12345678)
+		frame := append([]byte("garbage*\x11"), binHeader(h, wide)...)
+		frame = append(frame, subpacket(data, zcrcw, wide)...)
+		for _, forbidden := range []byte{xon, xoff, xon | 0x80, xoff | 0x80, 0x10} {
+			if bytes.IndexByte(frame[9:], forbidden) >= 0 {
+				t.Errorf("frame has unescaped %#x", forbidden)
+			}
+		}
+		_ = a.WriteBytes(frame)
+		c := newConn(ctx, b)
+		r := &zreader{c: c}
+		got, gotWide, err := r.readHeader()
+		if err != nil || got != h || gotWide != wide || got.pos() != 0x12345678 {
+			t.Errorf("readHeader() = %v, %v, %v, want %v", got, gotWide, err, h)
+		}
+		payload, end, err := r.readSubpacket(wide)
+		if err != nil || end != zcrcw || !bytes.Equal(payload, data) {
+			t.Errorf("readSubpacket() = %x, %c, %v", payload, end, err)
+		}
+		c.close()
+		cancel()
+		a.Close()
+	}
+}
+
+func TestYModemHeader(t *testing.T) {
+	modTime := time.Unix(1700000000, 0)
+	header := ymodemHeader(File{Name: "fw.bin", Content: make([]byte, 1000), ModTime: modTime, Mode: 0o644})
+	if len(header) != 128 || !bytes.HasPrefix(header, []byte("fw.bin\x001000 14524770400 644\x00")) {
+		t.Fatalf("ymodemHeader() = %q", header)
+	}
+	name, size, gotTime, err := parseYModemHeader(header)
+	if err != nil || name != "fw.bin" || size != 1000 || !gotTime.Equal(modTime) {
+		t.Errorf("parseYModemHeader() = %q, %d, %v, %v", name, size, gotTime, err)
+	}
+}
+
+// relay passes bytes between two pipes and damages the ones corrupt picks.
+func relay(ctx context.Context, from, to *rs232.PipeEnd, corrupt func(n int) bool) {
+	n := 0
+	for chunk := range from.Chunks(ctx) {
+		data := chunk.Data
+		for i := range data {
+			if corrupt(n) {
+				data[i] ^= 0x55
+			}
+			n++
+		}
+		if to.WriteBytes(data) != nil {
+			return
+		}
+	}
+}
+
+func link(t *testing.T, corrupt func(n int) bool) (*rs232.PipeEnd, *rs232.PipeEnd) {
+	sender, senderLine := rs232.Pipe("/dev/ttyS1", "/dev/ttyS2")
+	receiverLine, receiver := rs232.Pipe("/dev/ttyS3", "/dev/ttyS4")
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		sender.Close()
+		receiver.Close()
+	})
+	go relay(ctx, senderLine, receiverLine, corrupt)
+	go relay(ctx, receiverLine, senderLine, func(int) bool { return false })
+	return sender, receiver
+}
+
+func transfer(t *testing.T, protocol Protocol, files []File, corrupt func(n int) bool) []string {
+	timeout := Timeout
+	Timeout = 300 * time.Millisecond
+	defer func() { Timeout = timeout }()
+	sender, receiver := link(t, corrupt)
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	sent := make(chan error, 1)
+	go func() {
+		sent <- protocol.Send(ctx, sender, files, nil)
+	}()
+	dir := t.TempDir()
+	paths, err := protocol.Receive(ctx, receiver, dir, nil)
+	if err != nil {
+		t.Fatalf("Receive() = %v", err)
+	}
+	if err = <-sent; err != nil {
+		t.Fatalf("Send() = %v", err)
+	}
+	return paths
+}
+
+func randomFile(name string, size int) File {
+	content := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(content)
+	return File{Name: name, Content: content, ModTime: time.Unix(1700000000, 0), Mode: 0o644}
+}
+
+// batch tells the protocols that send names and sizes from XMODEM.
+func batch(protocol Protocol) bool {
+	return protocol == YModem || protocol == ZModem
+}
+
+func TestProtocols(t *testing.T) {
+	sizes := []int{0, 1, 127, 128, 1000, 1024, 5000, 200000}
+	noise := map[string]func(n int) bool{
+		"clean": func(int) bool { return false },
+		"noisy": func(n int) bool { return n%20011 == 700 },
+	}
+	for _, protocol := range Protocols {
+		for name, corrupt := range noise {
+			t.Run(protocol.Name()+"/"+name, func(t *testing.T) {
+				var files []File
+				for _, size := range sizes {
+					files = append(files, randomFile("file"+string(rune('a'+len(files)))+".bin", size))
+				}
+				if !batch(protocol) {
+					files = files[len(files)-1:]
+				}
+				paths := transfer(t, protocol, files, corrupt)
+				if len(paths) != len(files) {
+					t.Fatalf("received %d files, want %d", len(paths), len(files))
+				}
+				for i, path := range paths {
+					content, err := os.ReadFile(path)
+					if err != nil {
+						t.Fatal(err)
+					}
+					want := files[i].Content
+					if !batch(protocol) {
+						// XMODEM pads the last block.
+						content = bytes.TrimRight(content, "\x1a")
+						want = bytes.TrimRight(want, "\x1a")
+					} else if filepath.Base(path) != files[i].Name {
+						t.Errorf("saved %s as %s", files[i].Name, path)
+					}
+					if !bytes.Equal(content, want) {
+						t.Errorf("%s: received %d bytes, want %d", path, len(content), len(want))
+					}
+				}
+			})
+		}
+	}
+}
+
+func TestCancel(t *testing.T) {
+	timeout := Timeout
+	Timeout = 300 * time.Millisecond
+	defer func() { Timeout = timeout }()
+	for _, protocol := range Protocols {
+		ctx, cancel := context.WithCancel(context.Background())
+		// Cancel the sender early, before it can fill the pipes with the
+		// whole file.
+		sender, receiver := link(t, func(n int) bool {
+			if n == 100000 {
+				cancel()
+			}
+			return false
+		})
+		sent := make(chan error, 1)
+		go func() {
+			sent <- protocol.Send(ctx, sender, []File{randomFile("big.bin", 4<<20)}, nil)
+		}()
+		events := newRecorder()
+		_, err := protocol.Receive(context.Background(), receiver, t.TempDir(), events)
+		if !errors.Is(err, ErrCancelled) {
+			t.Errorf("%s: Receive() = %v after the sender was cancelled, want %v", protocol.Name(), err, ErrCancelled)
+		}
+		if err = <-sent; !errors.Is(err, context.Canceled) {
+			t.Errorf("%s: Send() = %v", protocol.Name(), err)
+		}
+		name := "big.bin"
+		if !batch(protocol) {
+			name = xmodemName
+		}
+		if failures := events.failures(); len(failures) != 1 || failures[0].Name != name {
+			t.Errorf("%s: reported %v, want one failure of %s", protocol.Name(), failures, name)
+		}
+	}
+}
+
+type recorder struct {
+	mutex  sync.Mutex
+	events []gui.TransferProgress
+}
+
+func newRecorder() *recorder {
+	return new(recorder)
+}
+
+func (r *recorder) Publish(event gui.Event) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if e, ok := event.(gui.TransferProgress); ok {
+		r.events = append(r.events, e)
+	}
+}
+
+func (r *recorder) failures() []gui.TransferProgress {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	var failures []gui.TransferProgress
+	for _, e := range r.events {
+		if e.Finished && e.Err != nil {
+			failures = append(failures, e)
+		}
+	}
+	return failures
+}
+
+// lineWriter hands what an lrzsz command prints to the line end of a pipe.
+type lineWriter struct {
+	line *rs232.PipeEnd
+}
+
+func (w lineWriter) Write(data []byte) (int, error) {
+	if err := w.line.WriteBytes(bytes.Clone(data)); err != nil {
+		return 0, err
+	}
+	return len(data), nil
+}
+
+// lrzsz runs an lrzsz command in dir with its stdin and stdout on a pipe,
+// and returns the end our side of the transfer uses. The test is skipped
+// when the command is not installed.
+func lrzsz(t *testing.T, ctx context.Context, dir, name string, args ...string) (*rs232.PipeEnd, *exec.Cmd) {
+	path, err := exec.LookPath(name)
+	if err != nil {
+		t.Skipf("%s is not installed", name)
+	}
+	port, line := rs232.Pipe("/dev/ttyS1", "/dev/ttyS2")
+	cmd := exec.CommandContext(ctx, path, args...)
+	cmd.Dir = dir
+	cmd.Stdout = lineWriter{line: line}
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		port.Close()
+		line.Close()
+	})
+	go func() {
+		defer stdin.Close()
+		for chunk := range line.Chunks(ctx) {
+			if _, err := stdin.Write(chunk.Data); err != nil {
+				return
+			}
+		}
+	}()
+	return port, cmd
+}
+
+// The lrzsz options for each protocol it shares with us.
+var lrzszOptions = []struct {
+	protocol Protocol
+	option   string
+}{
+	{XModemCRC, "--xmodem"},
+	{YModem, "--ymodem"},
+	{ZModem, "--zmodem"},
+}
+
+func TestLrzszSend(t *testing.T) {
+	for _, o := range lrzszOptions {
+		t.Run(o.protocol.Name(), func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			file := randomFile("sz.bin", 5000)
+			src := t.TempDir()
+			if err := os.WriteFile(filepath.Join(src, file.Name), file.Content, 0o644); err != nil {
+				t.Fatal(err)
+			}
+			port, cmd := lrzsz(t, ctx, src, "sz", "--quiet", o.option, file.Name)
+			paths, err := o.protocol.Receive(ctx, port, t.TempDir(), nil)
+			if err != nil {
+				t.Fatalf("Receive() from sz = %v", err)
+			}
+			if err = cmd.Wait(); err != nil {
+				t.Fatalf("sz: %v", err)
+			}
+			if len(paths) != 1 {
+				t.Fatalf("received %d files from sz, want 1", len(paths))
+			}
+			content, err := os.ReadFile(paths[0])
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := file.Content
+			if !batch(o.protocol) {
+				content = bytes.TrimRight(content, "\x1a")
+				want = bytes.TrimRight(want, "\x1a")
+			} else if filepath.Base(paths[0]) != file.Name {
+				t.Errorf("saved %s as %s", file.Name, paths[0])
+			}
+			if !bytes.Equal(content, want) {
+				t.Errorf("received %d bytes from sz, want %d", len(content), len(want))
+			}
+		})
+	}
+}
+
+func TestLrzszReceive(t *testing.T) {
+	for _, o := range lrzszOptions {
+		t.Run(o.protocol.Name(), func(t *testing.T) {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			defer cancel()
+			file := randomFile("rz.bin", 5000)
+			dir := t.TempDir()
+			args := []string{"--quiet", o.option}
+			if !batch(o.protocol) {
+				// XMODEM sends no name, so rz takes it from the command line.
+				args = append(args, file.Name)
+			}
+			port, cmd := lrzsz(t, ctx, dir, "rz", args...)
+			if err := o.protocol.Send(ctx, port, []File{file}, nil); err != nil {
+				t.Fatalf("Send() to rz = %v", err)
+			}
+			if err := cmd.Wait(); err != nil {
+				t.Fatalf("rz: %v", err)
+			}
+			content, err := os.ReadFile(filepath.Join(dir, file.Name))
+			if err != nil {
+				t.Fatal(err)
+			}
+			want := file.Content
+			if !batch(o.protocol) {
+				content = bytes.TrimRight(content, "\x1a")
+				want = bytes.TrimRight(want, "\x1a")
+			}
+			if !bytes.Equal(content, want) {
+				t.Errorf("rz saved %d bytes, want %d", len(content), len(want))
+			}
+		})
+	}
+}
@@ -0,0 +1,450 @@
+package modem
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"lab_4/gui"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	soh    = 0x01
+	stx    = 0x02
+	eot    = 0x04
+	ack    = 0x06
+	nak    = 0x15
+	cpmEOF = 0x1a
+	crcReq = 'C'
+)
+
+// xmodem covers XMODEM and its descendants up to YMODEM batch, which adds
+// a block 0 with the name and size before every file.
+type xmodem struct {
+	name      string
+	crc       bool
+	blockSize int
+	batch     bool
+}
+
+var (
+	XModem    Protocol = xmodem{name: "xmodem", blockSize: 128}
+	XModemCRC Protocol = xmodem{name: "xmodem-crc", crc: true, blockSize: 128}
+	XModem1K  Protocol = xmodem{name: "xmodem-1k", crc: true, blockSize: 1024}
+	YModem    Protocol = xmodem{name: "ymodem", crc: true, blockSize: 1024, batch: true}
+)
+
+// xmodemName is the file name used for XMODEM, which sends none.
+const xmodemName = "xmodem.bin"
+
+func (x xmodem) Name() string {
+	return x.name
+}
+
+func (x xmodem) Send(ctx context.Context, port Port, files []File, events gui.Publisher) error {
+	if !x.batch && len(files) != 1 {
+		return ErrSingleFile
+	}
+	c := newConn(ctx, port)
+	defer c.close()
+	p := newProgress(events, x.name)
+	err := x.send(c, files, p)
+	if err != nil {
+		p.fail(true, err)
+		if err != ErrCancelled {
+			c.abort()
+		}
+	}
+	return err
+}
+
+func (x xmodem) send(c *conn, files []File, p *progress) error {
+	for _, file := range files {
+		p.start(true, file.Name, int64(len(file.Content)))
+		err := x.sendFile(c, file, p)
+		if err != nil {
+			return err
+		}
+		p.finish("", nil)
+		logger.Info("File sent", "protocol", x.name, "name", file.Name, "size", len(file.Content))
+	}
+	if !x.batch {
+		return nil
+	}
+	crc, err := waitStart(c)
+	if err != nil {
+		return err
+	}
+	return sendBlock(c, 0, make([]byte, 128), crc)
+}
+
+func (x xmodem) sendFile(c *conn, file File, p *progress) error {
+	crc, err := waitStart(c)
+	if err != nil {
+		return err
+	}
+	if x.batch {
+		err = sendBlock(c, 0, ymodemHeader(file), crc)
+		if err != nil {
+			return err
+		}
+		crc, err = waitStart(c)
+		if err != nil {
+			return err
+		}
+	}
+	number := byte(1)
+	for sent := 0; sent < len(file.Content); number++ {
+		size := x.blockSize
+		if len(file.Content)-sent <= 128 {
+			size = 128
+		}
+		block := make([]byte, size)
+		n := copy(block, file.Content[sent:])
+		for i := n; i < size; i++ {
+			block[i] = cpmEOF
+		}
+		err = sendBlock(c, number, block, crc)
+		if err != nil {
+			return err
+		}
+		sent += n
+		p.Update(int64(sent))
+	}
+	return sendEOT(c)
+}
+
+// ymodemHeader is block 0: the name, then the size, modification time and
+// mode in the format sb writes.
+func ymodemHeader(file File) []byte {
+	header := []byte(file.Name)
+	header = append(header, 0)
+	header = fmt.Appendf(header, "%d %o %o", len(file.Content), file.ModTime.Unix(), file.Mode)
+	size := 128
+	if len(header) > size {
+		size = 1024
+	}
+	return append(header, make([]byte, size-len(header))...)
+}
+
+// waitStart waits for the receiver to ask for the next file and reports
+// whether it wants CRC or checksum blocks.
+func waitStart(c *conn) (bool, error) {
+	cancels := 0
+	for tries := 0; tries < Retries; {
+		b, err := c.readByte(Timeout)
+		switch {
+		case err == ErrTimeout:
+			tries++
+		case err != nil:
+			return false, err
+		case b == crcReq:
+			return true, nil
+		case b == nak:
+			return false, nil
+		case b == can:
+			cancels++
+			if cancels == 2 {
+				return false, ErrCancelled
+			}
+			continue
+		}
+		cancels = 0
+	}
+	return false, ErrTimeout
+}
+
+func sendBlock(c *conn, number byte, data []byte, crc bool) error {
+	block := []byte{soh, number, ^number}
+	if len(data) == 1024 {
+		block[0] = stx
+	}
+	block = append(block, data...)
+	if crc {
+		sum := crc16(0, data)
+		block = append(block, byte(sum>>8), byte(sum))
+	} else {
+		block = append(block, checksum(data))
+	}
+	return exchange(c, block)
+}
+
+func sendEOT(c *conn) error {
+	return exchange(c, []byte{eot})
+}
+
+// exchange sends data until the receiver acknowledges it. Late answers
+// to earlier tries are dropped first, or an ACK could be taken for the
+// wrong block.
+func exchange(c *conn, data []byte) error {
+	for tries := 0; tries < Retries; tries++ {
+		_, err := c.pending()
+		if err != nil {
+			return err
+		}
+		c.buffer = nil
+		err = c.write(data)
+		if err != nil {
+			return err
+		}
+		acked, err := reply(c)
+		if acked || err != nil {
+			return err
+		}
+	}
+	return ErrTooManyErrors
+}
+
+// reply waits for the answer of the receiver and reports whether it was
+// ACK; NAK, 'C' and silence ask for the data again.
+func reply(c *conn) (bool, error) {
+	cancels := 0
+	for {
+		b, err := c.readByte(Timeout)
+		switch {
+		case err == ErrTimeout:
+			return false, nil
+		case err != nil:
+			return false, err
+		case b == ack:
+			return true, nil
+		case b == nak || b == crcReq:
+			return false, nil
+		case b == can:
+			cancels++
+			if cancels == 2 {
+				return false, ErrCancelled
+			}
+			continue
+		}
+		cancels = 0
+	}
+}
+
+func (x xmodem) Receive(ctx context.Context, port Port, dir string, events gui.Publisher) ([]string, error) {
+	c := newConn(ctx, port)
+	defer c.close()
+	var paths []string
+	p := newProgress(events, x.name)
+	for {
+		path, err := x.receiveFile(c, dir, p)
+		if err != nil {
+			p.fail(false, err)
+			if err != ErrCancelled {
+				c.abort()
+			}
+			return paths, err
+		}
+		if path == "" {
+			return paths, nil
+		}
+		paths = append(paths, path)
+		if !x.batch {
+			return paths, nil
+		}
+	}
+}
+
+type block struct {
+	number byte
+	data   []byte
+	eot    bool
+}
+
+// receiveFile returns an empty path at the end of a YMODEM batch.
+func (x xmodem) receiveFile(c *conn, dir string, p *progress) (string, error) {
+	crc := x.crc
+	name, size, modTime := xmodemName, int64(-1), time.Time{}
+	if x.batch {
+		header, err := x.receiveBlock(c, &crc, 0, true)
+		for err == nil && header.eot {
+			// The sender missed the ACK of the last EOT.
+			err = c.write([]byte{ack})
+			if err == nil {
+				header, err = x.receiveBlock(c, &crc, 0, true)
+			}
+		}
+		if err != nil {
+			return "", err
+		}
+		if header.data[0] == 0 {
+			return "", c.write([]byte{ack})
+		}
+		name, size, modTime, err = parseYModemHeader(header.data)
+		if err != nil {
+			return "", err
+		}
+		err = c.write([]byte{ack})
+		if err != nil {
+			return "", err
+		}
+	}
+	p.start(false, name, max(size, 0))
+	var content bytes.Buffer
+	expected := byte(1)
+	eots := 0
+	for {
+		b, err := x.receiveBlock(c, &crc, expected, content.Len() == 0 && eots == 0)
+		if err != nil {
+			return "", err
+		}
+		if b.eot {
+			eots++
+			if x.batch && eots == 1 {
+				err = c.write([]byte{nak})
+				if err != nil {
+					return "", err
+				}
+				continue
+			}
+			break
+		}
+		eots = 0
+		if b.number == expected {
+			content.Write(b.data)
+			expected++
+			p.Update(int64(content.Len()))
+		}
+		err = c.write([]byte{ack})
+		if err != nil {
+			return "", err
+		}
+	}
+	err := c.write([]byte{ack})
+	if err != nil {
+		return "", err
+	}
+	data := content.Bytes()
+	if size >= 0 && int64(len(data)) > size {
+		data = data[:size]
+	}
+	path, err := save(dir, name, data, modTime)
+	if err != nil {
+		return "", err
+	}
+	p.State.Size = int64(len(data))
+	p.finish(path, nil)
+	logger.Info("File received", "protocol", x.name, "path", path, "size", len(data))
+	return path, nil
+}
+
+// receiveBlock asks for a block until a good one arrives. The first block
+// of a file is asked for with 'C' or NAK, later ones by NAK alone; XMODEM
+// with CRC falls back to checksums when the sender never starts.
+func (x xmodem) receiveBlock(c *conn, crc *bool, expected byte, first bool) (block, error) {
+	request := byte(nak)
+	for tries := 0; tries < Retries; tries++ {
+		if first {
+			if *crc && !x.batch && tries == Retries/2 {
+				*crc = false
+			}
+			request = nak
+			if *crc {
+				request = crcReq
+			}
+		}
+		if first || tries > 0 {
+			err := c.write([]byte{request})
+			if err != nil {
+				return block{}, err
+			}
+		}
+		b, err := readBlock(c, *crc)
+		if err == errDamaged || err == ErrTimeout {
+			if err == errDamaged {
+				err = c.purge()
+				if err != nil {
+					return block{}, err
+				}
+			}
+			continue
+		}
+		if err != nil {
+			return block{}, err
+		}
+		if !b.eot && b.number != expected && b.number != expected-1 {
+			return block{}, ErrSequence
+		}
+		return b, nil
+	}
+	return block{}, ErrTooManyErrors
+}
+
+// errDamaged is a block that has to be sent again.
+var errDamaged = errors.New("Damaged block")
+
+func readBlock(c *conn, crc bool) (block, error) {
+	cancels := 0
+	for {
+		start, err := c.readByte(Timeout)
+		if err != nil {
+			return block{}, err
+		}
+		size := 0
+		switch start {
+		case soh:
+			size = 128
+		case stx:
+			size = 1024
+		case eot:
+			return block{eot: true}, nil
+		case can:
+			cancels++
+			if cancels == 2 {
+				return block{}, ErrCancelled
+			}
+			continue
+		default:
+			return block{}, errDamaged
+		}
+		trailer := 1
+		if crc {
+			trailer = 2
+		}
+		raw := make([]byte, 2+size+trailer)
+		for i := range raw {
+			raw[i], err = c.readByte(time.Second)
+			if err == ErrTimeout {
+				return block{}, errDamaged
+			}
+			if err != nil {
+				return block{}, err
+			}
+		}
+		number, data := raw[0], raw[2:2+size]
+		if raw[1] != ^number {
+			return block{}, errDamaged
+		}
+		if crc && crc16(0, raw[2:]) != 0 || !crc && checksum(data) != raw[2+size] {
+			return block{}, errDamaged
+		}
+		return block{number: number, data: data}, nil
+	}
+}
+
+func parseYModemHeader(data []byte) (string, int64, time.Time, error) {
+	name, rest, ok := bytes.Cut(data, []byte{0})
+	if !ok {
+		return "", 0, time.Time{}, ErrInvalidHeader
+	}
+	rest, _, _ = bytes.Cut(rest, []byte{0})
+	fields := strings.Fields(string(rest))
+	size, modTime := int64(-1), time.Time{}
+	if len(fields) > 0 {
+		parsed, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return "", 0, time.Time{}, ErrInvalidHeader
+		}
+		size = parsed
+	}
+	if len(fields) > 1 {
+		seconds, err := strconv.ParseInt(fields[1], 8, 64)
+		if err == nil && seconds > 0 {
+			modTime = time.Unix(seconds, 0)
+		}
+	}
+	return string(name), size, modTime, nil
+}
@@ -0,0 +1,756 @@
+package modem
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"lab_4/gui"
+	"time"
+)
+
+const (
+	zpad   = '*'
+	zdle   = 0x18
+	zbin   = 'A'
+	zhex   = 'B'
+	zbin32 = 'C'
+	xon    = 0x11
+	xoff   = 0x13
+)
+
+// Frame types.
+const (
+	zrqinit byte = iota
+	zrinit
+	zsinit
+	zack
+	zfile
+	zskip
+	znak
+	zabort
+	zfin
+	zrpos
+	zdata
+	zeof
+	zferr
+	zcrc
+	zchallenge
+	zcompl
+	zcan
+	zfreecnt
+	zcommand
+)
+
+// Ends of data subpackets: the frame ends, ends and wants an ACK, goes on,
+// or goes on and wants an ACK.
+const (
+	zcrce = 'h'
+	zcrcg = 'i'
+	zcrcq = 'j'
+	zcrcw = 'k'
+	zrub0 = 'l'
+	zrub1 = 'm'
+)
+
+// ZRINIT capabilities and the ZFILE option for binary files.
+const (
+	canFDX  = 0x01
+	canOVIO = 0x02
+	canFC32 = 0x20
+	zcbin   = 0x01
+)
+
+const (
+	zSubpacketSize = 1024
+	zMaxSubpacket  = 8192
+)
+
+type zheader struct {
+	kind byte
+	data [4]byte
+}
+
+// posHeader carries a file position, least significant byte first.
+func posHeader(kind byte, pos int64) zheader {
+	h := zheader{kind: kind}
+	binary.LittleEndian.PutUint32(h.data[:], uint32(pos))
+	return h
+}
+
+func (h zheader) pos() int64 {
+	return int64(binary.LittleEndian.Uint32(h.data[:]))
+}
+
+// flags is ZF0, the last byte of the header.
+func (h zheader) flags() byte {
+	return h.data[3]
+}
+
+func (h zheader) bytes() []byte {
+	return append([]byte{h.kind}, h.data[:]...)
+}
+
+func hexHeader(h zheader) []byte {
+	body := h.bytes()
+	crc := crc16(0, body)
+	body = append(body, byte(crc>>8), byte(crc))
+	frame := append([]byte{zpad, zpad, zdle, zhex}, hex.EncodeToString(body)...)
+	frame = append(frame, '\r', '\n'|0x80)
+	if h.kind != zfin && h.kind != zack {
+		frame = append(frame, xon)
+	}
+	return frame
+}
+
+func binHeader(h zheader, wide bool) []byte {
+	body := h.bytes()
+	frame := []byte{zpad, zdle, zbin}
+	if wide {
+		frame[2] = zbin32
+		body = binary.LittleEndian.AppendUint32(body, crc32.ChecksumIEEE(body))
+	} else {
+		crc := crc16(0, body)
+		body = append(body, byte(crc>>8), byte(crc))
+	}
+	return escape(frame, body)
+}
+
+func subpacket(data []byte, end byte, wide bool) []byte {
+	frame := escape(nil, data)
+	frame = append(frame, zdle, end)
+	var trailer []byte
+	if wide {
+		trailer = binary.LittleEndian.AppendUint32(nil, crc32.Update(crc32.ChecksumIEEE(data), crc32.IEEETable, []byte{end}))
+	} else {
+		crc := crc16(crc16(0, data), []byte{end})
+		trailer = []byte{byte(crc >> 8), byte(crc)}
+	}
+	return escape(frame, trailer)
+}
+
+// escape appends data to frame with the bytes sz escapes: ZDLE, flow
+// control and CR after '@', which telnet would eat.
+func escape(frame, data []byte) []byte {
+	last := byte(0)
+	if len(frame) > 0 {
+		last = frame[len(frame)-1]
+	}
+	for _, b := range data {
+		switch {
+		case b == zdle, b&0x7f == 0x10, b&0x7f == xon, b&0x7f == xoff,
+			b&0x7f == '\r' && last&0x7f == '@':
+			frame = append(frame, zdle, b^0x40)
+		default:
+			frame = append(frame, b)
+		}
+		last = b
+	}
+	return frame
+}
+
+// errGarbled is a header or subpacket that failed its CRC or was cut.
+var errGarbled = errors.New("Garbled ZMODEM frame")
+
+// zreader decodes ZDLE escapes and counts the CANs that abort a transfer.
+type zreader struct {
+	c       *conn
+	cancels int
+}
+
+func (r *zreader) readByte() (byte, error) {
+	b, err := r.c.readByte(Timeout)
+	if err != nil {
+		return 0, err
+	}
+	if b == can {
+		r.cancels++
+		if r.cancels >= 5 {
+			return 0, ErrCancelled
+		}
+	} else {
+		r.cancels = 0
+	}
+	return b, nil
+}
+
+// zdlRead returns the next unescaped byte, or the end of a subpacket with
+// end set.
+func (r *zreader) zdlRead() (b byte, end bool, err error) {
+	for {
+		b, err = r.readByte()
+		if err != nil {
+			return 0, false, err
+		}
+		switch b &^ 0x80 {
+		case xon, xoff:
+			continue
+		}
+		if b != zdle {
+			return b, false, nil
+		}
+		for {
+			b, err = r.readByte()
+			if err != nil {
+				return 0, false, err
+			}
+			if b&^0x80 != xon && b&^0x80 != xoff {
+				break
+			}
+		}
+		switch {
+		case b == zcrce, b == zcrcg, b == zcrcq, b == zcrcw:
+			return b, true, nil
+		case b == zrub0:
+			return 0x7f, false, nil
+		case b == zrub1:
+			return 0xff, false, nil
+		case b == can:
+			continue
+		case b&0x60 == 0x40:
+			return b ^ 0x40, false, nil
+		}
+		return 0, false, errGarbled
+	}
+}
+
+// readHeader skips everything up to the next header and reports whether
+// it came with a 32 bit CRC, as will the subpacket after it.
+func (r *zreader) readHeader() (zheader, bool, error) {
+	for {
+		b, err := r.readByte()
+		if err != nil {
+			return zheader{}, false, err
+		}
+		if b != zpad {
+			continue
+		}
+		for b == zpad {
+			b, err = r.readByte()
+			if err != nil {
+				return zheader{}, false, err
+			}
+		}
+		if b != zdle {
+			continue
+		}
+		format, err := r.readByte()
+		if err != nil {
+			return zheader{}, false, err
+		}
+		switch format {
+		case zhex:
+			h, err := r.readHexHeader()
+			return h, false, err
+		case zbin:
+			h, err := r.readBinHeader(false)
+			return h, false, err
+		case zbin32:
+			h, err := r.readBinHeader(true)
+			return h, true, err
+		}
+	}
+}
+
+func (r *zreader) readHexHeader() (zheader, error) {
+	text := make([]byte, 14)
+	for i := range text {
+		b, err := r.readByte()
+		if err != nil {
+			return zheader{}, err
+		}
+		text[i] = b
+	}
+	body, err := hex.DecodeString(string(text))
+	if err != nil || crc16(0, body) != 0 {
+		return zheader{}, errGarbled
+	}
+	// CR and LF follow, XON too unless the header closes the session.
+	b, err := r.readByte()
+	if err == nil && b&0x7f == '\r' {
+		_, err = r.readByte()
+	}
+	if err != nil {
+		return zheader{}, err
+	}
+	h := zheader{kind: body[0]}
+	copy(h.data[:], body[1:5])
+	return h, nil
+}
+
+func (r *zreader) readBinHeader(wide bool) (zheader, error) {
+	size := 7
+	if wide {
+		size = 9
+	}
+	body := make([]byte, size)
+	for i := range body {
+		b, end, err := r.zdlRead()
+		if err != nil {
+			return zheader{}, err
+		}
+		if end {
+			return zheader{}, errGarbled
+		}
+		body[i] = b
+	}
+	if wide && crc32.ChecksumIEEE(body[:5]) != binary.LittleEndian.Uint32(body[5:]) ||
+		!wide && crc16(0, body) != 0 {
+		return zheader{}, errGarbled
+	}
+	h := zheader{kind: body[0]}
+	copy(h.data[:], body[1:5])
+	return h, nil
+}
+
+func (r *zreader) readSubpacket(wide bool) ([]byte, byte, error) {
+	var data []byte
+	for {
+		b, end, err := r.zdlRead()
+		if err != nil {
+			return nil, 0, err
+		}
+		if !end {
+			if len(data) == zMaxSubpacket {
+				return nil, 0, errGarbled
+			}
+			data = append(data, b)
+			continue
+		}
+		size := 2
+		if wide {
+			size = 4
+		}
+		trailer := make([]byte, size)
+		for i := range trailer {
+			trailer[i], end, err = r.zdlRead()
+			if err != nil {
+				return nil, 0, err
+			}
+			if end {
+				return nil, 0, errGarbled
+			}
+		}
+		if wide {
+			crc := crc32.Update(crc32.ChecksumIEEE(data), crc32.IEEETable, []byte{b})
+			if crc != binary.LittleEndian.Uint32(trailer) {
+				return nil, 0, errGarbled
+			}
+		} else if crc16(crc16(crc16(0, data), []byte{b}), trailer) != 0 {
+			return nil, 0, errGarbled
+		}
+		return data, b, nil
+	}
+}
+
+type zmodem struct{}
+
+var ZModem Protocol = zmodem{}
+
+func (zmodem) Name() string {
+	return "zmodem"
+}
+
+func (zmodem) Send(ctx context.Context, port Port, files []File, events gui.Publisher) error {
+	c := newConn(ctx, port)
+	defer c.close()
+	s := &zsender{c: c, r: &zreader{c: c}, p: newProgress(events, "zmodem")}
+	err := s.run(files)
+	if err != nil {
+		s.p.fail(true, err)
+		if err != ErrCancelled {
+			c.abort()
+		}
+	}
+	return err
+}
+
+type zsender struct {
+	c *conn
+	r *zreader
+	p *progress
+	// wide is set when the receiver takes 32 bit CRCs, window to the size
+	// of its buffer when it cannot take a whole file without pauses.
+	wide   bool
+	window int64
+}
+
+func (s *zsender) run(files []File) error {
+	err := s.c.write([]byte("rz\r"))
+	if err != nil {
+		return err
+	}
+	h, err := s.await(hexHeader(zheader{kind: zrqinit}), zrinit)
+	if err != nil {
+		return err
+	}
+	s.wide = h.flags()&canFC32 != 0
+	s.window = int64(h.data[0]) | int64(h.data[1])<<8
+	for _, file := range files {
+		s.p.start(true, file.Name, int64(len(file.Content)))
+		err = s.sendFile(file)
+		if err != nil {
+			return err
+		}
+		s.p.finish("", nil)
+	}
+	_, err = s.await(hexHeader(zheader{kind: zfin}), zfin)
+	if err != nil {
+		return err
+	}
+	return s.c.write([]byte("OO"))
+}
+
+// await sends request until one of the wanted headers answers it.
+// Challenges are echoed on the way.
+func (s *zsender) await(request []byte, wanted ...byte) (zheader, error) {
+	for tries := 0; tries < Retries; tries++ {
+		err := s.c.write(request)
+		if err != nil {
+			return zheader{}, err
+		}
+		for {
+			h, _, err := s.r.readHeader()
+			if err == ErrTimeout || err == errGarbled {
+				break
+			}
+			if err != nil {
+				return zheader{}, err
+			}
+			if bytes.IndexByte(wanted, h.kind) >= 0 {
+				return h, nil
+			}
+			switch h.kind {
+			case zchallenge:
+				err = s.c.write(hexHeader(zheader{kind: zack, data: h.data}))
+			case znak:
+				err = s.c.write(request)
+			}
+			if err != nil {
+				return zheader{}, err
+			}
+		}
+	}
+	return zheader{}, ErrTooManyErrors
+}
+
+func (s *zsender) sendFile(file File) error {
+	info := fmt.Appendf([]byte(file.Name), "\x00%d %o %o 0 1 %d\x00", len(file.Content),
+		file.ModTime.Unix(), file.Mode, len(file.Content))
+	request := append(binHeader(zheader{kind: zfile, data: [4]byte{3: zcbin}}, s.wide),
+		subpacket(info, zcrcw, s.wide)...)
+	h, err := s.awaitFile(request, file, zrpos, zskip)
+	if err != nil {
+		return err
+	}
+	for h.kind == zrpos {
+		err = s.sendData(file.Content, h.pos())
+		if err == errSkipped {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		h, err = s.awaitFile(binHeader(posHeader(zeof, int64(len(file.Content))), s.wide), file,
+			zrpos, zskip, zrinit)
+		if err != nil {
+			return err
+		}
+	}
+	if h.kind == zskip || err == errSkipped {
+		logger.Info("File skipped by the receiver", "protocol", "zmodem", "name", file.Name)
+		return nil
+	}
+	logger.Info("File sent", "protocol", "zmodem", "name", file.Name, "size", len(file.Content))
+	return nil
+}
+
+// awaitFile is await for the headers about a file, which the receiver may
+// check against a CRC first.
+func (s *zsender) awaitFile(request []byte, file File, wanted ...byte) (zheader, error) {
+	wanted = append(wanted, zcrc)
+	for {
+		h, err := s.await(request, wanted...)
+		if err != nil || h.kind != zcrc {
+			return h, err
+		}
+		request = hexHeader(posHeader(zcrc, int64(crc32.ChecksumIEEE(file.Content))))
+	}
+}
+
+var errSkipped = errors.New("File skipped")
+
+// sendData streams content from pos, starting over wherever the receiver
+// asks with ZRPOS.
+func (s *zsender) sendData(content []byte, pos int64) error {
+	size := int64(len(content))
+	if pos > size {
+		pos = size
+	}
+	for {
+		err := s.c.write(binHeader(posHeader(zdata, pos), s.wide))
+		if err != nil {
+			return err
+		}
+		// The receiver has taken everything before a ZDATA header.
+		acked := pos
+		for {
+			n := min(zSubpacketSize, size-pos)
+			end := byte(zcrcg)
+			switch {
+			case pos+n == size:
+				end = zcrce
+			case s.window > 0 && pos+n-acked >= s.window:
+				end = zcrcw
+			}
+			err = s.c.write(subpacket(content[pos:pos+n], end, s.wide))
+			if err != nil {
+				return err
+			}
+			pos += n
+			s.p.Update(pos)
+			if end == zcrce {
+				return nil
+			}
+			h, interrupted, err := s.interruption(end == zcrcw)
+			if err != nil {
+				return err
+			}
+			if interrupted {
+				if h.kind == zskip {
+					return errSkipped
+				}
+				pos = min(h.pos(), size)
+				break
+			}
+			if end == zcrcw {
+				break
+			}
+		}
+	}
+}
+
+// interruption checks for a header from the receiver without waiting,
+// unless wait is set after a subpacket that wants an ACK. Only ZRPOS and
+// ZSKIP interrupt the data.
+func (s *zsender) interruption(wait bool) (zheader, bool, error) {
+	for tries := 0; ; tries++ {
+		if !wait {
+			pending, err := s.c.pending()
+			if err != nil || !pending {
+				return zheader{}, false, err
+			}
+			if bytes.IndexByte(s.c.buffer, zpad) < 0 && bytes.IndexByte(s.c.buffer, can) < 0 {
+				s.c.buffer = nil
+				return zheader{}, false, nil
+			}
+		}
+		h, _, err := s.r.readHeader()
+		if err == errGarbled || err == ErrTimeout && wait && tries < Retries {
+			continue
+		}
+		if err != nil {
+			return zheader{}, false, err
+		}
+		switch h.kind {
+		case zrpos, zskip:
+			return h, true, nil
+		case zack:
+			if wait {
+				return h, false, nil
+			}
+		}
+	}
+}
+
+func (zmodem) Receive(ctx context.Context, port Port, dir string, events gui.Publisher) ([]string, error) {
+	c := newConn(ctx, port)
+	defer c.close()
+	r := &zreceiver{c: c, r: &zreader{c: c}, p: newProgress(events, "zmodem"), dir: dir}
+	err := r.run()
+	if err != nil {
+		r.p.fail(false, err)
+		if err != ErrCancelled {
+			c.abort()
+		}
+	}
+	return r.paths, err
+}
+
+type zreceiver struct {
+	c     *conn
+	r     *zreader
+	p     *progress
+	dir   string
+	paths []string
+	// The file being received; name is empty between files.
+	name    string
+	size    int64
+	modTime time.Time
+	content bytes.Buffer
+}
+
+func (r *zreceiver) init() []byte {
+	return hexHeader(zheader{kind: zrinit, data: [4]byte{3: canFDX | canOVIO | canFC32}})
+}
+
+func (r *zreceiver) run() error {
+	err := r.c.write(r.init())
+	if err != nil {
+		return err
+	}
+	errs := 0
+	for {
+		h, wide, err := r.r.readHeader()
+		if err == ErrTimeout || err == errGarbled {
+			errs++
+			if errs > Retries {
+				return ErrTooManyErrors
+			}
+			err = r.c.write(r.retry())
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		reply, done, err := r.handle(h, wide)
+		if err == errGarbled || err == ErrTimeout {
+			errs++
+			if errs > Retries {
+				return ErrTooManyErrors
+			}
+			reply, err = r.retry(), nil
+		} else if err == nil {
+			errs = 0
+		}
+		if err == nil && reply != nil {
+			err = r.c.write(reply)
+		}
+		if err != nil || done {
+			return err
+		}
+	}
+}
+
+// retry asks again for whatever was expected.
+func (r *zreceiver) retry() []byte {
+	if r.name != "" {
+		return hexHeader(posHeader(zrpos, int64(r.content.Len())))
+	}
+	return r.init()
+}
+
+func (r *zreceiver) handle(h zheader, wide bool) ([]byte, bool, error) {
+	pos := int64(r.content.Len())
+	switch h.kind {
+	case zrqinit:
+		return r.init(), false, nil
+	case zsinit:
+		_, _, err := r.r.readSubpacket(wide)
+		if err != nil {
+			return nil, false, err
+		}
+		return hexHeader(zheader{kind: zack}), false, nil
+	case zfile:
+		info, _, err := r.r.readSubpacket(wide)
+		if err == errGarbled {
+			return hexHeader(zheader{kind: znak}), false, nil
+		}
+		if err != nil {
+			return nil, false, err
+		}
+		err = r.open(info)
+		if err != nil {
+			return nil, false, err
+		}
+		return hexHeader(posHeader(zrpos, 0)), false, nil
+	case zdata:
+		if r.name == "" {
+			return nil, false, nil
+		}
+		if h.pos() != pos {
+			return hexHeader(posHeader(zrpos, pos)), false, nil
+		}
+		return r.receiveData(wide)
+	case zeof:
+		if r.name == "" {
+			// The sender missed the ZRINIT after the last file.
+			return r.init(), false, nil
+		}
+		if h.pos() != pos {
+			return nil, false, nil
+		}
+		return r.init(), false, r.save()
+	case zfin:
+		err := r.c.write(hexHeader(zheader{kind: zfin}))
+		if err != nil {
+			return nil, true, err
+		}
+		// The sender ends with "OO", but sz does not wait for anyone.
+		for i := 0; i < 2; i++ {
+			_, err = r.c.readByte(time.Second)
+			if err != nil {
+				break
+			}
+		}
+		return nil, true, nil
+	}
+	return nil, false, nil
+}
+
+func (r *zreceiver) open(info []byte) error {
+	name, size, modTime, err := parseYModemHeader(info)
+	if err != nil || name == "" {
+		return ErrInvalidHeader
+	}
+	r.name, r.size, r.modTime = name, size, modTime
+	r.content.Reset()
+	r.p.start(false, name, max(size, 0))
+	return nil
+}
+
+func (r *zreceiver) receiveData(wide bool) ([]byte, bool, error) {
+	for {
+		data, end, err := r.r.readSubpacket(wide)
+		if err != nil {
+			return nil, false, err
+		}
+		r.content.Write(data)
+		r.p.Update(int64(r.content.Len()))
+		pos := int64(r.content.Len())
+		switch end {
+		case zcrce:
+			return nil, false, nil
+		case zcrcw:
+			return hexHeader(posHeader(zack, pos)), false, nil
+		case zcrcq:
+			err = r.c.write(hexHeader(posHeader(zack, pos)))
+			if err != nil {
+				return nil, false, err
+			}
+		}
+	}
+}
+
+func (r *zreceiver) save() error {
+	data := r.content.Bytes()
+	if r.size >= 0 && int64(len(data)) > r.size {
+		data = data[:r.size]
+	}
+	path, err := save(r.dir, r.name, data, r.modTime)
+	if err != nil {
+		return err
+	}
+	r.p.finish(path, nil)
+	logger.Info("File received", "protocol", "zmodem", "path", path, "size", len(data))
+	r.paths = append(r.paths, path)
+	r.name = ""
+	r.content.Reset()
+	return nil
+}
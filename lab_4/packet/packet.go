@@ -1,20 +1,30 @@
 package packet
 
 import (
-	"bytes"
 	"errors"
 	"fmt"
+	"lab_4/framing"
+	"lab_4/logging"
+	"lab_4/metrics"
+	"lab_4/settings"
+	"lab_4/stack"
+	"lab_4/stuffing"
 	"math/rand"
 	"strings"
+	"sync"
 	"time"
 )
 
+var logger = logging.For("packet")
+
+var ErrFCSMismatch = errors.New("FCS mismatch")
+
 type Packet struct {
 	Flag        [8]byte
 	Destination [4]byte
 	Source      [4]byte
 	Data        [7]byte
-	FCS         [3]byte
+	FCS         [4]byte
 }
 
 func NewPacket(source int, data string) Packet {
@@ -26,7 +36,7 @@ func NewPacket(source int, data string) Packet {
 		Destination: [4]byte{0, 0, 0, 0},
 		Source:      [4]byte(StrToByte(fmt.Sprintf("%04b", source))),
 		Data:        [7]byte(StrToByte(data)),
-		FCS:         [3]byte{0, 0, 0},
+		FCS:         [4]byte{0, 0, 0, 0},
 	}
 }
 
@@ -67,101 +77,343 @@ func (packet *Packet) ToRaw() []byte {
 	return rawPacket
 }
 
-func SerializePacket(data string, source int) ([]byte, string, error) {
+// Payload is what framer frames of the packet: the fields after the flag,
+// one bit per byte for the lab framing. The byte framers get them packed:
+//
+//	0 destination << 4 | source
+//	1 data as a 7-bit number, the first bit highest
+//	2 the data bits that are '\n', in the same order
+//	3 FCS as a 4-bit number
+func (packet *Packet) Payload(framer framing.Framer) []byte {
+	if _, ok := framer.(framing.Bits); ok {
+		return packet.ToRaw()[8:]
+	}
+	return []byte{
+		packBits(packet.Destination[:], 1)<<4 | packBits(packet.Source[:], 1),
+		packBits(packet.Data[:], 1),
+		packBits(packet.Data[:], '\n'),
+		packBits(packet.FCS[:], 1),
+	}
+}
+
+// payloadPacket is the packet of a payload framer returned.
+func payloadPacket(framer framing.Framer, payload []byte) (Packet, error) {
+	packet := NewPacket(0, "0000000")
+	if _, ok := framer.(framing.Bits); ok {
+		if len(payload) != 19 {
+			return Packet{}, errors.New("Invalid packet")
+		}
+		copy(packet.Destination[:], payload[:4])
+		copy(packet.Source[:], payload[4:8])
+		copy(packet.Data[:], payload[8:15])
+		copy(packet.FCS[:], payload[15:])
+		return packet, nil
+	}
+	if len(payload) != 4 || payload[1]&payload[2] != 0 || payload[1]|payload[2] > 0x7F || payload[3] > 0x0F {
+		return Packet{}, errors.New("Invalid packet")
+	}
+	unpackBits(packet.Destination[:], payload[0]>>4, 1)
+	unpackBits(packet.Source[:], payload[0]&0x0F, 1)
+	unpackBits(packet.Data[:], payload[1], 1)
+	unpackBits(packet.Data[:], payload[2], '\n')
+	unpackBits(packet.FCS[:], payload[3], 1)
+	return packet, nil
+}
+
+// packBits sets a bit of the result, the first one highest, for every
+// field byte equal to value.
+func packBits(field []byte, value byte) byte {
+	var packed byte
+	for _, b := range field {
+		packed <<= 1
+		if b == value {
+			packed |= 1
+		}
+	}
+	return packed
+}
+
+// unpackBits sets the field bytes whose bit of packed is 1 to value.
+func unpackBits(field []byte, packed byte, value byte) {
+	for i := range field {
+		if packed>>(len(field)-1-i)&1 == 1 {
+			field[i] = value
+		}
+	}
+}
+
+func SerializePacket(s *stack.Stack, data string, source int) ([]byte, string, error) {
 	if len(data) != 7 {
 		return nil, "", errors.New("Wrong data in packet")
 	}
 	packet := NewPacket(source, data)
-	//log.Printf("Serialize packet:\n%s", strings.ReplaceAll(DataToStr(packet.ToRaw()), "\n", "\\n"))
-	packet.GetHammingFCS()
-	packet.Distortion()
-	stuffedPacket := BitStuffing(packet)
-	formattedPacket := FindStuffedBits(stuffedPacket)
-	return stuffedPacket, formattedPacket, nil
+	logger.Debug("Serialize packet", "bits", strings.ReplaceAll(DataToStr(packet.ToRaw()), "\n", "\\n"))
+	link := s.Settings.Current()
+	if link.FCS != settings.FCSOff {
+		packet.GetHammingFCS()
+	}
+	packet.Distortion(link.DistortionChance)
+	frame, inserted := s.Framer.Frame(packet.Payload(s.Framer))
+	metrics.FramesEncoded.With(s.Framer.Name()).Inc()
+	return frame, formatFrame(s.Framer, frame, inserted), nil
+}
+
+// ComposeFrame frames a packet exactly as given, for fault injection: no
+// distortion, and the FCS is only computed when asked. Stuffing frames the
+// packet with framer, keeping the given flag for the lab framing; without
+// it the fields are sent as they are, flag included.
+func ComposeFrame(framer framing.Framer, packet Packet, computeFCS, stuff bool) ([]byte, string) {
+	if computeFCS {
+		packet.GetHammingFCS()
+	}
+	if !stuff {
+		frame := packet.ToRaw()
+		return frame, formatFrame(framing.Lab, frame, nil)
+	}
+	frame, inserted := framer.Frame(packet.Payload(framer))
+	if _, ok := framer.(framing.Bits); ok {
+		copy(frame, packet.Flag[:])
+	}
+	return frame, formatFrame(framer, frame, inserted)
 }
 
-func DeserializePacket(rawPacket []byte) (string, error) {
-	if len(rawPacket) < 26 {
-		return "", errors.New("Packet is too short")
+func ParseRawData(s *stack.Stack, rawData []byte) (string, error) {
+	newText := ""
+	for {
+		payload, n, err := s.Framer.Next(rawData)
+		if n == 0 {
+			return newText, nil
+		}
+		rawData = rawData[n:]
+		if err != nil {
+			return newText, err
+		}
+		data, err := ParsePayload(s, payload)
+		if err != nil {
+			return newText, err
+		}
+		newText += data
 	}
-	//log.Printf("Deserialize packet:\n%s", strings.ReplaceAll(DataToStr(rawPacket), "\n", "\\n"))
-	deStuffedPacket, err := DeBitStuffing(rawPacket)
+}
+
+func DeserializePacket(s *stack.Stack, rawPacket []byte) (string, error) {
+	logger.Debug("Deserialize packet", "bits", strings.ReplaceAll(DataToStr(rawPacket), "\n", "\\n"))
+	payload, err := nextPayload(s, rawPacket)
 	if err != nil {
 		return "", err
 	}
-	deStuffedPacket.CleanDistortion()
-	data := DataToStr(deStuffedPacket.Data[:])
+	return ParsePayload(s, payload)
+}
+
+// InspectPacket is DeserializePacket for a frame that is only looked at:
+// it leaves the session stats and the metrics alone.
+func InspectPacket(s *stack.Stack, rawPacket []byte) (string, error) {
+	payload, err := nextPayload(s, rawPacket)
+	if err != nil {
+		return "", err
+	}
+	data, _, err := decodePayload(s, payload)
 	return data, err
 }
 
-func BitStuffing(packet Packet) []byte {
-	stuffedPacket := packet.ToRaw()
-	for i := 7; i < len(stuffedPacket)-7; i++ {
-		if bytes.Equal(stuffedPacket[i:i+7], []byte{1, 0, 0, 0, 0, 1, 1}) {
-			stuffedPacket = append(stuffedPacket[:i+7],
-				append([]byte{0}, stuffedPacket[i+7:]...)...)
-			i += 7
+func nextPayload(s *stack.Stack, rawPacket []byte) ([]byte, error) {
+	payload, n, err := s.Framer.Next(rawPacket)
+	if err != nil {
+		return nil, err
+	}
+	if n == 0 {
+		return nil, errors.New("Invalid packet")
+	}
+	return payload, nil
+}
+
+// ParsePayload checks the FCS as the link settings say and returns the data
+// of a packet without the flag, as it comes out of a framer.
+func ParsePayload(s *stack.Stack, payload []byte) (string, error) {
+	framer := s.Framer.Name()
+	data, corrected, err := decodePayload(s, payload)
+	switch {
+	case errors.Is(err, ErrFCSMismatch):
+		metrics.FramesDecoded.With(framer, "fcs_mismatch").Inc()
+		return "", err
+	case err != nil:
+		metrics.FramesDecoded.With(framer, "invalid_packet").Inc()
+		return "", err
+	}
+	if corrected {
+		s.Stats.FrameCorrected()
+		metrics.HammingCorrections.With().Inc()
+	}
+	metrics.FramesDecoded.With(framer, "ok").Inc()
+	return data, nil
+}
+
+// decodePayload is ParsePayload without counting anything. It also tells
+// whether the FCS corrected a data bit.
+func decodePayload(s *stack.Stack, payload []byte) (string, bool, error) {
+	packet, err := payloadPacket(s.Framer, payload)
+	if err != nil {
+		return "", false, err
+	}
+	received := packet
+	corrected := false
+	switch s.Settings.Current().FCS {
+	case settings.FCSCorrect:
+		corrected = packet.CleanDistortion() != received.Data
+	case settings.FCSDetect:
+		if packet.GetHammingFCS() != received.FCS {
+			return "", false, ErrFCSMismatch
 		}
 	}
+	return DataToStr(packet.Data[:]), corrected, nil
+}
+
+func BitStuffing(packet Packet) []byte {
+	stuffedPacket, _ := stuffing.Lab.Encode(packet.ToRaw()[8:])
 	return stuffedPacket
 }
 
 func DeBitStuffing(packet []byte) (Packet, error) {
-	if len(packet) < 26 || !bytes.Equal(packet[:8], []byte{1, 0, 0, 0, 0, 1, 1, 1}) {
+	body, _, err := stuffing.Lab.Decode(packet)
+	if err != nil || len(body) < 19 {
 		return Packet{}, errors.New("Invalid packet")
-	} else {
-		deStuffedPacket := NewPacket(0, "0000000")
-		for i := 7; i < len(packet); i++ {
-			if len(packet) == 26 {
-				break
-			}
-			if i+8 <= len(packet) && bytes.Equal(packet[i:i+7], []byte{1, 0, 0, 0, 0, 1, 1}) {
-				packet = append(packet[:i+7], packet[i+8:]...)
-				i += 6
-			}
-		}
-		copy(deStuffedPacket.Flag[:], packet[:8])
-		copy(deStuffedPacket.Destination[:], packet[8:12])
-		copy(deStuffedPacket.Source[:], packet[12:16])
-		copy(deStuffedPacket.Data[:], packet[16:23])
-		copy(deStuffedPacket.FCS[:], packet[23:])
-		return deStuffedPacket, nil
 	}
+	deStuffedPacket := NewPacket(0, "0000000")
+	copy(deStuffedPacket.Destination[:], body[:4])
+	copy(deStuffedPacket.Source[:], body[4:8])
+	copy(deStuffedPacket.Data[:], body[8:15])
+	copy(deStuffedPacket.FCS[:], body[15:])
+	return deStuffedPacket, nil
 }
 
 func FindStuffedBits(packet []byte) string {
+	_, removed, _ := stuffing.Lab.Decode(packet)
+	return formatStuffedBits(packet, removed)
+}
+
+type Field int
+
+const (
+	FieldFlag Field = iota
+	FieldDestination
+	FieldSource
+	FieldData
+	FieldFCS
+	FieldStuffed
+)
+
+func (f Field) String() string {
+	return [...]string{"Flag", "Destination", "Source", "Data", "FCS", "Stuffed"}[f]
+}
+
+// FrameFields tells which field every byte of a frame of framer belongs
+// to. Bytes of a frame that does not decode are all FieldFlag.
+func FrameFields(framer framing.Framer, frame []byte) []Field {
+	fields := make([]Field, len(frame))
+	payload, n, err := framer.Next(frame)
+	if n == 0 || err != nil {
+		return fields
+	}
+	_, inserted := framer.Frame(payload)
+	layout := fieldLayout(framer)
+	opening, closing := framer.Delimiters()
+	stuffed := make(map[int]bool, len(inserted))
+	for _, i := range inserted {
+		stuffed[i] = true
+	}
+	index := 0
+	for i := opening; i < n-closing; i++ {
+		switch {
+		case stuffed[i]:
+			fields[i] = FieldStuffed
+		case index < len(layout):
+			fields[i] = layout[index]
+		default:
+			fields[i] = FieldFCS
+		}
+		if !stuffed[i] {
+			index++
+		}
+	}
+	return fields
+}
+
+// fieldLayout is the field of every payload byte of framer. The address
+// byte of the byte framers counts as the destination.
+func fieldLayout(framer framing.Framer) []Field {
+	if _, ok := framer.(framing.Bits); !ok {
+		return []Field{FieldDestination, FieldData, FieldData, FieldFCS}
+	}
+	var fields []Field
+	for field, count := range [...]int{FieldDestination: 4, FieldSource: 4, FieldData: 7, FieldFCS: 4} {
+		for ; count > 0; count-- {
+			fields = append(fields, Field(field))
+		}
+	}
+	return fields
+}
+
+func formatFrame(framer framing.Framer, frame []byte, inserted []int) string {
+	if _, ok := framer.(framing.Bits); ok {
+		return formatStuffedBits(frame, inserted)
+	}
+	formattedFrame := make([]string, len(frame))
+	for i, b := range frame {
+		formattedFrame[i] = fmt.Sprintf("%02x", b)
+	}
+	for _, i := range inserted {
+		formattedFrame[i] = "-" + formattedFrame[i] + "-"
+	}
+	return strings.Join(formattedFrame, " ")
+}
+
+// formatStuffedBits wraps the stuffed bits in dashes and separates the FCS.
+func formatStuffedBits(packet []byte, stuffed []int) string {
 	strPacket := DataToStr(packet)
-	formattedPacket := strPacket[:7]
+	formattedPacket := ""
 	stuffedBits := 0
-	for i := 7; i < len(packet); i++ {
+	for i := range packet {
+		if stuffedBits < len(stuffed) && stuffed[stuffedBits] == i {
+			formattedPacket += "-" + string(strPacket[i]) + "-"
+			stuffedBits++
+			continue
+		}
 		if i == 23+stuffedBits {
 			formattedPacket += " "
 		}
-		if i+8 < len(packet) && strPacket[i:i+8] == "10000110" {
-			formattedPacket += strPacket[i : i+7]
-			formattedPacket += "-" + string(strPacket[i+7]) + "-"
-			stuffedBits++
-			i += 7
-		} else {
-			formattedPacket += string(strPacket[i])
-		}
+		formattedPacket += string(strPacket[i])
 	}
 	formattedPacket = strings.ReplaceAll(formattedPacket, "\n", "\\n")
 	return formattedPacket
 }
 
+var random = struct {
+	sync.Mutex
+	*rand.Rand
+}{Rand: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// Seed makes Chance, Random and Distortion repeatable, which tests rely on.
+func Seed(seed int64) {
+	random.Lock()
+	defer random.Unlock()
+	random.Rand = rand.New(rand.NewSource(seed))
+}
+
+func Random(n int) int {
+	random.Lock()
+	defer random.Unlock()
+	return random.Intn(n)
+}
+
 func Chance(percent int) bool {
-	source := rand.NewSource(time.Now().UnixNano())
-	random := rand.New(source)
-	chance := random.Intn(100)
+	chance := Random(100)
 	return chance < percent
 }
 
-func (packet *Packet) Distortion() Packet {
-	source := rand.NewSource(time.Now().UnixNano())
-	random := rand.New(source)
-	bitError := random.Intn(7)
-	if Chance(30) {
+// Distortion flips a random data bit with the given chance, in percent.
+func (packet *Packet) Distortion(percent int) Packet {
+	bitError := Random(7)
+	if Chance(percent) {
 		if packet.Data[bitError] == 1 {
 			packet.Data[bitError] = 0
 		} else {
@@ -173,55 +425,61 @@ func (packet *Packet) Distortion() Packet {
 	return *packet
 }
 
-func (packet *Packet) GetHammingFCS() [3]byte {
-	data := packet.Data
-	for i := range data {
-		if data[i] != 0 && data[i] != 1 {
-			data[i] = 0
+// hammingPositions are the positions of the data bits in the Hamming code
+// word, counted from 1. The check bits take the powers of two.
+var hammingPositions = [7]int{3, 5, 6, 7, 9, 10, 11}
+
+func (packet *Packet) GetHammingFCS() [4]byte {
+	packet.FCS = hammingFCS(packet.Data)
+	return packet.FCS
+}
+
+// hammingFCS computes check bit k as the parity of the data bits whose
+// position has bit k set. Data bits that are not 0 or 1 count as 0.
+func hammingFCS(data [7]byte) [4]byte {
+	var fcs [4]byte
+	for i, position := range hammingPositions {
+		if data[i] != 1 {
+			continue
+		}
+		for k := range fcs {
+			if position&(1<<k) != 0 {
+				fcs[k] ^= 1
+			}
 		}
 	}
-	packet.FCS[0] = data[0] ^ data[2] ^ data[4] ^ data[6]
-	packet.FCS[1] = data[1] ^ data[2] ^ data[5] ^ data[6]
-	packet.FCS[2] = data[3] ^ data[4] ^ data[5] ^ data[6]
-	return packet.FCS
+	return fcs
 }
 
 //	 Hamming code
-//	 1 1 1 1 1 1 1
-//	 0 1 2 3 4 5 6
+//	 position  1 2 3 4 5 6 7 8 9 10 11
+//	 bit       0 1 0 2 1 2 3 3 4 5  6
+//	           F F D F D D D F D D  D
 //
-// 0 х   х   х   х 0
-// 1   х х     х х 0
-// 2       х х х х 0
+// 0 х   х   х   х   х    х
+// 1   х х     х х     х  х
+// 2       х х х х
+// 3               х х х  х
 
+// CleanDistortion corrects a single flipped bit of the packet and returns
+// the data. The syndrome is the position of the flipped bit: a data bit is
+// flipped back, and a check bit leaves the data as it is.
 func (packet *Packet) CleanDistortion() [7]byte {
-	var newFCS [3]byte
-	data := packet.Data
-	for i := range data {
-		if data[i] != 0 && data[i] != 1 {
-			data[i] = 0
+	fcs := hammingFCS(packet.Data)
+	syndrome := 0
+	for k := range fcs {
+		if fcs[k] != packet.FCS[k] {
+			syndrome |= 1 << k
 		}
 	}
-	newFCS[0] = data[0] ^ data[2] ^ data[4] ^ data[6]
-	newFCS[1] = data[1] ^ data[2] ^ data[5] ^ data[6]
-	newFCS[2] = data[3] ^ data[4] ^ data[5] ^ data[6]
-	pos := 0
-
-	if newFCS[0] != packet.FCS[0] {
-		pos += 1
-	}
-	if newFCS[1] != packet.FCS[1] {
-		pos += 2
-	}
-	if newFCS[2] != packet.FCS[2] {
-		pos += 4
-	}
-
-	if pos >= 1 {
-		if packet.Data[pos-1] == 0 {
-			packet.Data[pos-1] = 1
+	for i, position := range hammingPositions {
+		if position != syndrome {
+			continue
+		}
+		if packet.Data[i] == 0 {
+			packet.Data[i] = 1
 		} else {
-			packet.Data[pos-1] = 0
+			packet.Data[i] = 0
 		}
 	}
 	return packet.Data
@@ -0,0 +1,462 @@
+package packet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"lab_4/framing"
+	"lab_4/linecode"
+	"lab_4/settings"
+	"lab_4/stack"
+	"strings"
+	"testing"
+)
+
+var flag = []byte{1, 0, 0, 0, 0, 1, 1, 1}
+
+func allData() []string {
+	data := make([]string, 0, 128)
+	for value := 0; value < 128; value++ {
+		data = append(data, fmt.Sprintf("%07b", value))
+	}
+	return data
+}
+
+func newStack(framer framing.Framer) *stack.Stack {
+	return stack.New(framer, linecode.None, 115200, settings.Default)
+}
+
+func stuffedPacket(source int, data string) []byte {
+	packet := NewPacket(source, data)
+	packet.GetHammingFCS()
+	return BitStuffing(packet)
+}
+
+func containsFlagAfterStart(stuffed []byte) bool {
+	for i := 1; i+len(flag) <= len(stuffed); i++ {
+		if bytes.Equal(stuffed[i:i+len(flag)], flag) {
+			return true
+		}
+	}
+	return false
+}
+
+func TestBitStuffing(t *testing.T) {
+	tests := []struct {
+		name   string
+		source int
+		data   string
+		want   string
+	}{
+		{"no stuffing", 1, "0000000", "100001110000000100000000000"},
+		{"stuffing in data", 1, "0000110", "1000011100000001000011001100"},
+		{"stuffing after flag", 12, "1000000", "1000011100001100010000001100"},
+		{"chained patterns", 12, "0111000", "10000111000011000011010000010"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := DataToStr(stuffedPacket(test.source, test.data))
+			if got != test.want {
+				t.Errorf("BitStuffing() = %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestBitStuffingRoundTrip(t *testing.T) {
+	for source := 0; source < 16; source++ {
+		for _, data := range allData() {
+			stuffed := stuffedPacket(source, data)
+			packet, err := DeBitStuffing(stuffed)
+			if err != nil {
+				t.Fatalf("DeBitStuffing(%s) error: %v", DataToStr(stuffed), err)
+			}
+			if got := DataToStr(packet.Data[:]); got != data {
+				t.Errorf("source %d: data %s came back as %s", source, data, got)
+			}
+			if got := DataToStr(packet.Source[:]); got != fmt.Sprintf("%04b", source) {
+				t.Errorf("source %d: source came back as %s", source, got)
+			}
+		}
+	}
+}
+
+func TestBitStuffingHidesFlag(t *testing.T) {
+	for source := 0; source < 16; source++ {
+		for _, data := range allData() {
+			stuffed := stuffedPacket(source, data)
+			if !bytes.Equal(stuffed[:8], flag) {
+				t.Fatalf("stuffed packet %s does not start with the flag", DataToStr(stuffed))
+			}
+			if containsFlagAfterStart(stuffed) {
+				t.Errorf("source %d, data %s: flag inside %s", source, data, DataToStr(stuffed))
+			}
+		}
+	}
+}
+
+func TestDeBitStuffingKeepsInput(t *testing.T) {
+	stuffed := stuffedPacket(1, "0000110")
+	before := append([]byte(nil), stuffed...)
+	_, err := DeBitStuffing(stuffed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(stuffed, before) {
+		t.Errorf("DeBitStuffing modified its input: %s", DataToStr(stuffed))
+	}
+}
+
+func TestFindStuffedBits(t *testing.T) {
+	tests := []struct {
+		name   string
+		source int
+		data   string
+		want   string
+	}{
+		{"no stuffing", 1, "0000000", "10000111000000010000000 0000"},
+		{"stuffing in data", 1, "0000110", "1000011100000001000011-0-0 1100"},
+		{"stuffing after flag", 12, "1000000", "10000111000011-0-001000000 1100"},
+		{"chained patterns", 12, "0111000", "10000111000011-0-00011-0-1000 0010"},
+		{"newline data", 1, "000000\n", "1000011100000001000000\\n 0000"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got := FindStuffedBits(stuffedPacket(test.source, test.data))
+			if got != test.want {
+				t.Errorf("FindStuffedBits() = %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFrameFields(t *testing.T) {
+	for _, framer := range framing.Framers {
+		t.Run(framer.Name(), func(t *testing.T) {
+			frame, _, err := SerializePacket(newStack(framer), "0000110", 1)
+			if err != nil {
+				t.Fatal(err)
+			}
+			payload, _, _ := framer.Next(frame)
+			counts := make(map[Field]int)
+			for _, field := range FrameFields(framer, frame) {
+				counts[field]++
+			}
+			opening, closing := framer.Delimiters()
+			_, inserted := framer.Frame(payload)
+			want := map[Field]int{
+				FieldFlag:        opening + closing,
+				FieldDestination: 1,
+				FieldData:        2,
+				FieldFCS:         1,
+				FieldStuffed:     len(inserted),
+			}
+			if _, ok := framer.(framing.Bits); ok {
+				want[FieldDestination] = 4
+				want[FieldSource] = 4
+				want[FieldData] = 7
+				want[FieldFCS] = 4
+			}
+			for field, count := range want {
+				if counts[field] != count {
+					t.Errorf("%d bytes of %s, want %d", counts[field], field, count)
+				}
+			}
+		})
+	}
+	fields := FrameFields(framing.Lab, stuffedPacket(1, "0000110"))
+	if fields[22] != FieldStuffed || fields[21] != FieldData || fields[23] != FieldData {
+		t.Errorf("FrameFields() = %v", fields)
+	}
+}
+
+func TestPayloadCarriesSpecialBytes(t *testing.T) {
+	tests := []struct {
+		name        string
+		destination string
+		source      string
+		data        string
+		special     byte
+	}{
+		{"ppp flag", "0000", "0001", "1111110", 0x7E},
+		{"ppp escape", "0000", "0001", "1111101", 0x7D},
+		{"slip end", "1100", "0000", "0101010", 0xC0},
+		{"slip escape", "1101", "1011", "0101010", 0xDB},
+		{"zero", "0000", "0001", "0000000", 0x00},
+		{"newline", "0000", "0001", "10\n\n010", 0x18},
+	}
+	for _, framer := range []framing.Framer{framing.PPP, framing.SLIP, framing.COBS} {
+		for _, test := range tests {
+			packet := NewPacket(1, test.data)
+			packet.Destination = [4]byte(StrToByte(test.destination))
+			packet.Source = [4]byte(StrToByte(test.source))
+			packet.GetHammingFCS()
+			payload := packet.Payload(framer)
+			if !bytes.Contains(payload, []byte{test.special}) {
+				t.Fatalf("%s: payload % x lacks 0x%02x", test.name, payload, test.special)
+			}
+			frame, _ := framer.Frame(payload)
+			got, _, err := framer.Next(frame)
+			if err != nil {
+				t.Fatalf("%s %s: Next() error: %v", framer.Name(), test.name, err)
+			}
+			parsed, err := payloadPacket(framer, got)
+			if err != nil || parsed != packet {
+				t.Errorf("%s %s: payload % x came back as %v, %v", framer.Name(), test.name, payload, parsed, err)
+			}
+		}
+	}
+}
+
+func TestHammingCorrectsSingleDataError(t *testing.T) {
+	for _, data := range allData() {
+		for bit := 0; bit < 7; bit++ {
+			packet := NewPacket(1, data)
+			packet.GetHammingFCS()
+			packet.Data[bit] ^= 1
+			packet.CleanDistortion()
+			if got := DataToStr(packet.Data[:]); got != data {
+				t.Errorf("data %s with bit %d flipped corrected to %s", data, bit, got)
+			}
+		}
+	}
+}
+
+// The syndrome of a flipped check bit points at the check bit, so the data
+// comes back unchanged from every single-bit error of the packet.
+func TestHammingCorrectsEverySingleError(t *testing.T) {
+	for _, data := range allData() {
+		for bit := 0; bit < 7+4; bit++ {
+			packet := NewPacket(1, data)
+			packet.GetHammingFCS()
+			if bit < 7 {
+				packet.Data[bit] ^= 1
+			} else {
+				packet.FCS[bit-7] ^= 1
+			}
+			received := packet
+			if received.GetHammingFCS() == packet.FCS {
+				t.Errorf("data %s with bit %d flipped not detected", data, bit)
+			}
+			if got := packet.CleanDistortion(); DataToStr(got[:]) != data {
+				t.Errorf("data %s with bit %d flipped corrected to %s", data, bit, DataToStr(got[:]))
+			}
+		}
+	}
+}
+
+func TestHammingKeepsValidData(t *testing.T) {
+	for _, data := range allData() {
+		packet := NewPacket(1, data)
+		packet.GetHammingFCS()
+		packet.CleanDistortion()
+		if got := DataToStr(packet.Data[:]); got != data {
+			t.Errorf("valid data %s changed to %s", data, got)
+		}
+	}
+}
+
+func TestGetHammingFCS(t *testing.T) {
+	tests := []struct {
+		data string
+		want [4]byte
+	}{
+		{"0000000", [4]byte{0, 0, 0, 0}},
+		{"1111111", [4]byte{1, 1, 1, 1}},
+		{"1000000", [4]byte{1, 1, 0, 0}},
+		{"0100000", [4]byte{1, 0, 1, 0}},
+		{"0001000", [4]byte{1, 1, 1, 0}},
+		{"0000001", [4]byte{1, 1, 0, 1}},
+		{"0000110", [4]byte{1, 1, 0, 0}},
+		{"000000\n", [4]byte{0, 0, 0, 0}},
+	}
+	for _, test := range tests {
+		packet := NewPacket(1, test.data)
+		if got := packet.GetHammingFCS(); got != test.want {
+			t.Errorf("GetHammingFCS(%q) = %v, want %v", test.data, got, test.want)
+		}
+	}
+}
+
+func TestSerializeDeserialize(t *testing.T) {
+	s := newStack(framing.Lab)
+	for _, data := range append(allData(), "101\n010", "\n\n\n\n\n\n\n") {
+		rawPacket, _, err := SerializePacket(s, data, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := DeserializePacket(s, rawPacket)
+		if err != nil {
+			t.Fatalf("DeserializePacket(%s) error: %v", DataToStr(rawPacket), err)
+		}
+		if got != data {
+			t.Errorf("SerializePacket(%q) came back as %q", data, got)
+		}
+	}
+}
+
+func TestFCSModes(t *testing.T) {
+	s := newStack(framing.Lab)
+	payload := func(data string, flipped int) []byte {
+		packet := NewPacket(1, data)
+		packet.GetHammingFCS()
+		if flipped >= 0 {
+			packet.Data[flipped] ^= 1
+		}
+		return packet.ToRaw()[8:]
+	}
+	tests := []struct {
+		mode    settings.FCSMode
+		flipped int
+		want    string
+		wantErr error
+	}{
+		{settings.FCSCorrect, -1, "0110100", nil},
+		{settings.FCSCorrect, 2, "0110100", nil},
+		{settings.FCSDetect, -1, "0110100", nil},
+		{settings.FCSDetect, 2, "", ErrFCSMismatch},
+		{settings.FCSOff, 2, "0100100", nil},
+	}
+	for _, test := range tests {
+		s.Settings.Update(func(link *settings.Link) { link.FCS = test.mode })
+		got, err := ParsePayload(s, payload("0110100", test.flipped))
+		if got != test.want || !errors.Is(err, test.wantErr) {
+			t.Errorf("%s with bit %d flipped: ParsePayload() = %q, %v, want %q, %v",
+				test.mode, test.flipped, got, err, test.want, test.wantErr)
+		}
+	}
+	s.Settings.Set(settings.Link{FCS: settings.FCSOff})
+	rawPacket, _, err := SerializePacket(s, "1111111", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fcs := rawPacket[len(rawPacket)-4:]; !bytes.Equal(fcs, []byte{0, 0, 0, 0}) {
+		t.Errorf("FCS sent with the FCS off = %v, want zeros", fcs)
+	}
+}
+
+func TestComposeFrame(t *testing.T) {
+	s := newStack(framing.Lab)
+	composed := NewPacket(3, "0000110")
+	frame, _ := ComposeFrame(framing.Lab, composed, true, true)
+	if got, err := DeserializePacket(s, frame); err != nil || got != "0000110" {
+		t.Errorf("DeserializePacket(composed frame) = %q, %v", got, err)
+	}
+	if composed.FCS != [4]byte{} {
+		t.Error("ComposeFrame changed the FCS of its argument")
+	}
+	wrongFCS := NewPacket(3, "0000110")
+	wrongFCS.FCS = [4]byte{0, 1, 1, 0}
+	frame, _ = ComposeFrame(framing.Lab, wrongFCS, false, true)
+	if got, err := DeserializePacket(s, frame); err != nil || got == "0000110" {
+		t.Errorf("DeserializePacket(frame with a wrong FCS) = %q, %v", got, err)
+	}
+
+	// Without stuffing the flag inside the payload reaches the line.
+	flagInside := NewPacket(1, "0000111")
+	frame, formatted := ComposeFrame(framing.Lab, flagInside, false, false)
+	if !bytes.Equal(frame, flagInside.ToRaw()) || strings.Contains(formatted, "-") {
+		t.Errorf("ComposeFrame(unstuffed) = %s %q", DataToStr(frame), formatted)
+	}
+	if bytes.Index(frame[1:], flagInside.Flag[:]) < 0 {
+		t.Errorf("frame %s has no flag inside", DataToStr(frame))
+	}
+	frame, formatted = ComposeFrame(framing.Lab, flagInside, false, true)
+	if !strings.Contains(formatted, "-") || bytes.Index(frame[1:], flagInside.Flag[:]) >= 0 {
+		t.Errorf("ComposeFrame(stuffed) = %q", formatted)
+	}
+
+	customFlag := NewPacket(1, "0000000")
+	customFlag.Flag = [8]byte{1, 1, 1, 1, 1, 1, 1, 1}
+	frame, _ = ComposeFrame(framing.Lab, customFlag, true, true)
+	if !bytes.HasPrefix(frame, customFlag.Flag[:]) {
+		t.Errorf("ComposeFrame did not keep the flag: %s", DataToStr(frame))
+	}
+}
+
+func TestSerializePacketRejectsWrongLength(t *testing.T) {
+	s := newStack(framing.Lab)
+	for _, data := range []string{"", "101", "10101010"} {
+		_, _, err := SerializePacket(s, data, 1)
+		if err == nil {
+			t.Errorf("SerializePacket(%q) accepted data of length %d", data, len(data))
+		}
+	}
+}
+
+func TestParseRawData(t *testing.T) {
+	var stream []byte
+	want := ""
+	for _, data := range []string{"0000110", "1111111", "0101010"} {
+		packet := NewPacket(1, data)
+		packet.GetHammingFCS()
+		stream = append(stream, BitStuffing(packet)...)
+		want += data
+	}
+	got, err := ParseRawData(newStack(framing.Lab), stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got != want {
+		t.Errorf("ParseRawData() = %q, want %q", got, want)
+	}
+}
+
+func TestDeserializePacketRejectsGarbage(t *testing.T) {
+	tests := [][]byte{
+		nil,
+		make([]byte, 26),
+		make([]byte, 27),
+		append([]byte{1, 0, 0, 0, 0, 1, 1, 0}, make([]byte, 19)...),
+	}
+	s := newStack(framing.Lab)
+	for _, rawPacket := range tests {
+		_, err := DeserializePacket(s, rawPacket)
+		if err == nil {
+			t.Errorf("DeserializePacket(%v) accepted garbage", rawPacket)
+		}
+	}
+}
+
+func FuzzBitStuffingRoundTrip(f *testing.F) {
+	f.Add(uint8(1), uint8(0b0000110))
+	f.Add(uint8(3), uint8(0b0000110))
+	f.Add(uint8(0), uint8(0))
+	f.Fuzz(func(t *testing.T, source, value uint8) {
+		data := fmt.Sprintf("%07b", value&0x7f)
+		stuffed := stuffedPacket(int(source), data)
+		if containsFlagAfterStart(stuffed) {
+			t.Fatalf("flag inside %s", DataToStr(stuffed))
+		}
+		packet, err := DeBitStuffing(stuffed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := DataToStr(packet.Data[:]); got != data {
+			t.Fatalf("data %s came back as %s", data, got)
+		}
+	})
+}
+
+func FuzzParseRawData(f *testing.F) {
+	f.Add(stuffedPacket(1, "0000110"))
+	f.Add(append(stuffedPacket(1, "1111111"), flag...))
+	f.Add([]byte{1, 0, 0, 0, 0, 1, 1, 1, 1, 0, 0, 0, 0, 1, 1, 1})
+	s := newStack(framing.Lab)
+	f.Fuzz(func(t *testing.T, rawData []byte) {
+		_, _ = ParseRawData(s, rawData)
+	})
+}
+
+func FuzzDeserializePacket(f *testing.F) {
+	f.Add(stuffedPacket(1, "0000110"))
+	f.Add(make([]byte, 30))
+	s := newStack(framing.Lab)
+	f.Fuzz(func(t *testing.T, rawPacket []byte) {
+		before := append([]byte(nil), rawPacket...)
+		_, _ = DeserializePacket(s, rawPacket)
+		if !bytes.Equal(rawPacket, before) {
+			t.Fatalf("DeserializePacket modified its input")
+		}
+	})
+}
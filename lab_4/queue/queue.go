@@ -0,0 +1,93 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var ErrFull = errors.New("Send queue is full")
+
+type Queue struct {
+	payloads chan item
+}
+
+type item struct {
+	payload []byte
+	batch   *Batch
+}
+
+// Batch follows the payloads of one sender through the worker, so the
+// sender learns when they are transmitted and whether any failed.
+type Batch struct {
+	mutex sync.Mutex
+	done  int
+	err   error
+}
+
+// Done returns how many payloads of the batch were transmitted or failed,
+// and the first failure.
+func (b *Batch) Done() (int, error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	return b.done, b.err
+}
+
+func (b *Batch) finish(err error) {
+	b.mutex.Lock()
+	defer b.mutex.Unlock()
+	b.done++
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+func New(size int) *Queue {
+	return &Queue{payloads: make(chan item, size)}
+}
+
+// Send waits for room in the queue, so callers that can afford to block get
+// backpressure instead of an error. It gives up when ctx is cancelled.
+func (q *Queue) Send(ctx context.Context, payload []byte) error {
+	return q.SendBatch(ctx, nil, payload)
+}
+
+// SendBatch is Send for a payload that batch follows.
+func (q *Queue) SendBatch(ctx context.Context, batch *Batch, payload []byte) error {
+	select {
+	case q.payloads <- item{payload: payload, batch: batch}:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// TrySend never blocks and returns ErrFull when the worker falls behind.
+func (q *Queue) TrySend(payload []byte) error {
+	select {
+	case q.payloads <- item{payload: payload}:
+		return nil
+	default:
+		return ErrFull
+	}
+}
+
+func (q *Queue) Len() int {
+	return len(q.payloads)
+}
+
+// Run hands queued payloads to transmit one at a time until ctx is
+// cancelled. The error transmit returns is reported to the payload's batch.
+func (q *Queue) Run(ctx context.Context, transmit func(ctx context.Context, payload []byte) error) error {
+	for {
+		select {
+		case item := <-q.payloads:
+			err := transmit(ctx, item.payload)
+			if item.batch != nil {
+				item.batch.finish(err)
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// run starts the worker of q with transmit and stops it when the test ends.
+func run(t *testing.T, q *Queue, transmit func(ctx context.Context, payload []byte) error) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- q.Run(ctx, transmit)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		<-stopped
+	})
+}
+
+func TestRunKeepsOrder(t *testing.T) {
+	q := New(4)
+	var mutex sync.Mutex
+	var got []string
+	done := make(chan struct{})
+	payloads := []string{"a", "b", "c", "d", "e", "f", "g", "h", "i", "j"}
+	run(t, q, func(ctx context.Context, payload []byte) error {
+		mutex.Lock()
+		defer mutex.Unlock()
+		got = append(got, string(payload))
+		if len(got) == len(payloads) {
+			close(done)
+		}
+		return nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	for _, payload := range payloads {
+		if err := q.Send(ctx, []byte(payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	select {
+	case <-done:
+	case <-ctx.Done():
+		t.Fatal("payloads were not transmitted")
+	}
+	mutex.Lock()
+	defer mutex.Unlock()
+	for i := range payloads {
+		if got[i] != payloads[i] {
+			t.Fatalf("transmitted %q, want %q", got, payloads)
+		}
+	}
+}
+
+func TestTrySendFull(t *testing.T) {
+	q := New(2)
+	for i := 0; i < 2; i++ {
+		if err := q.TrySend([]byte{byte(i)}); err != nil {
+			t.Fatalf("TrySend() = %v with room in the queue", err)
+		}
+	}
+	if err := q.TrySend([]byte{2}); !errors.Is(err, ErrFull) {
+		t.Errorf("TrySend() = %v on a full queue, want %v", err, ErrFull)
+	}
+	if q.Len() != 2 {
+		t.Errorf("Len() = %d, want 2", q.Len())
+	}
+}
+
+func TestSendGivesUpWhenCancelled(t *testing.T) {
+	q := New(1)
+	if err := q.Send(context.Background(), []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := q.Send(ctx, []byte("b")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Send() = %v on a full queue, want %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestBatchReportsFirstError(t *testing.T) {
+	q := New(4)
+	first := errors.New("First failure")
+	second := errors.New("Second failure")
+	run(t, q, func(ctx context.Context, payload []byte) error {
+		switch string(payload) {
+		case "b":
+			return first
+		case "c":
+			return second
+		}
+		return nil
+	})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	batch := new(Batch)
+	other := new(Batch)
+	for _, payload := range []string{"a", "b", "c", "d"} {
+		if err := q.SendBatch(ctx, batch, []byte(payload)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := q.SendBatch(ctx, other, []byte("e")); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		done, _ := other.Done()
+		if done == 1 || ctx.Err() != nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	done, err := batch.Done()
+	if done != 4 || !errors.Is(err, first) {
+		t.Errorf("Done() = %d, %v, want 4, %v", done, err, first)
+	}
+	if done, err := other.Done(); done != 1 || err != nil {
+		t.Errorf("Done() of another batch = %d, %v, want 1, nil", done, err)
+	}
+}
+
+func TestRunStopsWhenCancelled(t *testing.T) {
+	q := New(1)
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	started := make(chan struct{})
+	go func() {
+		stopped <- q.Run(ctx, func(ctx context.Context, payload []byte) error {
+			close(started)
+			<-ctx.Done()
+			return ctx.Err()
+		})
+	}()
+	batch := new(Batch)
+	if err := q.SendBatch(ctx, batch, []byte("a")); err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	cancel()
+	select {
+	case err := <-stopped:
+		if !errors.Is(err, context.Canceled) {
+			t.Errorf("Run() = %v, want %v", err, context.Canceled)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Run() did not stop")
+	}
+	if done, err := batch.Done(); done != 1 || !errors.Is(err, context.Canceled) {
+		t.Errorf("Done() = %d, %v for a payload cancelled in transmit", done, err)
+	}
+}
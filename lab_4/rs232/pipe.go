@@ -0,0 +1,70 @@
+package rs232
+
+import (
+	"context"
+	"sync"
+)
+
+// PipeEnd is one side of an in-memory port pair: whatever is written to one
+// end is read from the other, one write per chunk. It stands in for a pair
+// of virtual serial ports in tests.
+type PipeEnd struct {
+	Name   string
+	input  chan []byte
+	output chan []byte
+	closed chan struct{}
+	once   *sync.Once
+}
+
+func Pipe(nameA, nameB string) (*PipeEnd, *PipeEnd) {
+	ab := make(chan []byte, 1024)
+	ba := make(chan []byte, 1024)
+	closed := make(chan struct{})
+	once := new(sync.Once)
+	a := &PipeEnd{Name: nameA, input: ba, output: ab, closed: closed, once: once}
+	b := &PipeEnd{Name: nameB, input: ab, output: ba, closed: closed, once: once}
+	return a, b
+}
+
+func (p *PipeEnd) WriteBytes(data []byte) error {
+	select {
+	case <-p.closed:
+		return ErrPortClosed
+	default:
+	}
+	select {
+	case p.output <- append([]byte(nil), data...):
+		return nil
+	case <-p.closed:
+		return ErrPortClosed
+	}
+}
+
+func (p *PipeEnd) ReadContext(ctx context.Context) ([]byte, error) {
+	select {
+	case data := <-p.input:
+		return data, nil
+	case <-p.closed:
+		return nil, ErrPortClosed
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (p *PipeEnd) PortNumber() (int, error) {
+	return extractNum(p.Name), nil
+}
+
+func (p *PipeEnd) PortName() string {
+	return p.Name
+}
+
+func (p *PipeEnd) Chunks(ctx context.Context) <-chan Chunk {
+	return ReadChunks(ctx, p)
+}
+
+// Close closes both ends of the pair.
+func (p *PipeEnd) Close() error {
+	p.once.Do(func() { close(p.closed) })
+	return nil
+}
@@ -0,0 +1,220 @@
+package rs232
+
+import (
+	"bufio"
+	"context"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Recordings are text files with one chunk per line:
+//
+//	<microseconds since start> <R|W> <port name> <hex bytes>
+//
+// Lines starting with '#' are comments, so recordings can be annotated
+// before they are checked in as test fixtures.
+
+type Direction byte
+
+const (
+	Read  Direction = 'R'
+	Write Direction = 'W'
+)
+
+type Recorder struct {
+	mutex  sync.Mutex
+	output io.Writer
+	closer io.Closer
+	start  time.Time
+	closed bool
+}
+
+func NewRecorder(output io.Writer) *Recorder {
+	return &Recorder{output: output, start: time.Now()}
+}
+
+func CreateRecorder(path string) (*Recorder, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	r := NewRecorder(file)
+	r.closer = file
+	return r, nil
+}
+
+func (r *Recorder) Record(direction Direction, port string, data []byte) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return nil
+	}
+	_, err := fmt.Fprintf(r.output, "%d %c %s %s\n",
+		time.Since(r.start).Microseconds(), direction, port, hex.EncodeToString(data))
+	return err
+}
+
+// Close stops the recording; chunks recorded afterwards are dropped.
+func (r *Recorder) Close() error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	if r.closer == nil {
+		return nil
+	}
+	return r.closer.Close()
+}
+
+func (p *Port) SetRecorder(recorder *Recorder) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.recorder = recorder
+}
+
+// Tap sees every chunk read from and written to a port, such as the
+// inspector pane. data is a copy the tap may keep.
+type Tap func(direction Direction, port string, data []byte)
+
+func (p *Port) SetTap(tap Tap) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.tap = tap
+}
+
+func (p *Port) record(direction Direction, name string, data []byte) {
+	p.mutex.RLock()
+	recorder, tap := p.recorder, p.tap
+	p.mutex.RUnlock()
+	if len(data) == 0 {
+		return
+	}
+	if tap != nil {
+		tap(direction, name, append([]byte(nil), data...))
+	}
+	if recorder == nil {
+		return
+	}
+	err := recorder.Record(direction, name, data)
+	if err != nil {
+		logger.Error("Recording failed", "port", name, "err", err)
+	}
+}
+
+type RecordedChunk struct {
+	Offset    time.Duration
+	Direction Direction
+	Port      string
+	Data      []byte
+}
+
+func ParseRecording(input io.Reader) ([]RecordedChunk, error) {
+	var chunks []RecordedChunk
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for lineNumber := 1; scanner.Scan(); lineNumber++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 4 || len(fields[1]) != 1 {
+			return nil, fmt.Errorf("recording line %d: expected 4 fields", lineNumber)
+		}
+		micros, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("recording line %d: %w", lineNumber, err)
+		}
+		data, err := hex.DecodeString(fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("recording line %d: %w", lineNumber, err)
+		}
+		chunks = append(chunks, RecordedChunk{
+			Offset:    time.Duration(micros) * time.Microsecond,
+			Direction: Direction(fields[1][0]),
+			Port:      fields[2],
+			Data:      data,
+		})
+	}
+	return chunks, scanner.Err()
+}
+
+// Replay plays back the chunks read from one port of a recording. Speed 1
+// keeps the original timing, larger values accelerate it and 0 replays
+// without any delay.
+type Replay struct {
+	Speed  float64
+	Number int
+	chunks []RecordedChunk
+	next   int
+	last   time.Duration
+}
+
+func NewReplay(input io.Reader, port string, speed float64) (*Replay, error) {
+	recorded, err := ParseRecording(input)
+	if err != nil {
+		return nil, err
+	}
+	r := &Replay{Speed: speed, Number: extractNum(port)}
+	for _, chunk := range recorded {
+		if chunk.Direction == Read && (port == "" || chunk.Port == port) {
+			r.chunks = append(r.chunks, chunk)
+		}
+	}
+	return r, nil
+}
+
+func OpenReplay(path, port string, speed float64) (*Replay, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	return NewReplay(file, port, speed)
+}
+
+// ReadContext returns the next recorded chunk and ErrPortClosed once the
+// recording is exhausted, like a port that has been closed.
+func (r *Replay) ReadContext(ctx context.Context) ([]byte, error) {
+	if r.next >= len(r.chunks) {
+		return nil, ErrPortClosed
+	}
+	chunk := r.chunks[r.next]
+	if r.Speed > 0 && chunk.Offset > r.last {
+		delay := time.Duration(float64(chunk.Offset-r.last) / r.Speed)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	r.next++
+	r.last = chunk.Offset
+	return chunk.Data, nil
+}
+
+func (r *Replay) PortNumber() (int, error) {
+	return r.Number, nil
+}
+
+// ReadAll concatenates the remaining chunks, for decoders such as
+// packet.ParseRawData that work on a whole buffer.
+func (r *Replay) ReadAll() []byte {
+	var data []byte
+	for ; r.next < len(r.chunks); r.next++ {
+		data = append(data, r.chunks[r.next].Data...)
+	}
+	return data
+}
+
+func (r *Replay) Chunks(ctx context.Context) <-chan Chunk {
+	return ReadChunks(ctx, r)
+}
@@ -1,21 +1,57 @@
 package rs232
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"go.bug.st/serial"
-	"log"
+	"lab_4/logging"
+	"lab_4/metrics"
 	"os"
 	"os/exec"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 )
 
+var (
+	ErrNotOpen    = errors.New("Serial port is not open")
+	ErrPortClosed = errors.New("Port has been closed")
+)
+
+var logger = logging.For("rs232")
+
+const ReadTimeout = 100 * time.Millisecond
+
 type Port struct {
 	Name       string
 	Number     int
+	BaudRate   int
 	SerialPort serial.Port
+	buff       []byte
+	recorder   *Recorder
+	tap        Tap
+	mutex      sync.RWMutex
+}
+
+// Source is anything chunks can be read from: a Port, a PipeEnd or a Replay.
+type Source interface {
+	ReadContext(ctx context.Context) ([]byte, error)
+	PortNumber() (int, error)
+}
+
+// Sink is anything frames can be written to: a Port or a PipeEnd.
+type Sink interface {
+	WriteBytes(data []byte) error
+	PortNumber() (int, error)
+}
+
+type Chunk struct {
+	Port int
+	Data []byte
+	Err  error
 }
 
 func DefaultConfig() *serial.Mode {
@@ -27,43 +63,83 @@ func DefaultConfig() *serial.Mode {
 	}
 }
 
+// Mode is the configuration the port is opened with.
+func (p *Port) Mode() *serial.Mode {
+	mode := DefaultConfig()
+	if p.BaudRate != 0 {
+		mode.BaudRate = p.BaudRate
+	}
+	return mode
+}
+
 func (p *Port) OpenPort(name string) (serial.Port, error) {
-	port, err := serial.Open(name, DefaultConfig())
+	port, err := serial.Open(name, p.Mode())
+	if err != nil {
+		logger.Error("Port open failed", "port", name, "err", err)
+		return nil, err
+	}
+	err = port.SetReadTimeout(ReadTimeout)
 	if err != nil {
-		log.Printf("Port %s open failed\n", name)
+		_ = port.Close()
+		logger.Error("Port open failed", "port", name, "err", err)
 		return nil, err
 	}
+	p.mutex.Lock()
 	p.Name = name
 	p.SerialPort = port
 	p.Number = extractNum(name)
-	log.Printf("Port %s opened successful\n", name)
+	p.mutex.Unlock()
+	logger.Info("Port opened", "port", name)
 	return port, nil
 }
 
 func (p *Port) ClosePort() error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
 	if p.SerialPort != nil {
 		_ = p.SerialPort.ResetOutputBuffer()
 		_ = p.SerialPort.ResetInputBuffer()
 		err := p.SerialPort.Close()
 		if err != nil {
-			log.Printf("Port %s close failed\n", p.Name)
+			logger.Error("Port close failed", "port", p.Name, "err", err)
 			return err
 		}
-		log.Printf("Port %s closed successfull\n", p.Name)
+		logger.Info("Port closed", "port", p.Name)
 		p.SerialPort = nil
 	}
 	return nil
 }
 
+func (p *Port) IsOpen() bool {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.SerialPort != nil
+}
+
+func (p *Port) PortName() string {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.Name
+}
+
+func (p *Port) current() (serial.Port, string) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.SerialPort, p.Name
+}
+
 func (p *Port) WriteBytes(data []byte) error {
-	if p.SerialPort == nil {
-		return errors.New("Serial port is not open")
+	port, name := p.current()
+	if port == nil {
+		return ErrNotOpen
 	}
-	n, err := p.SerialPort.Write(data)
+	n, err := port.Write(data)
 	if err != nil {
-		return err
+		return portError(err)
 	}
-	log.Printf("Written %d bytes to port %s\n", n, p.Name)
+	logger.Debug("Written bytes", "bytes", n, "port", name)
+	metrics.PortBytes.With(name, "write").Add(float64(n))
+	p.record(Write, name, data[:n])
 	//err = p.SerialPort.ResetOutputBuffer()
 	//if err != nil {
 	//	return err
@@ -71,24 +147,86 @@ func (p *Port) WriteBytes(data []byte) error {
 	return nil
 }
 
+// ReadBytes waits at most ReadTimeout for data and returns an empty slice
+// when nothing arrived. The returned slice is reused by the next call.
 func (p *Port) ReadBytes() ([]byte, error) {
-	if p.SerialPort == nil {
-		return nil, errors.New("Serial port is not open")
+	port, name := p.current()
+	if port == nil {
+		return nil, ErrNotOpen
+	}
+	if p.buff == nil {
+		p.buff = make([]byte, 256)
 	}
-	buff := make([]byte, 256)
-	n, err := p.SerialPort.Read(buff)
+	n, err := port.Read(p.buff)
 	if err != nil {
-		return nil, err
+		return nil, portError(err)
 	}
 	//err = p.SerialPort.ResetInputBuffer()
 	//if err != nil {
 	//	return nil, err
 	//}
-	log.Printf("Read %d bytes from port %s\n", n, p.Name)
-	return buff[:n], nil
+	if n > 0 {
+		logger.Debug("Read bytes", "bytes", n, "port", name)
+		metrics.PortBytes.With(name, "read").Add(float64(n))
+		p.record(Read, name, p.buff[:n])
+	}
+	return p.buff[:n], nil
+}
+
+func (p *Port) ReadContext(ctx context.Context) ([]byte, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		data, err := p.ReadBytes()
+		if err != nil || len(data) > 0 {
+			return data, err
+		}
+	}
+}
+
+func (p *Port) Chunks(ctx context.Context) <-chan Chunk {
+	return ReadChunks(ctx, p)
+}
+
+// ReadChunks starts a reader goroutine that publishes copies of everything
+// read from source. The channel is closed when the port is closed or ctx is
+// cancelled; any other read error is published as the last chunk.
+func ReadChunks(ctx context.Context, source Source) <-chan Chunk {
+	chunks := make(chan Chunk, 16)
+	go func() {
+		defer close(chunks)
+		for {
+			data, err := source.ReadContext(ctx)
+			if ctx.Err() != nil || errors.Is(err, ErrPortClosed) || errors.Is(err, ErrNotOpen) {
+				return
+			}
+			number, _ := source.PortNumber()
+			chunk := Chunk{Port: number, Data: append([]byte(nil), data...), Err: err}
+			select {
+			case chunks <- chunk:
+			case <-ctx.Done():
+				return
+			}
+			if err != nil {
+				return
+			}
+		}
+	}()
+	return chunks
+}
+
+func portError(err error) error {
+	var portErr *serial.PortError
+	if errors.As(err, &portErr) && portErr.Code() == serial.PortClosed {
+		return ErrPortClosed
+	}
+	return err
 }
 
 func (p *Port) PortNumber() (int, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
 	var numberStr string
 	for i := len(p.Name) - 1; i >= 0; i-- {
 		if p.Name[i] >= '0' && p.Name[i] <= '9' {
@@ -0,0 +1,110 @@
+// Package settings holds the link settings that can change while the link
+// runs. Every link has a Store; the transmitter and the packet code take a
+// copy once per frame, so a change applies from the next frame on.
+package settings
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrUnknownFCSMode = errors.New("Unknown FCS mode")
+
+// FCSMode is what the Hamming FCS of a packet is used for.
+type FCSMode int
+
+const (
+	// FCSCorrect computes the FCS and corrects a wrong data bit with it.
+	FCSCorrect FCSMode = iota
+	// FCSDetect computes the FCS and drops packets that do not match it.
+	FCSDetect
+	// FCSOff sends a zero FCS and ignores it on receipt.
+	FCSOff
+)
+
+var FCSModeNames = []string{"correct", "detect", "off"}
+
+func (m FCSMode) String() string {
+	return FCSModeNames[m]
+}
+
+func ParseFCSMode(name string) (FCSMode, error) {
+	for i, modeName := range FCSModeNames {
+		if strings.EqualFold(modeName, name) {
+			return FCSMode(i), nil
+		}
+	}
+	return 0, ErrUnknownFCSMode
+}
+
+// Link is the channel simulation and the error control: how often, in
+// percent, the channel is found busy, a byte collides and a data bit is
+// distorted, how many times a collided byte is sent again before the frame
+// is aborted, and the unit and exponent limit of the backoff.
+type Link struct {
+	BusyChance       int
+	CollisionChance  int
+	DistortionChance int
+	MaxAttempts      int
+	SlotTime         time.Duration
+	BackoffLimit     int
+	FCS              FCSMode
+}
+
+// Range is the whole numbers from Min to Max a setting may take.
+type Range struct {
+	Min int
+	Max int
+}
+
+// Ranges of the whole-number settings. The transmitter listens until the
+// channel is free, so it must be free sometimes.
+var (
+	BusyChanceRange       = Range{Min: 0, Max: 99}
+	CollisionChanceRange  = Range{Min: 0, Max: 100}
+	DistortionChanceRange = Range{Min: 0, Max: 100}
+	MaxAttemptsRange      = Range{Min: 1, Max: 100}
+	BackoffLimitRange     = Range{Min: 0, Max: 16}
+)
+
+var Default = Link{
+	BusyChance:       70,
+	CollisionChance:  30,
+	DistortionChance: 30,
+	MaxAttempts:      16,
+	SlotTime:         time.Millisecond,
+	BackoffLimit:     10,
+	FCS:              FCSCorrect,
+}
+
+// Store is the settings of one link, safe to change while it runs.
+type Store struct {
+	mutex sync.RWMutex
+	link  Link
+}
+
+func NewStore(link Link) *Store {
+	return &Store{link: link}
+}
+
+func (s *Store) Current() Link {
+	s.mutex.RLock()
+	defer s.mutex.RUnlock()
+	return s.link
+}
+
+func (s *Store) Set(link Link) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.link = link
+}
+
+// Update changes some of the settings and returns the result.
+func (s *Store) Update(change func(link *Link)) Link {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	change(&s.link)
+	return s.link
+}
@@ -0,0 +1,38 @@
+package settings
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestParseFCSMode(t *testing.T) {
+	for i, name := range FCSModeNames {
+		mode, err := ParseFCSMode(name)
+		if err != nil || mode != FCSMode(i) || mode.String() != name {
+			t.Errorf("ParseFCSMode(%q) = %v, %v", name, mode, err)
+		}
+	}
+	if _, err := ParseFCSMode("parity"); err != ErrUnknownFCSMode {
+		t.Errorf("ParseFCSMode(parity) error = %v, want %v", err, ErrUnknownFCSMode)
+	}
+}
+
+func TestUpdateIsAtomic(t *testing.T) {
+	store := NewStore(Default)
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			store.Update(func(link *Link) { link.BusyChance++ })
+		}()
+		go func() {
+			defer wg.Done()
+			_ = store.Current().BusyChance
+		}()
+	}
+	wg.Wait()
+	if got, want := store.Current().BusyChance, Default.BusyChance+100; got != want {
+		t.Errorf("BusyChance = %d, want %d", got, want)
+	}
+}
@@ -0,0 +1,29 @@
+// Package stack is the protocol stack of one link: the framing and line
+// code it was opened with, the settings that can change while it runs and
+// its statistics. Links of one application share nothing else.
+package stack
+
+import (
+	"lab_4/framing"
+	"lab_4/linecode"
+	"lab_4/settings"
+	"lab_4/stats"
+)
+
+type Stack struct {
+	Framer   framing.Framer
+	Code     linecode.Code
+	BaudRate int
+	Settings *settings.Store
+	Stats    *stats.Session
+}
+
+func New(framer framing.Framer, code linecode.Code, baudRate int, link settings.Link) *Stack {
+	return &Stack{
+		Framer:   framer,
+		Code:     code,
+		BaudRate: baudRate,
+		Settings: settings.NewStore(link),
+		Stats:    stats.NewSession(),
+	}
+}
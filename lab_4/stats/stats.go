@@ -0,0 +1,215 @@
+// Package stats counts what the link does over a session: payload against
+// the bits actually put on the wire, collisions and backoff, and the frames
+// that arrived, were corrected by the FCS or had to be dropped. Every link
+// has its own Session; Sample keeps a per-interval history for charts and
+// CSV export.
+package stats
+
+import (
+	"encoding/csv"
+	"io"
+	"strconv"
+	"sync"
+	"time"
+)
+
+type Counters struct {
+	FramesSent        int
+	FramesAborted     int
+	FramesReceived    int
+	FramesCorrected   int
+	FramesDropped     int
+	JamsReceived      int
+	AbortsReceived    int
+	PayloadBits       int
+	WireBits          int
+	RetransmittedBits int
+	Collisions        int
+	Backoff           time.Duration
+}
+
+type Snapshot struct {
+	Time    time.Time
+	Elapsed time.Duration
+	Counters
+}
+
+// Efficiency is the share of the wire bits that carried payload.
+func (s Snapshot) Efficiency() float64 {
+	if s.WireBits == 0 {
+		return 0
+	}
+	return float64(s.PayloadBits) / float64(s.WireBits)
+}
+
+// Throughput is the payload delivered in bits per second.
+func (s Snapshot) Throughput() float64 {
+	if s.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.PayloadBits) / s.Elapsed.Seconds()
+}
+
+func (s Snapshot) CollisionsPerFrame() float64 {
+	if s.FramesSent == 0 {
+		return 0
+	}
+	return float64(s.Collisions) / float64(s.FramesSent)
+}
+
+// ErrorRate is the share of received frames that were corrected or dropped.
+func (s Snapshot) ErrorRate() float64 {
+	total := s.FramesReceived + s.FramesDropped
+	if total == 0 {
+		return 0
+	}
+	return float64(s.FramesCorrected+s.FramesDropped) / float64(total)
+}
+
+const historySize = 3600
+
+type Session struct {
+	mutex    sync.Mutex
+	started  time.Time
+	counters Counters
+	history  []Snapshot
+}
+
+func NewSession() *Session {
+	return &Session{started: time.Now()}
+}
+
+func (s *Session) update(change func(counters *Counters)) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	change(&s.counters)
+}
+
+func (s *Session) FrameSent(payloadBits, wireBits int) {
+	s.update(func(counters *Counters) {
+		counters.FramesSent++
+		counters.PayloadBits += payloadBits
+		counters.WireBits += wireBits
+	})
+}
+
+// Collision counts the bits sent in vain before the collision.
+func (s *Session) Collision(wireBits int) {
+	s.update(func(counters *Counters) {
+		counters.Collisions++
+		counters.WireBits += wireBits
+		counters.RetransmittedBits += wireBits
+	})
+}
+
+func (s *Session) Backoff(delay time.Duration) {
+	s.update(func(counters *Counters) { counters.Backoff += delay })
+}
+
+func (s *Session) FrameAborted() {
+	s.update(func(counters *Counters) { counters.FramesAborted++ })
+}
+
+func (s *Session) FrameReceived() {
+	s.update(func(counters *Counters) { counters.FramesReceived++ })
+}
+
+func (s *Session) FrameCorrected() {
+	s.update(func(counters *Counters) { counters.FramesCorrected++ })
+}
+
+func (s *Session) FrameDropped() {
+	s.update(func(counters *Counters) { counters.FramesDropped++ })
+}
+
+// JamReceived counts a jam from the other side, which takes back the last
+// byte received.
+func (s *Session) JamReceived() {
+	s.update(func(counters *Counters) { counters.JamsReceived++ })
+}
+
+func (s *Session) AbortReceived() {
+	s.update(func(counters *Counters) { counters.AbortsReceived++ })
+}
+
+func (s *Session) Current() Snapshot {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.current(time.Now())
+}
+
+func (s *Session) current(now time.Time) Snapshot {
+	return Snapshot{Time: now, Elapsed: now.Sub(s.started), Counters: s.counters}
+}
+
+// Sample adds the current counters to the history and returns them.
+func (s *Session) Sample() Snapshot {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	snapshot := s.current(time.Now())
+	if len(s.history) >= historySize {
+		s.history = append(s.history[:0], s.history[1:]...)
+	}
+	s.history = append(s.history, snapshot)
+	return snapshot
+}
+
+func (s *Session) History() []Snapshot {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]Snapshot(nil), s.history...)
+}
+
+func (s *Session) Reset() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.started = time.Now()
+	s.counters = Counters{}
+	s.history = nil
+}
+
+var header = []string{
+	"time", "elapsed_s", "frames_sent", "frames_aborted", "frames_received",
+	"frames_corrected", "frames_dropped", "jams_received", "aborts_received",
+	"payload_bits", "wire_bits", "retransmitted_bits", "collisions", "backoff_s", "throughput_bps",
+	"efficiency", "collisions_per_frame", "error_rate",
+}
+
+func WriteCSV(w io.Writer, history []Snapshot) error {
+	writer := csv.NewWriter(w)
+	err := writer.Write(header)
+	if err != nil {
+		return err
+	}
+	for _, s := range history {
+		err = writer.Write([]string{
+			s.Time.Format(time.RFC3339),
+			formatFloat(s.Elapsed.Seconds()),
+			strconv.Itoa(s.FramesSent),
+			strconv.Itoa(s.FramesAborted),
+			strconv.Itoa(s.FramesReceived),
+			strconv.Itoa(s.FramesCorrected),
+			strconv.Itoa(s.FramesDropped),
+			strconv.Itoa(s.JamsReceived),
+			strconv.Itoa(s.AbortsReceived),
+			strconv.Itoa(s.PayloadBits),
+			strconv.Itoa(s.WireBits),
+			strconv.Itoa(s.RetransmittedBits),
+			strconv.Itoa(s.Collisions),
+			formatFloat(s.Backoff.Seconds()),
+			formatFloat(s.Throughput()),
+			formatFloat(s.Efficiency()),
+			formatFloat(s.CollisionsPerFrame()),
+			formatFloat(s.ErrorRate()),
+		})
+		if err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func formatFloat(value float64) string {
+	return strconv.FormatFloat(value, 'f', 3, 64)
+}
@@ -0,0 +1,98 @@
+package stats
+
+import (
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+)
+
+func TestCounters(t *testing.T) {
+	session := NewSession()
+	session.FrameSent(7, 27)
+	session.FrameSent(7, 28)
+	session.Collision(3)
+	session.Backoff(2 * time.Millisecond)
+	session.FrameReceived()
+	session.FrameReceived()
+	session.FrameCorrected()
+	session.FrameDropped()
+	session.FrameAborted()
+	session.JamReceived()
+	session.AbortReceived()
+	s := session.Current()
+	want := Counters{
+		FramesSent:        2,
+		FramesAborted:     1,
+		FramesReceived:    2,
+		FramesCorrected:   1,
+		FramesDropped:     1,
+		JamsReceived:      1,
+		AbortsReceived:    1,
+		PayloadBits:       14,
+		WireBits:          58,
+		RetransmittedBits: 3,
+		Collisions:        1,
+		Backoff:           2 * time.Millisecond,
+	}
+	if s.Counters != want {
+		t.Errorf("Current() = %+v, want %+v", s.Counters, want)
+	}
+	if got := s.Efficiency(); got != 14.0/58 {
+		t.Errorf("Efficiency() = %v", got)
+	}
+	if got := s.CollisionsPerFrame(); got != 0.5 {
+		t.Errorf("CollisionsPerFrame() = %v", got)
+	}
+	if got := s.ErrorRate(); got != 2.0/3 {
+		t.Errorf("ErrorRate() = %v", got)
+	}
+	s.Elapsed = 2 * time.Second
+	if got := s.Throughput(); got != 7 {
+		t.Errorf("Throughput() = %v", got)
+	}
+}
+
+func TestSessionsAreIndependent(t *testing.T) {
+	first, second := NewSession(), NewSession()
+	first.FrameSent(7, 27)
+	second.Collision(1)
+	if got := first.Current().Collisions; got != 0 {
+		t.Errorf("first session has %d collisions of the second", got)
+	}
+	if got := second.Current().FramesSent; got != 0 {
+		t.Errorf("second session has %d frames of the first", got)
+	}
+	first.Reset()
+	if got := first.Current().FramesSent; got != 0 {
+		t.Errorf("FramesSent after Reset() = %d", got)
+	}
+}
+
+func TestEmptySnapshot(t *testing.T) {
+	var s Snapshot
+	if s.Efficiency() != 0 || s.Throughput() != 0 || s.CollisionsPerFrame() != 0 || s.ErrorRate() != 0 {
+		t.Errorf("empty snapshot has rates: %+v", s)
+	}
+}
+
+func TestWriteCSV(t *testing.T) {
+	session := NewSession()
+	session.Sample()
+	session.FrameSent(7, 26)
+	session.Sample()
+	var buffer bytes.Buffer
+	if err := WriteCSV(&buffer, session.History()); err != nil {
+		t.Fatal(err)
+	}
+	records, err := csv.NewReader(&buffer).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 3 {
+		t.Fatalf("%d records, want a header and 2 samples", len(records))
+	}
+	if records[0][2] != "frames_sent" || records[2][2] != "1" || records[2][10] != "26" {
+		t.Errorf("unexpected CSV: %v", records)
+	}
+}
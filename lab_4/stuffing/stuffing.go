@@ -0,0 +1,180 @@
+// Package stuffing implements bit stuffing as a codec driven by a Rule.
+// Bits are stored one per byte, like everywhere else in the labs. After
+// every occurrence of Rule.Pattern on the line the encoder inserts
+// Rule.Stuff, so Rule.Flag can only appear where a frame starts.
+//
+// The search window is primed with the opening flag: its tail counts
+// toward the pattern, otherwise a body starting with the rest of the
+// pattern would recreate the flag right after it (10000111 000011 1...).
+package stuffing
+
+import (
+	"bytes"
+	"errors"
+)
+
+var (
+	ErrInvalidRule = errors.New("Invalid stuffing rule")
+	ErrNoFlag      = errors.New("Frame does not start with the flag")
+	ErrFlag        = errors.New("Flag or abort sequence inside the frame")
+)
+
+type Rule struct {
+	Name    string
+	Flag    []byte
+	Pattern []byte
+	Stuff   byte
+}
+
+var (
+	// Lab is the rule of the lab assignment: flag 10000111, a 0 after
+	// every 1000011.
+	Lab = Rule{
+		Name:    "lab",
+		Flag:    []byte{1, 0, 0, 0, 0, 1, 1, 1},
+		Pattern: []byte{1, 0, 0, 0, 0, 1, 1},
+		Stuff:   0,
+	}
+	// HDLC is classic HDLC: flag 0x7E, a 0 after every five 1s.
+	HDLC = Rule{
+		Name:    "hdlc",
+		Flag:    []byte{0, 1, 1, 1, 1, 1, 1, 0},
+		Pattern: []byte{1, 1, 1, 1, 1},
+		Stuff:   0,
+	}
+)
+
+// Validate checks that the rule can be decoded unambiguously: the stuffed
+// bit never completes the pattern again, and the flag contains the pattern
+// followed by the other bit, so it cannot survive stuffing.
+func (r Rule) Validate() error {
+	if len(r.Pattern) == 0 || len(r.Flag) <= len(r.Pattern) || r.Stuff > 1 {
+		return ErrInvalidRule
+	}
+	if r.Pattern[len(r.Pattern)-1] == r.Stuff {
+		return ErrInvalidRule
+	}
+	for i := 0; i+len(r.Pattern) < len(r.Flag); i++ {
+		if bytes.Equal(r.Flag[i:i+len(r.Pattern)], r.Pattern) && r.Flag[i+len(r.Pattern)] != r.Stuff {
+			return nil
+		}
+	}
+	return ErrInvalidRule
+}
+
+// Encode returns the flag followed by the stuffed body and the positions of
+// the inserted bits, counted from the first bit of the flag.
+func (r Rule) Encode(body []byte) ([]byte, []int) {
+	encoder := NewEncoder(r)
+	frame := append([]byte(nil), r.Flag...)
+	for _, bit := range body {
+		frame = append(frame, encoder.WriteBit(bit)...)
+	}
+	return frame, encoder.Inserted()
+}
+
+// Decode checks the flag at the start of frame and returns the body with
+// the stuffed bits removed, along with their positions in frame.
+func (r Rule) Decode(frame []byte) ([]byte, []int, error) {
+	if !bytes.HasPrefix(frame, r.Flag) {
+		return nil, nil, ErrNoFlag
+	}
+	decoder := NewDecoder(r)
+	body := make([]byte, 0, len(frame))
+	for _, bit := range frame[len(r.Flag):] {
+		bit, ok, err := decoder.ReadBit(bit)
+		if err != nil {
+			return body, decoder.Removed(), err
+		}
+		if ok {
+			body = append(body, bit)
+		}
+	}
+	return body, decoder.Removed(), nil
+}
+
+type window struct {
+	rule Rule
+	bits []byte
+}
+
+func newWindow(rule Rule) window {
+	bits := append([]byte(nil), rule.Flag[len(rule.Flag)-len(rule.Pattern):]...)
+	return window{rule: rule, bits: bits}
+}
+
+func (w *window) push(bit byte) bool {
+	copy(w.bits, w.bits[1:])
+	w.bits[len(w.bits)-1] = bit
+	return bytes.Equal(w.bits, w.rule.Pattern)
+}
+
+// Encoder stuffs a body one bit at a time, right after the opening flag.
+type Encoder struct {
+	window   window
+	written  int
+	inserted []int
+}
+
+func NewEncoder(rule Rule) *Encoder {
+	return &Encoder{window: newWindow(rule), written: len(rule.Flag)}
+}
+
+// WriteBit returns the bits to put on the line for one body bit: the bit
+// itself and, when it completes the pattern, the stuffed bit.
+func (e *Encoder) WriteBit(bit byte) []byte {
+	e.written++
+	if !e.window.push(bit) {
+		return []byte{bit}
+	}
+	e.window.push(e.window.rule.Stuff)
+	e.inserted = append(e.inserted, e.written)
+	e.written++
+	return []byte{bit, e.window.rule.Stuff}
+}
+
+func (e *Encoder) Inserted() []int {
+	return append([]int(nil), e.inserted...)
+}
+
+// Decoder removes stuffed bits one line bit at a time, starting right after
+// the opening flag.
+type Decoder struct {
+	window  window
+	read    int
+	pending bool
+	removed []int
+}
+
+func NewDecoder(rule Rule) *Decoder {
+	return &Decoder{window: newWindow(rule), read: len(rule.Flag)}
+}
+
+// ReadBit returns the body bit and true, or false when bit was stuffed.
+// A bit other than the stuffed one after the pattern means a flag or an
+// abort sequence, which is reported as ErrFlag.
+func (d *Decoder) ReadBit(bit byte) (byte, bool, error) {
+	position := d.read
+	d.read++
+	if d.pending {
+		d.pending = false
+		d.window.push(bit)
+		if bit != d.window.rule.Stuff {
+			return bit, false, ErrFlag
+		}
+		d.removed = append(d.removed, position)
+		return 0, false, nil
+	}
+	d.pending = d.window.push(bit)
+	return bit, true, nil
+}
+
+// Pending reports whether the next bit on the line must be a stuffed one,
+// so a frame cannot end yet.
+func (d *Decoder) Pending() bool {
+	return d.pending
+}
+
+func (d *Decoder) Removed() []int {
+	return append([]int(nil), d.removed...)
+}
@@ -0,0 +1,160 @@
+package stuffing
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func bits(text string) []byte {
+	var result []byte
+	for _, char := range strings.ReplaceAll(text, " ", "") {
+		result = append(result, byte(char-'0'))
+	}
+	return result
+}
+
+func str(bits []byte) string {
+	var text strings.Builder
+	for _, bit := range bits {
+		text.WriteByte(bit + '0')
+	}
+	return text.String()
+}
+
+func TestRulesAreValid(t *testing.T) {
+	for _, rule := range []Rule{Lab, HDLC} {
+		if err := rule.Validate(); err != nil {
+			t.Errorf("%s: %v", rule.Name, err)
+		}
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	tests := []Rule{
+		{Name: "empty pattern", Flag: bits("01111110"), Stuff: 0},
+		{Name: "pattern as long as flag", Flag: bits("0110"), Pattern: bits("0110")},
+		{Name: "stuff completes pattern", Flag: bits("01111110"), Pattern: bits("11110"), Stuff: 0},
+		{Name: "flag survives stuffing", Flag: bits("00000000"), Pattern: bits("11111"), Stuff: 0},
+		{Name: "stuff is not a bit", Flag: bits("01111110"), Pattern: bits("11111"), Stuff: 2},
+	}
+	for _, rule := range tests {
+		if err := rule.Validate(); !errors.Is(err, ErrInvalidRule) {
+			t.Errorf("%s: Validate() = %v", rule.Name, err)
+		}
+	}
+}
+
+func TestKnownVectors(t *testing.T) {
+	tests := []struct {
+		rule     Rule
+		body     string
+		want     string
+		inserted []int
+	}{
+		{HDLC, "01111110", "01111110 011111010", []int{14}},
+		{HDLC, "11111111", "01111110 111110111", []int{13}},
+		{HDLC, "1111111111", "01111110 111110111110", []int{13, 19}},
+		{HDLC, "0111110", "01111110 01111100", []int{14}},
+		{HDLC, "0101010", "01111110 0101010", nil},
+		{Lab, "0000 0001 0000000 000", "10000111 0000 0001 0000000 000", nil},
+		{Lab, "0000 0001 0000110 110", "10000111 0000 0001 0000110 0 110", []int{22}},
+		{Lab, "0000 1100 1000000 100", "10000111 0000 11 0 00 1000000 100", []int{14}},
+		{Lab, "0000 1100 0111000 101", "10000111 0000 11 0 000 11 0 1000 101", []int{14, 20}},
+		{Lab, "000011", "10000111 000011 0", []int{14}},
+		{Lab, "1000011", "10000111 1000011 0", []int{15}},
+	}
+	for _, test := range tests {
+		t.Run(test.rule.Name+"/"+test.body, func(t *testing.T) {
+			frame, inserted := test.rule.Encode(bits(test.body))
+			if got := str(frame); got != str(bits(test.want)) {
+				t.Errorf("Encode() = %s, want %s", got, str(bits(test.want)))
+			}
+			if !reflect.DeepEqual(inserted, test.inserted) {
+				t.Errorf("Encode() inserted at %v, want %v", inserted, test.inserted)
+			}
+			body, removed, err := test.rule.Decode(frame)
+			if err != nil {
+				t.Fatalf("Decode() error: %v", err)
+			}
+			if !bytes.Equal(body, bits(test.body)) {
+				t.Errorf("Decode() = %s, want %s", str(body), str(bits(test.body)))
+			}
+			if !reflect.DeepEqual(removed, test.inserted) {
+				t.Errorf("Decode() removed %v, want %v", removed, test.inserted)
+			}
+		})
+	}
+}
+
+func TestFlagOnlyAtStart(t *testing.T) {
+	for _, rule := range []Rule{Lab, HDLC} {
+		for value := 0; value < 1<<12; value++ {
+			body := bits(fmt.Sprintf("%012b", value))
+			frame, _ := rule.Encode(body)
+			if i := bytes.Index(frame[1:], rule.Flag); i >= 0 {
+				t.Fatalf("%s: flag at %d in %s", rule.Name, i+1, str(frame))
+			}
+			decoded, _, err := rule.Decode(frame)
+			if err != nil || !bytes.Equal(decoded, body) {
+				t.Fatalf("%s: %s decoded as %s, %v", rule.Name, str(body), str(decoded), err)
+			}
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	if _, _, err := HDLC.Decode(bits("0111")); !errors.Is(err, ErrNoFlag) {
+		t.Errorf("Decode() without flag = %v", err)
+	}
+	if _, _, err := HDLC.Decode(bits("01111110 0101 01111110")); !errors.Is(err, ErrFlag) {
+		t.Errorf("Decode() with closing flag = %v", err)
+	}
+	if _, _, err := Lab.Decode(bits("10000111 0000 10000111")); !errors.Is(err, ErrFlag) {
+		t.Errorf("Decode() with second flag = %v", err)
+	}
+}
+
+func TestDecoderPending(t *testing.T) {
+	decoder := NewDecoder(HDLC)
+	for _, bit := range bits("11111") {
+		if _, ok, err := decoder.ReadBit(bit); !ok || err != nil {
+			t.Fatalf("ReadBit(%d) = %v, %v", bit, ok, err)
+		}
+	}
+	if !decoder.Pending() {
+		t.Fatal("Pending() = false after five 1s")
+	}
+	if _, ok, err := decoder.ReadBit(0); ok || err != nil {
+		t.Fatalf("stuffed ReadBit(0) = %v, %v", ok, err)
+	}
+	if decoder.Pending() {
+		t.Error("Pending() = true after the stuffed bit")
+	}
+}
+
+func FuzzRoundTrip(f *testing.F) {
+	f.Add([]byte{1, 1, 1, 1, 1, 1}, false)
+	f.Add([]byte{0, 0, 0, 0, 1, 1, 1}, true)
+	f.Fuzz(func(t *testing.T, data []byte, lab bool) {
+		rule := HDLC
+		if lab {
+			rule = Lab
+		}
+		body := make([]byte, len(data))
+		for i := range data {
+			body[i] = data[i] & 1
+		}
+		frame, inserted := rule.Encode(body)
+		if bytes.Contains(frame[1:], rule.Flag) {
+			t.Fatalf("flag inside %s", str(frame))
+		}
+		decoded, removed, err := rule.Decode(frame)
+		if err != nil || !bytes.Equal(decoded, body) || !reflect.DeepEqual(removed, inserted) {
+			t.Fatalf("%s decoded as %s, %v", str(body), str(decoded), err)
+		}
+	})
+}
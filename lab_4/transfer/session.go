@@ -0,0 +1,221 @@
+package transfer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"lab_4/gui"
+	"lab_4/logging"
+	"lab_4/queue"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var logger = logging.For("transfer")
+
+// Send queues the transfer of content packet by packet and returns once
+// the transmitter has sent the last one. A packet the transmitter could
+// not send fails the transfer, as the receiver cannot complete it.
+func Send(ctx context.Context, sendQueue *queue.Queue, name string, content []byte, events gui.Publisher) error {
+	text, err := Encode(name, content)
+	if err != nil {
+		return err
+	}
+	progress := &gui.TransferReporter{Events: events}
+	logger.Info("File transfer started", "name", name, "size", len(content))
+	progress.Start(gui.TransferProgress{Sending: true, Name: name, Size: int64(len(content)),
+		Total: int64(len(text))})
+	// Start on a packet boundary whatever was typed before.
+	err = sendQueue.Send(ctx, nil)
+	if err != nil {
+		return finish(progress, err)
+	}
+	batch := new(queue.Batch)
+	for sent := 0; sent < len(text); sent += PacketSize {
+		done, err := batch.Done()
+		if err != nil {
+			return finish(progress, fmt.Errorf("%w: %w", ErrNotSent, err))
+		}
+		progress.Update(int64(done * PacketSize))
+		err = sendQueue.SendBatch(ctx, batch, []byte(text[sent:sent+PacketSize]))
+		if err != nil {
+			return finish(progress, err)
+		}
+	}
+	for {
+		done, err := batch.Done()
+		if err != nil {
+			return finish(progress, fmt.Errorf("%w: %w", ErrNotSent, err))
+		}
+		progress.Update(int64(done * PacketSize))
+		if done*PacketSize == len(text) {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return finish(progress, ctx.Err())
+		case <-time.After(gui.ProgressInterval):
+		}
+	}
+	logger.Info("File transfer sent", "name", name)
+	return finish(progress, nil)
+}
+
+func SendFile(ctx context.Context, sendQueue *queue.Queue, path string, events gui.Publisher) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return Send(ctx, sendQueue, filepath.Base(path), content, events)
+}
+
+func finish(progress *gui.TransferReporter, err error) error {
+	progress.Finish("", err)
+	return err
+}
+
+// DefaultTimeout is how long a receiver waits for the next packet of a
+// transfer before failing it.
+const DefaultTimeout = 10 * time.Second
+
+// Receiver sits between the link and the interface: received text is
+// passed on unless a transfer is running, in which case it is decoded and
+// the file saved to Dir. A marker always starts a new transfer, failing
+// the one that was running.
+type Receiver struct {
+	Dir string
+	// Timeout fails a running transfer when no packet arrived for that
+	// long; 0 waits forever.
+	Timeout  time.Duration
+	mutex    sync.Mutex
+	next     gui.Publisher
+	decoder  *Decoder
+	progress gui.TransferReporter
+	received time.Time
+	timer    *time.Timer
+}
+
+func NewReceiver(dir string, next gui.Publisher) *Receiver {
+	return &Receiver{Dir: dir, Timeout: DefaultTimeout, next: next,
+		progress: gui.TransferReporter{Events: next}}
+}
+
+func (r *Receiver) Publish(event gui.Event) {
+	frame, ok := event.(gui.FrameReceived)
+	if !ok {
+		r.next.Publish(event)
+		return
+	}
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if frame.Data == Marker {
+		if r.decoder != nil {
+			if done, _ := r.decoder.Progress(); done == 0 {
+				// Pending text the sender completed with newlines can look
+				// like a marker right before the real one.
+				r.watch()
+				return
+			}
+			r.finish(nil, ErrInterrupted)
+		}
+		r.decoder = new(Decoder)
+		r.progress.State = gui.TransferProgress{Started: time.Now()}
+		logger.Info("File transfer incoming", "port", frame.Port)
+		r.watch()
+		return
+	}
+	if r.decoder == nil {
+		r.next.Publish(event)
+		return
+	}
+	r.watch()
+	complete, err := r.decoder.Feed(frame.Data)
+	if header := r.decoder.Header(); header != nil {
+		r.progress.State.Name, r.progress.State.Size = header.Name, header.Size
+	}
+	r.progress.State.Done, r.progress.State.Total = r.decoder.Progress()
+	if err != nil {
+		r.finish(nil, err)
+		r.next.Publish(event)
+		return
+	}
+	if complete {
+		r.finish(r.decoder.Content())
+		return
+	}
+	if r.decoder.Header() != nil {
+		r.progress.Update(r.progress.State.Done)
+	}
+}
+
+// watch restarts the wait for the next packet of the running transfer.
+func (r *Receiver) watch() {
+	r.received = time.Now()
+	if r.Timeout <= 0 {
+		return
+	}
+	if r.timer == nil {
+		r.timer = time.AfterFunc(r.Timeout, r.expire)
+		return
+	}
+	r.timer.Reset(r.Timeout)
+}
+
+func (r *Receiver) expire() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if r.decoder != nil && time.Since(r.received) >= r.Timeout {
+		r.finish(nil, ErrTimeout)
+	}
+}
+
+func (r *Receiver) finish(content []byte, err error) {
+	if r.timer != nil {
+		r.timer.Stop()
+	}
+	var path string
+	if err == nil {
+		path, err = r.save(content)
+	}
+	if err != nil {
+		logger.Warn("File transfer failed", "name", r.progress.State.Name, "err", err)
+	} else {
+		logger.Info("File received", "path", path, "size", len(content))
+	}
+	r.progress.Finish(path, err)
+	r.decoder = nil
+}
+
+func (r *Receiver) save(content []byte) (string, error) {
+	name := filepath.Base(r.progress.State.Name)
+	if name == "." || name == string(filepath.Separator) || name == ".." {
+		name = "received"
+	}
+	err := os.MkdirAll(r.Dir, 0o755)
+	if err != nil {
+		return "", err
+	}
+	ext := filepath.Ext(name)
+	for i := 0; ; i++ {
+		path := filepath.Join(r.Dir, name)
+		if i > 0 {
+			path = filepath.Join(r.Dir, strings.TrimSuffix(name, ext)+"."+strconv.Itoa(i)+ext)
+		}
+		file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", err
+		}
+		_, err = file.Write(content)
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		return path, err
+	}
+}
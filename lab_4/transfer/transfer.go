@@ -0,0 +1,169 @@
+// Package transfer sends files over the link as text the packets can carry.
+// A transfer starts with a packet of seven newlines, then the header and
+// the content follow as '0' and '1' characters, eight per byte and most
+// significant bit first, padded with '0' to whole packets:
+//
+//	name length (16 bits) | name | size (64 bits) | SHA-256 (256 bits) | content
+package transfer
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"strings"
+)
+
+const (
+	Marker      = "\n\n\n\n\n\n\n"
+	PacketSize  = 7
+	MaxFileSize = 16 << 20
+	MaxNameSize = 255
+)
+
+var (
+	ErrNameTooLong = errors.New("File name is too long")
+	ErrTooLarge    = errors.New("File is too large to transfer")
+	ErrChecksum    = errors.New("File checksum does not match")
+	ErrInterrupted = errors.New("Transfer interrupted by other data")
+	ErrNotSent     = errors.New("Packets of the transfer were not sent")
+	ErrTimeout     = errors.New("Transfer stopped arriving")
+)
+
+type Header struct {
+	Name string
+	Size int64
+	Sum  [sha256.Size]byte
+}
+
+func NewHeader(name string, content []byte) Header {
+	return Header{Name: name, Size: int64(len(content)), Sum: sha256.Sum256(content)}
+}
+
+func (h Header) bytes() []byte {
+	header := binary.BigEndian.AppendUint16(nil, uint16(len(h.Name)))
+	header = append(header, h.Name...)
+	header = binary.BigEndian.AppendUint64(header, uint64(h.Size))
+	return append(header, h.Sum[:]...)
+}
+
+// Bits is the length of the transfer after the marker, padding included.
+func (h Header) Bits() int64 {
+	bits := 8 * (int64(len(h.bytes())) + h.Size)
+	return (bits + PacketSize - 1) / PacketSize * PacketSize
+}
+
+// Encode returns the whole transfer of content as packet text.
+func Encode(name string, content []byte) (string, error) {
+	if len(name) > MaxNameSize {
+		return "", ErrNameTooLong
+	}
+	if len(content) > MaxFileSize {
+		return "", ErrTooLarge
+	}
+	header := NewHeader(name, content)
+	var text strings.Builder
+	text.Grow(PacketSize + int(header.Bits()))
+	text.WriteString(Marker)
+	writeBits(&text, header.bytes())
+	writeBits(&text, content)
+	for int64(text.Len()-PacketSize) < header.Bits() {
+		text.WriteByte('0')
+	}
+	return text.String(), nil
+}
+
+func writeBits(text *strings.Builder, data []byte) {
+	for _, b := range data {
+		for bit := 7; bit >= 0; bit-- {
+			text.WriteByte('0' + b>>bit&1)
+		}
+	}
+}
+
+// Decoder follows the received text of one transfer after its marker.
+type Decoder struct {
+	data    []byte
+	header  *Header
+	pending byte
+	count   int
+}
+
+// Feed adds received text and reports whether the transfer is complete.
+func (d *Decoder) Feed(text string) (bool, error) {
+	if d.count == 0 && text == Marker {
+		// Pending text the sender completed with newlines can look like
+		// a marker right before the real one.
+		return false, nil
+	}
+	for i := 0; i < len(text); i++ {
+		if d.header != nil && int64(d.count) >= d.header.Bits() {
+			break
+		}
+		char := text[i]
+		if char != '0' && char != '1' {
+			return false, ErrInterrupted
+		}
+		d.pending = d.pending<<1 | (char - '0')
+		d.count++
+		if d.count%8 == 0 {
+			d.data = append(d.data, d.pending)
+			d.pending = 0
+		}
+		if d.header == nil {
+			err := d.parseHeader()
+			if err != nil {
+				return false, err
+			}
+		}
+	}
+	return d.header != nil && int64(d.count) >= d.header.Bits(), nil
+}
+
+func (d *Decoder) parseHeader() error {
+	if len(d.data) < 2 {
+		return nil
+	}
+	nameSize := int(binary.BigEndian.Uint16(d.data))
+	if nameSize > MaxNameSize {
+		return ErrNameTooLong
+	}
+	size := 2 + nameSize + 8 + sha256.Size
+	if len(d.data) < size {
+		return nil
+	}
+	header := Header{Name: string(d.data[2 : 2+nameSize])}
+	header.Size = int64(binary.BigEndian.Uint64(d.data[2+nameSize:]))
+	if header.Size < 0 || header.Size > MaxFileSize {
+		return ErrTooLarge
+	}
+	copy(header.Sum[:], d.data[2+nameSize+8:size])
+	d.header = &header
+	d.data = d.data[size:]
+	return nil
+}
+
+// Header is nil until the whole header has arrived.
+func (d *Decoder) Header() *Header {
+	return d.header
+}
+
+// Progress returns the bits received so far and the bits expected, which
+// is 0 while the header is incomplete.
+func (d *Decoder) Progress() (int64, int64) {
+	if d.header == nil {
+		return int64(d.count), 0
+	}
+	return int64(d.count), d.header.Bits()
+}
+
+// Content verifies and returns the file once Feed reported completion.
+func (d *Decoder) Content() ([]byte, error) {
+	if d.header == nil || int64(len(d.data)) < d.header.Size {
+		return nil, ErrInterrupted
+	}
+	content := d.data[:d.header.Size]
+	if sha256.Sum256(content) != d.header.Sum {
+		return nil, ErrChecksum
+	}
+	return content, nil
+}
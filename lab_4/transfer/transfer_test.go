@@ -0,0 +1,262 @@
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"lab_4/framing"
+	"lab_4/gui"
+	"lab_4/linecode"
+	"lab_4/link"
+	"lab_4/packet"
+	"lab_4/queue"
+	"lab_4/rs232"
+	"lab_4/settings"
+	"lab_4/stack"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+type recorder struct {
+	mutex    sync.Mutex
+	frames   []string
+	progress []gui.TransferProgress
+	finished chan gui.TransferProgress
+}
+
+func newRecorder() *recorder {
+	return &recorder{finished: make(chan gui.TransferProgress, 4)}
+}
+
+func (r *recorder) Publish(event gui.Event) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	switch e := event.(type) {
+	case gui.FrameReceived:
+		r.frames = append(r.frames, e.Data)
+	case gui.TransferProgress:
+		r.progress = append(r.progress, e)
+		if e.Finished {
+			r.finished <- e
+		}
+	}
+}
+
+func packets(text string) []string {
+	var result []string
+	for len(text) > 0 {
+		result = append(result, text[:PacketSize])
+		text = text[PacketSize:]
+	}
+	return result
+}
+
+func feed(r *Receiver, text string) {
+	for _, data := range packets(text) {
+		r.Publish(gui.FrameReceived{Port: "/dev/ttyS2", Data: data})
+	}
+}
+
+func TestEncodeDecode(t *testing.T) {
+	for _, content := range [][]byte{nil, []byte("x"), bytes.Repeat([]byte{0xa5, 0x00, 0xff}, 100)} {
+		text, err := Encode("data.bin", content)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(text)%PacketSize != 0 || text[:PacketSize] != Marker {
+			t.Fatalf("Encode() = %q is not whole packets after a marker", text)
+		}
+		var decoder Decoder
+		complete := false
+		for _, data := range packets(text[PacketSize:]) {
+			if complete {
+				t.Fatal("Decoder completed before the last packet")
+			}
+			complete, err = decoder.Feed(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		got, err := decoder.Content()
+		if !complete || err != nil || !bytes.Equal(got, content) {
+			t.Errorf("decoded %x, %v, %v, want %x", got, complete, err, content)
+		}
+		if decoder.Header().Name != "data.bin" {
+			t.Errorf("name = %q", decoder.Header().Name)
+		}
+	}
+}
+
+func TestEncodeLimits(t *testing.T) {
+	_, err := Encode(string(make([]byte, MaxNameSize+1)), nil)
+	if !errors.Is(err, ErrNameTooLong) {
+		t.Errorf("Encode() long name = %v", err)
+	}
+	_, err = Encode("big", make([]byte, MaxFileSize+1))
+	if !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Encode() large file = %v", err)
+	}
+}
+
+func TestReceiverSavesFile(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("old"), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := newRecorder()
+	receiver := NewReceiver(dir, events)
+	text, _ := Encode("../notes.txt", []byte("hello over the wire"))
+	feed(receiver, "0101010")
+	// Padding of typed text that looks like a marker.
+	feed(receiver, Marker+text)
+	feed(receiver, "1111111")
+
+	result := <-events.finished
+	if result.Err != nil || result.Path != filepath.Join(dir, "notes.1.txt") {
+		t.Fatalf("transfer finished with %q, %v", result.Path, result.Err)
+	}
+	content, err := os.ReadFile(result.Path)
+	if err != nil || string(content) != "hello over the wire" {
+		t.Errorf("saved %q, %v", content, err)
+	}
+	if len(events.frames) != 2 || events.frames[0] != "0101010" || events.frames[1] != "1111111" {
+		t.Errorf("passed on %q, want only the text around the transfer", events.frames)
+	}
+}
+
+func TestReceiverChecksum(t *testing.T) {
+	events := newRecorder()
+	receiver := NewReceiver(t.TempDir(), events)
+	text, _ := Encode("a", []byte("abc"))
+	corrupted := []byte(text)
+	last := len(corrupted) - PacketSize - 1
+	corrupted[last] ^= '0' ^ '1'
+	feed(receiver, string(corrupted))
+	result := <-events.finished
+	if !errors.Is(result.Err, ErrChecksum) {
+		t.Errorf("transfer finished with %v, want %v", result.Err, ErrChecksum)
+	}
+}
+
+func TestReceiverInterrupted(t *testing.T) {
+	events := newRecorder()
+	receiver := NewReceiver(t.TempDir(), events)
+	text, _ := Encode("a", []byte("abc"))
+	feed(receiver, text[:3*PacketSize]+"01\n0101")
+	result := <-events.finished
+	if !errors.Is(result.Err, ErrInterrupted) {
+		t.Errorf("transfer finished with %v, want %v", result.Err, ErrInterrupted)
+	}
+	if len(events.frames) != 1 {
+		t.Errorf("passed on %q, want the interrupting text", events.frames)
+	}
+}
+
+// withoutPacket drops the packet at index from the packets of text.
+func withoutPacket(text string, index int) string {
+	return text[:index*PacketSize] + text[(index+1)*PacketSize:]
+}
+
+func TestReceiverDroppedPacketTimesOut(t *testing.T) {
+	events := newRecorder()
+	receiver := NewReceiver(t.TempDir(), events)
+	receiver.Timeout = 20 * time.Millisecond
+	text, _ := Encode("a", []byte("abc"))
+	feed(receiver, withoutPacket(text, 5))
+	select {
+	case result := <-events.finished:
+		if !errors.Is(result.Err, ErrTimeout) {
+			t.Errorf("transfer finished with %v, want %v", result.Err, ErrTimeout)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("transfer with a dropped packet did not time out")
+	}
+}
+
+func TestReceiverRestartsOnMarker(t *testing.T) {
+	dir := t.TempDir()
+	events := newRecorder()
+	receiver := NewReceiver(dir, events)
+	text, _ := Encode("a.txt", []byte("abc"))
+	feed(receiver, withoutPacket(text, 5))
+	feed(receiver, text)
+	if result := <-events.finished; !errors.Is(result.Err, ErrInterrupted) {
+		t.Errorf("first transfer finished with %v, want %v", result.Err, ErrInterrupted)
+	}
+	result := <-events.finished
+	if result.Err != nil || result.Path != filepath.Join(dir, "a.txt") {
+		t.Errorf("second transfer finished with %q, %v", result.Path, result.Err)
+	}
+	if len(events.frames) != 0 {
+		t.Errorf("passed on %q, want nothing", events.frames)
+	}
+}
+
+func TestSendFailsOnDroppedPacket(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	sendQueue := queue.New(4)
+	dropped := errors.New("Too many collisions")
+	go func() {
+		payloads := 0
+		_ = sendQueue.Run(ctx, func(ctx context.Context, payload []byte) error {
+			payloads++
+			if payloads == 10 {
+				return dropped
+			}
+			return nil
+		})
+	}()
+	events := newRecorder()
+	err := Send(ctx, sendQueue, "a", []byte("abc"), events)
+	if !errors.Is(err, ErrNotSent) || !errors.Is(err, dropped) {
+		t.Errorf("Send() = %v, want %v", err, ErrNotSent)
+	}
+	if result := <-events.finished; result.Err != err {
+		t.Errorf("transfer finished with %v, want %v", result.Err, err)
+	}
+}
+
+func TestSendOverLink(t *testing.T) {
+	packet.Seed(1)
+	fast := settings.Default
+	fast.SlotTime = 10 * time.Microsecond
+	s := stack.New(framing.Lab, linecode.None, 115200, fast)
+
+	input, output := rs232.Pipe("/dev/ttyS1", "/dev/ttyS2")
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Second)
+	defer cancel()
+	defer input.Close()
+	sendQueue := queue.New(64)
+	sent := newRecorder()
+	received := newRecorder()
+	go link.Transmit(ctx, s, sendQueue, input, sent, nil)
+	go link.Receive(ctx, s, output.Chunks(ctx), output.PortName(), NewReceiver(t.TempDir(), received))
+
+	// Typed text not filling a packet must not shift the transfer.
+	err := sendQueue.Send(ctx, []byte("0110"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content := []byte("file sent over CSMA/CD")
+	err = Send(ctx, sendQueue, "file.txt", content, sent)
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case result := <-received.finished:
+		saved, err := os.ReadFile(result.Path)
+		if result.Err != nil || err != nil || !bytes.Equal(saved, content) {
+			t.Errorf("received %q, %v, %v", saved, result.Err, err)
+		}
+	case <-ctx.Done():
+		t.Fatal("transfer not received before timeout")
+	}
+	if result := <-sent.finished; result.Err != nil || result.Done != result.Total {
+		t.Errorf("send finished with %d of %d, %v", result.Done, result.Total, result.Err)
+	}
+}